@@ -27,15 +27,20 @@ func NewCommand(ctx context.Context) *cobra.Command {
 		},
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return signals.Execute(func(ctx context.Context) error {
+			return signals.ExecuteWithReload(func(ctx context.Context, reload <-chan struct{}) error {
 				log := opts.Logr.WithName("main")
 
 				c, err := controller.New(opts.Logr, controller.Options{
 					ConfigPath:            opts.Attestagon.ConfigPath,
 					TLSConfig:             opts.Attestagon.TLSConfig,
 					SignerConfig:          opts.Attestagon.SignerConfig,
+					SubjectVolumePath:     opts.Attestagon.SubjectVolumePath,
+					GiveUpPeriod:          opts.Attestagon.GiveUpPeriod,
+					LeaderElection:        opts.Attestagon.LeaderElection,
+					Webhook:               opts.Attestagon.Webhook,
 					TetragonServerAddress: opts.Tetragon.TetragonServerAddress,
 					RestConfig:            opts.RestConfig,
+					Reload:                reload,
 				})
 				if err != nil {
 					return err
@@ -50,5 +55,7 @@ func NewCommand(ctx context.Context) *cobra.Command {
 
 	opts.Prepare(cmd)
 
+	cmd.AddCommand(newPolicyCommand(), newVerifyCommand(ctx))
+
 	return cmd
 }
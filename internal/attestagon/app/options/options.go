@@ -2,6 +2,7 @@ package options
 
 import (
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -30,6 +31,40 @@ type OptionsAttestagon struct {
 
 	// SignerConfig is the signer configuration for the attestagon controller to use for signing the attestation.
 	SignerConfig SignerConfig
+
+	// SubjectVolumePath is the path of the volume shared with build pods that digest and metadata files are read from.
+	SubjectVolumePath string
+
+	// GiveUpPeriod is how long after a pod finished attestation is retried before the pod is released.
+	GiveUpPeriod time.Duration
+
+	// LeaderElection configures the leader election between replicas of the controller.
+	LeaderElection LeaderElection
+
+	// Webhook configures the validating admission webhook.
+	Webhook Webhook
+}
+
+// Webhook configures the validating admission webhook that verifies the attestations of pod images.
+type Webhook struct {
+	// Port is the port the webhook is served on. The webhook is disabled if it is zero.
+	Port int
+
+	// CertDir is the directory containing the tls.crt and tls.key serving certificate of the webhook.
+	CertDir string
+}
+
+// LeaderElection configures the leader election between replicas of the controller. Only the leader attests pods,
+// every replica keeps ingesting tetragon events so that a new leader has the events of recent pods.
+type LeaderElection struct {
+	// Enabled enables leader election.
+	Enabled bool
+
+	// Namespace is the namespace of the leader election lease.
+	Namespace string
+
+	// ID is the name of the leader election lease.
+	ID string
 }
 
 // OptionsTetragon is options specific to the way tetragon has been configured.
@@ -52,8 +87,29 @@ type TLSConfig struct {
 type SignerConfig struct {
 	// PrivateKeyPath is the path to the location of the PEM encoded private key
 	PrivateKeyPath string
+	// PrivateKeyPasswordPath is the path to a file containing the password for the private key
+	PrivateKeyPasswordPath string
+	// PrivateKeyPasswordEnv is the name of the environment variable containing the password for the private key
+	PrivateKeyPasswordEnv string
 	// KMSRef is the URI reference to the KMS key to use for signing
 	KMSRef string
+
+	// Keyless enables signing with a short-lived Fulcio certificate instead of a static key
+	Keyless bool
+	// FulcioURL is the address of the Fulcio instance used for keyless signing
+	FulcioURL string
+	// RekorURL is the address of the Rekor transparency log
+	RekorURL string
+	// TlogUpload enables uploading attestations signed with a static key to Rekor
+	TlogUpload bool
+	// IdentityTokenPath is the path to a projected service account token used as the OIDC identity token
+	IdentityTokenPath string
+	// IdentityTokenAudience is the audience requested for the OIDC identity token
+	IdentityTokenAudience string
+	// ServiceAccount is the service account that identity tokens are requested for, in the form <namespace>/<name>
+	ServiceAccount string
+	// TSAURL is the address of an RFC 3161 timestamp authority used to countersign attestations
+	TSAURL string
 }
 
 func New() *Options {
@@ -72,10 +128,44 @@ func (o *Options) addAttestagonFlags(fs *pflag.FlagSet) {
 		"Path to the location of the public tls certificate.")
 	fs.StringVar(&o.Attestagon.TLSConfig.CertPath, "tls-key-path", "",
 		"Path to the location of the tls private key.")
+	fs.StringVar(&o.Attestagon.SubjectVolumePath, "subject-volume-path", "",
+		"Path of a volume shared with build pods that kaniko digest files and BuildKit metadata files are read from, at <path>/<namespace>/<pod>/.")
+	fs.DurationVar(&o.Attestagon.GiveUpPeriod, "give-up-period", 30*time.Minute,
+		"How long after a pod finished attestation is retried before the attestagon finalizer is removed from the pod.")
+	fs.BoolVar(&o.Attestagon.LeaderElection.Enabled, "leader-elect", false,
+		"Elect a leader between replicas of the controller. Only the leader attests pods, all replicas ingest tetragon events.")
+	fs.StringVar(&o.Attestagon.LeaderElection.Namespace, "leader-election-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the leader election lease. Required when running outside of the cluster.")
+	fs.StringVar(&o.Attestagon.LeaderElection.ID, "leader-election-id", "attestagon-controller",
+		"Name of the leader election lease.")
+	fs.IntVar(&o.Attestagon.Webhook.Port, "webhook-port", 0,
+		"Port to serve the validating admission webhook verifying the attestations of pod images on. Disabled if 0.")
+	fs.StringVar(&o.Attestagon.Webhook.CertDir, "webhook-cert-dir", "",
+		"Directory containing the tls.crt and tls.key serving certificate of the webhook. Defaults to /tmp/k8s-webhook-server/serving-certs.")
 	fs.StringVar(&o.Attestagon.SignerConfig.PrivateKeyPath, "signer-private-key-path", os.Getenv("COSIGN_KEY"),
 		"Path to the location of the cosign private key.")
+	fs.StringVar(&o.Attestagon.SignerConfig.PrivateKeyPasswordPath, "signer-private-key-password-path", "",
+		"Path to a file containing the password for the private key. Takes precedence over the password environment variable.")
+	fs.StringVar(&o.Attestagon.SignerConfig.PrivateKeyPasswordEnv, "signer-private-key-password-env", "COSIGN_PASSWORD",
+		"The name of the environment variable containing the password for the private key.")
 	fs.StringVar(&o.Attestagon.SignerConfig.KMSRef, "signer-kms-ref", "",
 		"Path to the location of the cosign private key.")
+	fs.BoolVar(&o.Attestagon.SignerConfig.Keyless, "signer-keyless", false,
+		"Sign attestations with a short-lived Fulcio certificate obtained with the controller's service account token.")
+	fs.StringVar(&o.Attestagon.SignerConfig.FulcioURL, "signer-fulcio-url", "https://fulcio.sigstore.dev",
+		"The address of the Fulcio instance used for keyless signing.")
+	fs.StringVar(&o.Attestagon.SignerConfig.RekorURL, "signer-rekor-url", "https://rekor.sigstore.dev",
+		"The address of the Rekor transparency log.")
+	fs.BoolVar(&o.Attestagon.SignerConfig.TlogUpload, "signer-tlog-upload", false,
+		"Upload attestations signed with a private key to the Rekor transparency log. Always enabled for keyless signing.")
+	fs.StringVar(&o.Attestagon.SignerConfig.IdentityTokenPath, "signer-identity-token-path", "",
+		"Path to a projected service account token to use as the OIDC identity token. If empty, a token is requested from the Kubernetes API.")
+	fs.StringVar(&o.Attestagon.SignerConfig.IdentityTokenAudience, "signer-identity-token-audience", "sigstore",
+		"The audience of the OIDC identity token requested from the Kubernetes API.")
+	fs.StringVar(&o.Attestagon.SignerConfig.ServiceAccount, "signer-service-account", os.Getenv("SERVICE_ACCOUNT"),
+		"The service account to request identity tokens for, in the form <namespace>/<name>.")
+	fs.StringVar(&o.Attestagon.SignerConfig.TSAURL, "signer-tsa-url", "",
+		"The address of an RFC 3161 timestamp authority used to countersign attestations. Timestamping is disabled if empty.")
 }
 
 func (o *Options) addTetragonFlags(fs *pflag.FlagSet) {
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+)
+
+// newPolicyCommand returns the command evaluating policy rules outside of the cluster.
+func newPolicyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Evaluate policy rules against attestagon attestations.",
+		Long:  "Evaluate policy rules against attestagon attestations.",
+	}
+	setSubcommandHelp(cmd)
+
+	cmd.AddCommand(newPolicyEvaluateCommand())
+
+	return cmd
+}
+
+// newPolicyEvaluateCommand returns the command evaluating policy rules against an in-toto statement.
+func newPolicyEvaluateCommand() *cobra.Command {
+	var rulesPath, statementPath string
+
+	cmd := &cobra.Command{
+		Use:   "evaluate",
+		Short: "Evaluate policy rules against an attestagon in-toto statement.",
+		Long: "Evaluate the policy rules in the YAML rules file against an attestagon in-toto statement, or the DSSE " +
+			"envelope containing it, and print the violation report as JSON. Exits with an error if a rule is violated.",
+		Args: cobra.NoArgs,
+
+		// A violation is not a usage error, and main prints the error.
+		SilenceUsage:  true,
+		SilenceErrors: true,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawRules, err := os.ReadFile(rulesPath)
+			if err != nil {
+				return fmt.Errorf("reading rules: %w", err)
+			}
+
+			rules, err := policy.ParseRules(rawRules)
+			if err != nil {
+				return fmt.Errorf("parsing rules: %w", err)
+			}
+
+			engine, err := policy.NewEngine(rules)
+			if err != nil {
+				return fmt.Errorf("invalid rules: %w", err)
+			}
+
+			predicateType, pred, err := readStatement(statementPath)
+			if err != nil {
+				return err
+			}
+
+			report, err := engine.EvaluateStatement(predicateType, pred)
+			if err != nil {
+				return err
+			}
+
+			return printReport(cmd.OutOrStdout(), report)
+		},
+	}
+	setSubcommandHelp(cmd)
+
+	cmd.Flags().StringVar(&rulesPath, "rules", "", "Path to the YAML file of the policy rules.")
+	cmd.Flags().StringVar(&statementPath, "statement", "-", "Path to the in-toto statement or DSSE envelope, - for stdin.")
+	_ = cmd.MarkFlagRequired("rules")
+
+	return cmd
+}
+
+// readStatement reads the predicate type and predicate of the in-toto statement at the path, which may be wrapped in
+// a DSSE envelope.
+func readStatement(path string) (string, json.RawMessage, error) {
+	var (
+		raw []byte
+		err error
+	)
+	if path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("reading statement: %w", err)
+	}
+
+	var envelope struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return "", nil, fmt.Errorf("decoding statement: %w", err)
+	}
+	if envelope.Payload != "" {
+		raw, err = base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("decoding envelope payload: %w", err)
+		}
+	}
+
+	var statement struct {
+		PredicateType string          `json:"predicateType"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return "", nil, fmt.Errorf("decoding statement: %w", err)
+	}
+
+	return statement.PredicateType, statement.Predicate, nil
+}
+
+// printReport writes the report as JSON, returning an error if it has violations.
+func printReport(w io.Writer, report policy.Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("%d policy violations", len(report.Violations))
+	}
+
+	return nil
+}
+
+// setSubcommandHelp gives the subcommand its own help and usage output, as the root command prints the flag sections
+// of the controller.
+func setSubcommandHelp(cmd *cobra.Command) {
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		printUsage(cmd.OutOrStderr(), cmd)
+		return nil
+	})
+
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n", cmd.Long)
+		printUsage(cmd.OutOrStdout(), cmd)
+	})
+}
+
+// printUsage writes the usage line, subcommands and flags of the command.
+func printUsage(w io.Writer, cmd *cobra.Command) {
+	fmt.Fprintf(w, "Usage:\n  %s\n", cmd.UseLine())
+
+	if cmd.HasAvailableSubCommands() {
+		fmt.Fprintf(w, "\nCommands:\n")
+		for _, sub := range cmd.Commands() {
+			if sub.IsAvailableCommand() {
+				fmt.Fprintf(w, "  %-12s %s\n", sub.Name(), sub.Short)
+			}
+		}
+	}
+
+	if cmd.HasAvailableLocalFlags() {
+		fmt.Fprintf(w, "\nFlags:\n%s", cmd.LocalFlags().FlagUsages())
+	}
+}
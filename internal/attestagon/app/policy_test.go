@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+)
+
+func TestReadStatement(t *testing.T) {
+	statement := `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"` + predicate.ProvenanceType +
+		`","subject":[],"predicate":{"processesExecuted":{"/usr/bin/go":1}}}`
+
+	tests := []struct {
+		name     string
+		contents string
+
+		wantPredicate string
+		wantErr       bool
+	}{
+		{
+			name:          "bare statement",
+			contents:      statement,
+			wantPredicate: `{"processesExecuted":{"/usr/bin/go":1}}`,
+		},
+		{
+			name: "DSSE envelope",
+			contents: `{"payloadType":"application/vnd.in-toto+json","payload":"` +
+				base64.StdEncoding.EncodeToString([]byte(statement)) + `","signatures":[]}`,
+			wantPredicate: `{"processesExecuted":{"/usr/bin/go":1}}`,
+		},
+		{
+			name:     "envelope with invalid payload",
+			contents: `{"payload":"not base64!"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "not JSON",
+			contents: "predicateType: " + predicate.ProvenanceType,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "statement.json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			predicateType, pred, err := readStatement(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readStatement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if predicateType != predicate.ProvenanceType {
+				t.Errorf("readStatement() predicate type = %s, want %s", predicateType, predicate.ProvenanceType)
+			}
+			if string(pred) != tt.wantPredicate {
+				t.Errorf("readStatement() predicate = %s, want %s", pred, tt.wantPredicate)
+			}
+		})
+	}
+
+	if _, _, err := readStatement(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("readStatement() read a missing file")
+	}
+}
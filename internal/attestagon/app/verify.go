@@ -0,0 +1,383 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/spf13/cobra"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+)
+
+// verifyOptions are the flags of the verify command.
+type verifyOptions struct {
+	keys           []string
+	identity       cosign.Identity
+	rekorURL       string
+	predicateTypes []string
+	policyPath     string
+	output         string
+	insecure       bool
+
+	// Paths of the PEM encoded trust material replacing that of the public Sigstore instances.
+	rekorPublicKeys    []string
+	fulcioCertificates string
+	ctLogPublicKeys    []string
+	tsaCertificates    string
+
+	summaries summaryOptions
+}
+
+// summaryOptions are the policy and verifier verification summaries must have been written with to be accepted.
+type summaryOptions struct {
+	policyURI  string
+	verifierID string
+}
+
+// verifyResult is the result of the verify command, printed as JSON with --output=json.
+type verifyResult struct {
+	Image        string              `json:"image"`
+	Verified     bool                `json:"verified"`
+	Attestations []attestationResult `json:"attestations"`
+}
+
+// attestationResult is the result of checking a single verified attestation.
+type attestationResult struct {
+	PredicateType string         `json:"predicateType"`
+	Description   string         `json:"description,omitempty"`
+	SchemaError   string         `json:"schemaError,omitempty"`
+	Policy        *policy.Report `json:"policy,omitempty"`
+	Rejection     string         `json:"rejection,omitempty"`
+	Accepted      bool           `json:"accepted"`
+}
+
+// newVerifyCommand returns the command verifying the attestagon attestations of an image. Verification stops when the
+// context is done.
+func newVerifyCommand(ctx context.Context) *cobra.Command {
+	opts := verifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "verify <image>",
+		Short: "Verify the attestagon attestations of an image.",
+		Long: "Verify the signatures of the attestagon attestations attached to an image with the cosign tag scheme or as " +
+			"sigstore bundle referrers, validate their predicates and optionally evaluate policy rules against them. The image is verified if " +
+			"an attestation of an accepted predicate type is valid and passes the rules.",
+		Args: cobra.ExactArgs(1),
+
+		// A failed verification is not a usage error, and main prints the error.
+		SilenceUsage:  true,
+		SilenceErrors: true,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(ctx, cmd.OutOrStdout(), args[0], opts)
+		},
+	}
+	setSubcommandHelp(cmd)
+
+	fs := cmd.Flags()
+	fs.StringSliceVar(&opts.keys, "key", nil,
+		"Path to a PEM encoded public key, or a KMS URI such as awskms:///alias/attestagon, attestations may be signed with. May be repeated.")
+	fs.StringVar(&opts.identity.Issuer, "certificate-oidc-issuer", "",
+		"OIDC issuer of the Fulcio certificate of keyless attestations.")
+	fs.StringVar(&opts.identity.IssuerRegExp, "certificate-oidc-issuer-regexp", "",
+		"Regular expression matching the OIDC issuer of the Fulcio certificate of keyless attestations.")
+	fs.StringVar(&opts.identity.Subject, "certificate-identity", "",
+		"Identity of the Fulcio certificate of keyless attestations.")
+	fs.StringVar(&opts.identity.SubjectRegExp, "certificate-identity-regexp", "",
+		"Regular expression matching the identity of the Fulcio certificate of keyless attestations.")
+	fs.StringVar(&opts.rekorURL, "rekor-url", "",
+		"Address of the Rekor instance attestations must be logged in. If empty, the transparency log is not checked, and keyless verification requires --timestamp-certificate-chain.")
+	fs.StringSliceVar(&opts.rekorPublicKeys, "rekor-public-key", nil,
+		"Path to a PEM encoded public key of the Rekor instance. May be repeated. Defaults to the keys of the public Sigstore Rekor instance.")
+	fs.StringVar(&opts.fulcioCertificates, "fulcio-certificates", "",
+		"Path to the PEM encoded root and intermediate certificates of the Fulcio instance. Defaults to the certificates of the public Sigstore Fulcio instance.")
+	fs.StringSliceVar(&opts.ctLogPublicKeys, "ctlog-public-key", nil,
+		"Path to a PEM encoded public key of the certificate transparency log of the Fulcio instance. May be repeated. If unset with --fulcio-certificates, certificates are not required to have been logged.")
+	fs.StringVar(&opts.tsaCertificates, "timestamp-certificate-chain", "",
+		"Path to the PEM encoded certificate chain of the timestamp authority attestations are timestamped by, leaf first.")
+	fs.StringSliceVar(&opts.predicateTypes, "predicate-type", []string{predicate.ProvenanceType, predicate.AggregateType, predicate.VerificationSummaryType},
+		"Predicate types of the attestations that are accepted.")
+	fs.StringVar(&opts.policyPath, "policy", "",
+		"Path to the YAML file of the policy rules provenance and aggregate attestations must pass.")
+	fs.StringVar(&opts.summaries.policyURI, "vsa-policy-uri", "",
+		"URI of the policy verification summaries must have been verified against. Required with --vsa-verifier-id to accept verification summaries.")
+	fs.StringVar(&opts.summaries.verifierID, "vsa-verifier-id", "",
+		"ID of the verifier verification summaries must have been written by. Required with --vsa-policy-uri to accept verification summaries.")
+	fs.StringVarP(&opts.output, "output", "o", "text",
+		"Output format, text or json.")
+	fs.BoolVar(&opts.insecure, "allow-insecure-registry", false,
+		"Allow the registry to be contacted over plain HTTP.")
+
+	return cmd
+}
+
+// imageOptions returns the options attestations are verified with.
+func (o *verifyOptions) imageOptions(ctx context.Context) (image.VerifyOptions, error) {
+	vopts := image.VerifyOptions{RekorURL: o.rekorURL}
+
+	for _, ref := range o.keys {
+		pub, err := image.LoadPublicKey(ctx, ref)
+		if err != nil {
+			return image.VerifyOptions{}, err
+		}
+		vopts.PublicKeys = append(vopts.PublicKeys, pub)
+	}
+
+	id := o.identity
+	if id != (cosign.Identity{}) {
+		if id.Issuer == "" && id.IssuerRegExp == "" {
+			return image.VerifyOptions{}, errors.New("--certificate-oidc-issuer or --certificate-oidc-issuer-regexp is required for keyless verification")
+		}
+		if id.Subject == "" && id.SubjectRegExp == "" {
+			return image.VerifyOptions{}, errors.New("--certificate-identity or --certificate-identity-regexp is required for keyless verification")
+		}
+		vopts.Identities = append(vopts.Identities, id)
+	}
+
+	if len(vopts.PublicKeys) == 0 && len(vopts.Identities) == 0 {
+		return image.VerifyOptions{}, errors.New("--key or a certificate identity is required")
+	}
+
+	for _, path := range o.rekorPublicKeys {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return image.VerifyOptions{}, fmt.Errorf("reading rekor public key: %w", err)
+		}
+		vopts.RekorPublicKeys = append(vopts.RekorPublicKeys, key)
+	}
+	for _, path := range o.ctLogPublicKeys {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return image.VerifyOptions{}, fmt.Errorf("reading ct log public key: %w", err)
+		}
+		vopts.CTLogPublicKeys = append(vopts.CTLogPublicKeys, key)
+	}
+	if o.fulcioCertificates != "" {
+		certs, err := os.ReadFile(o.fulcioCertificates)
+		if err != nil {
+			return image.VerifyOptions{}, fmt.Errorf("reading fulcio certificates: %w", err)
+		}
+		vopts.FulcioCertificates = certs
+	}
+	if o.tsaCertificates != "" {
+		certs, err := os.ReadFile(o.tsaCertificates)
+		if err != nil {
+			return image.VerifyOptions{}, fmt.Errorf("reading timestamp certificate chain: %w", err)
+		}
+		vopts.TSACertificateChain = certs
+	}
+
+	if err := vopts.Validate(); err != nil {
+		return image.VerifyOptions{}, err
+	}
+
+	return vopts, nil
+}
+
+// runVerify verifies the attestations of the image and prints the result, returning an error unless the image is
+// verified.
+func runVerify(ctx context.Context, w io.Writer, img string, opts verifyOptions) error {
+	if opts.output != "text" && opts.output != "json" {
+		return fmt.Errorf("unsupported output format %q, must be text or json", opts.output)
+	}
+
+	vopts, err := opts.imageOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var engine *policy.Engine
+	if opts.policyPath != "" {
+		raw, err := os.ReadFile(opts.policyPath)
+		if err != nil {
+			return fmt.Errorf("reading policy: %w", err)
+		}
+
+		rules, err := policy.ParseRules(raw)
+		if err != nil {
+			return fmt.Errorf("parsing policy: %w", err)
+		}
+
+		engine, err = policy.NewEngine(rules)
+		if err != nil {
+			return fmt.Errorf("invalid policy: %w", err)
+		}
+	}
+
+	ropts := image.RemoteOptions{Insecure: opts.insecure}
+
+	digest, err := image.ResolveDigest(ctx, img, ropts)
+	if err != nil {
+		return fmt.Errorf("resolving digest: %w", err)
+	}
+
+	statements, err := image.VerifyAttestations(ctx, digest, vopts, ropts)
+	if err != nil {
+		return err
+	}
+
+	result := verifyResult{Image: digest.String()}
+	for _, statement := range statements {
+		att := checkAttestation(statement, engine, opts.summaries)
+		att.Accepted = att.Accepted && slices.Contains(opts.predicateTypes, statement.PredicateType)
+		result.Verified = result.Verified || att.Accepted
+		result.Attestations = append(result.Attestations, att)
+	}
+
+	if opts.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		printVerifyResult(w, result)
+	}
+
+	if !result.Verified {
+		return fmt.Errorf("no accepted attestation for %s", result.Image)
+	}
+
+	return nil
+}
+
+// checkAttestation validates the predicate of the verified statement and evaluates the rules of the engine against it,
+// if any. The attestation is accepted if its predicate is valid and passes, ignoring whether its type is accepted. A
+// verification summary is accepted if it passed the configured policy and was written by the configured verifier.
+func checkAttestation(statement image.VerifiedStatement, engine *policy.Engine, summaries summaryOptions) attestationResult {
+	att := attestationResult{PredicateType: statement.PredicateType}
+
+	if err := predicate.Validate(statement.PredicateType, statement.Predicate); err != nil {
+		att.SchemaError = err.Error()
+		return att
+	}
+	att.Description = describePredicate(statement.PredicateType, statement.Predicate)
+
+	switch statement.PredicateType {
+	case predicate.FailedBuildType:
+		return att
+
+	case predicate.VerificationSummaryType:
+		var summary predicate.VerificationSummary
+		if err := json.Unmarshal(statement.Predicate, &summary); err != nil {
+			att.SchemaError = err.Error()
+			return att
+		}
+
+		// With a policy, only summaries of the same rules are accepted.
+		switch {
+		case summaries.policyURI == "" || summaries.verifierID == "":
+			att.Rejection = "--vsa-policy-uri and --vsa-verifier-id are required to accept verification summaries"
+		case summary.Verifier.ID != summaries.verifierID:
+			att.Rejection = fmt.Sprintf("written by unexpected verifier %s", summary.Verifier.ID)
+		case summary.Policy.URI != summaries.policyURI:
+			att.Rejection = fmt.Sprintf("verified against unexpected policy %s", summary.Policy.URI)
+		case engine != nil && summary.Policy.Digest["sha256"] != engine.Digest():
+			att.Rejection = fmt.Sprintf("verified against policy %s with a digest other than the rules of --policy", summary.Policy.URI)
+		case summary.VerificationResult != predicate.VerificationPassed:
+			att.Rejection = fmt.Sprintf("result is %s", summary.VerificationResult)
+		default:
+			att.Accepted = true
+		}
+		return att
+	}
+
+	if engine != nil {
+		report, err := engine.EvaluateStatement(statement.PredicateType, statement.Predicate)
+		if err != nil {
+			att.SchemaError = err.Error()
+			return att
+		}
+		att.Policy = &report
+		att.Accepted = report.Passed()
+		return att
+	}
+
+	att.Accepted = true
+	return att
+}
+
+// describePredicate returns a short description of what a valid predicate is about.
+func describePredicate(predicateType string, raw json.RawMessage) string {
+	switch predicateType {
+	case predicate.ProvenanceType, predicate.FailedBuildType:
+		var p predicate.Predicate
+		if json.Unmarshal(raw, &p) != nil {
+			return ""
+		}
+		desc := fmt.Sprintf("pod %s/%s, %d processes, %d TCP connections", p.Pod.Namespace, p.Pod.Name, len(p.ProcessesExecuted), len(p.TCPConnections))
+		if p.Outcome != nil {
+			desc += fmt.Sprintf(", %s", p.Outcome.Phase)
+		}
+		return desc
+
+	case predicate.AggregateType:
+		var a predicate.Aggregate
+		if json.Unmarshal(raw, &a) != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s %s/%s, %d pods", a.Owner.Kind, a.Owner.Namespace, a.Owner.Name, len(a.Pods))
+
+	case predicate.VerificationSummaryType:
+		var s predicate.VerificationSummary
+		if json.Unmarshal(raw, &s) != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s against policy %s by %s", s.VerificationResult, s.Policy.URI, s.Verifier.ID)
+	}
+
+	return ""
+}
+
+// printVerifyResult writes the result in a human-readable form.
+func printVerifyResult(w io.Writer, result verifyResult) {
+	fmt.Fprintf(w, "Image: %s\n", result.Image)
+
+	for i, att := range result.Attestations {
+		fmt.Fprintf(w, "\nAttestation %d: %s\n", i+1, att.PredicateType)
+		if att.Description != "" {
+			fmt.Fprintf(w, "  %s\n", att.Description)
+		}
+
+		if att.SchemaError != "" {
+			fmt.Fprintf(w, "  Schema: invalid, %s\n", att.SchemaError)
+		} else {
+			fmt.Fprintf(w, "  Schema: valid\n")
+		}
+
+		if att.Policy != nil {
+			if att.Policy.Passed() {
+				fmt.Fprintf(w, "  Policy: passed\n")
+			} else {
+				fmt.Fprintf(w, "  Policy: %d violations\n", len(att.Policy.Violations))
+				for _, v := range att.Policy.Violations {
+					fmt.Fprintf(w, "    - %s\n", v)
+				}
+			}
+		}
+
+		if att.Rejection != "" {
+			fmt.Fprintf(w, "  Rejected: %s\n", att.Rejection)
+		}
+
+		fmt.Fprintf(w, "  Accepted: %s\n", yesNo(att.Accepted))
+	}
+
+	fmt.Fprintf(w, "\nVerified: %s\n", yesNo(result.Verified))
+}
+
+// yesNo formats the boolean for the human-readable output.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
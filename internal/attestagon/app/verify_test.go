@@ -0,0 +1,339 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+)
+
+// mustMarshal returns the JSON encoding of the value.
+func mustMarshal(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestCheckAttestation(t *testing.T) {
+	rules := policy.Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}}
+	engine, err := policy.NewEngine(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := summaryOptions{policyURI: "https://example.com/policy.yaml", verifierID: "https://example.com/verifier"}
+	summary := func(verifierID, policyURI, digest, result string) image.VerifiedStatement {
+		return image.VerifiedStatement{
+			PredicateType: predicate.VerificationSummaryType,
+			Predicate: mustMarshal(t, predicate.VerificationSummary{
+				Verifier:           predicate.Verifier{ID: verifierID},
+				Policy:             predicate.ResourceDescriptor{URI: policyURI, Digest: map[string]string{"sha256": digest}},
+				VerificationResult: result,
+			}),
+		}
+	}
+	provenance := func(p predicate.Predicate) image.VerifiedStatement {
+		return image.VerifiedStatement{PredicateType: predicate.ProvenanceType, Predicate: mustMarshal(t, p)}
+	}
+
+	build := predicate.Predicate{Pod: predicate.Pod{Name: "build", Namespace: "builds"}, ProcessesExecuted: map[string]int{"/usr/bin/go": 1}}
+	curl := predicate.Predicate{Pod: predicate.Pod{Name: "build", Namespace: "builds"}, ProcessesExecuted: map[string]int{"/usr/bin/curl": 1}}
+
+	tests := []struct {
+		name      string
+		statement image.VerifiedStatement
+		engine    *policy.Engine
+		summaries summaryOptions
+
+		wantAccepted    bool
+		wantRejection   string
+		wantSchemaError bool
+		wantViolations  int
+	}{
+		{
+			name:         "provenance without policy",
+			statement:    provenance(curl),
+			wantAccepted: true,
+		},
+		{
+			name:         "provenance passing the policy",
+			statement:    provenance(build),
+			engine:       engine,
+			wantAccepted: true,
+		},
+		{
+			name:           "provenance violating the policy",
+			statement:      provenance(curl),
+			engine:         engine,
+			wantViolations: 1,
+		},
+		{
+			name: "failed build",
+			statement: image.VerifiedStatement{
+				PredicateType: predicate.FailedBuildType,
+				Predicate:     mustMarshal(t, predicate.Predicate{Outcome: &predicate.Outcome{Phase: "Failed"}}),
+			},
+		},
+		{
+			name:            "invalid predicate",
+			statement:       image.VerifiedStatement{PredicateType: predicate.ProvenanceType, Predicate: json.RawMessage(`{"unknown": true}`)},
+			wantSchemaError: true,
+		},
+		{
+			name:            "unknown predicate type",
+			statement:       image.VerifiedStatement{PredicateType: "https://slsa.dev/provenance/v1", Predicate: json.RawMessage(`{}`)},
+			wantSchemaError: true,
+		},
+		{
+			name:         "passed summary",
+			statement:    summary(summaries.verifierID, summaries.policyURI, engine.Digest(), predicate.VerificationPassed),
+			engine:       engine,
+			summaries:    summaries,
+			wantAccepted: true,
+		},
+		{
+			name:         "passed summary without policy",
+			statement:    summary(summaries.verifierID, summaries.policyURI, "0000", predicate.VerificationPassed),
+			summaries:    summaries,
+			wantAccepted: true,
+		},
+		{
+			name:          "summary without --vsa-policy-uri",
+			statement:     summary(summaries.verifierID, summaries.policyURI, engine.Digest(), predicate.VerificationPassed),
+			summaries:     summaryOptions{verifierID: summaries.verifierID},
+			wantRejection: "--vsa-policy-uri and --vsa-verifier-id are required to accept verification summaries",
+		},
+		{
+			name:          "summary without --vsa-verifier-id",
+			statement:     summary(summaries.verifierID, summaries.policyURI, engine.Digest(), predicate.VerificationPassed),
+			summaries:     summaryOptions{policyURI: summaries.policyURI},
+			wantRejection: "--vsa-policy-uri and --vsa-verifier-id are required to accept verification summaries",
+		},
+		{
+			name:          "summary of another verifier",
+			statement:     summary("https://example.com/other", summaries.policyURI, engine.Digest(), predicate.VerificationPassed),
+			summaries:     summaries,
+			wantRejection: "written by unexpected verifier https://example.com/other",
+		},
+		{
+			name:          "summary of another policy",
+			statement:     summary(summaries.verifierID, "https://example.com/other.yaml", engine.Digest(), predicate.VerificationPassed),
+			summaries:     summaries,
+			wantRejection: "verified against unexpected policy https://example.com/other.yaml",
+		},
+		{
+			name:          "summary of other rules than --policy",
+			statement:     summary(summaries.verifierID, summaries.policyURI, "0000", predicate.VerificationPassed),
+			engine:        engine,
+			summaries:     summaries,
+			wantRejection: "verified against policy https://example.com/policy.yaml with a digest other than the rules of --policy",
+		},
+		{
+			name:          "failed summary",
+			statement:     summary(summaries.verifierID, summaries.policyURI, engine.Digest(), predicate.VerificationFailed),
+			engine:        engine,
+			summaries:     summaries,
+			wantRejection: "result is FAILED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att := checkAttestation(tt.statement, tt.engine, tt.summaries)
+			if att.Accepted != tt.wantAccepted {
+				t.Errorf("checkAttestation() accepted = %t, want %t", att.Accepted, tt.wantAccepted)
+			}
+			if att.Rejection != tt.wantRejection {
+				t.Errorf("checkAttestation() rejection = %q, want %q", att.Rejection, tt.wantRejection)
+			}
+			if (att.SchemaError != "") != tt.wantSchemaError {
+				t.Errorf("checkAttestation() schema error = %q, wantSchemaError %t", att.SchemaError, tt.wantSchemaError)
+			}
+
+			violations := 0
+			if att.Policy != nil {
+				violations = len(att.Policy.Violations)
+			}
+			if violations != tt.wantViolations {
+				t.Errorf("checkAttestation() violations = %d, want %d", violations, tt.wantViolations)
+			}
+		})
+	}
+}
+
+// testImage starts an in-process registry, pushes a random image to it and attaches a provenance attestation of the
+// predicate signed with a new key, returning the digest reference of the image and the path of the PEM encoded public
+// key.
+func testImage(t *testing.T, p predicate.Predicate) (name.Digest, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/test/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := ref.Context().Digest(h.String())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := signature.LoadECDSASignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement := in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          in_toto.StatementInTotoV01,
+			PredicateType: predicate.ProvenanceType,
+			Subject:       []in_toto.Subject{{Name: digest.Context().Name(), Digest: common.DigestSet{"sha256": h.Hex}}},
+		},
+		Predicate: p,
+	}
+	att, err := image.Sign(ctx, statement, image.SignerOptions{Key: sv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := image.Push(ctx, att, digest, image.RemoteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := cryptoutils.MarshalPublicKeyToPEM(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(keyPath, pub, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return digest, keyPath
+}
+
+func TestRunVerify(t *testing.T) {
+	digest, keyPath := testImage(t, predicate.Predicate{
+		Pod:               predicate.Pod{Name: "build", Namespace: "builds"},
+		ProcessesExecuted: map[string]int{"/usr/bin/go": 1},
+	})
+
+	writePolicy := func(rules string) string {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	passing := writePolicy("forbiddenProcesses: [/usr/bin/curl]\n")
+	violated := writePolicy("forbiddenProcesses: [/usr/bin/go]\n")
+
+	tests := []struct {
+		name string
+		opts verifyOptions
+
+		wantErr string
+	}{
+		{
+			name: "accepted provenance",
+			opts: verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.ProvenanceType}, output: "json"},
+		},
+		{
+			name: "provenance passing the policy",
+			opts: verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.ProvenanceType}, policyPath: passing, output: "text"},
+		},
+		{
+			name:    "provenance violating the policy",
+			opts:    verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.ProvenanceType}, policyPath: violated, output: "text"},
+			wantErr: "no accepted attestation",
+		},
+		{
+			name:    "rejected predicate type passing the policy",
+			opts:    verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.AggregateType}, policyPath: passing, output: "json"},
+			wantErr: "no accepted attestation",
+		},
+		{
+			name:    "unsupported output format",
+			opts:    verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.ProvenanceType}, output: "yaml"},
+			wantErr: "unsupported output format",
+		},
+		{
+			name:    "no key or identity",
+			opts:    verifyOptions{predicateTypes: []string{predicate.ProvenanceType}, output: "text"},
+			wantErr: "--key or a certificate identity is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runVerify(context.Background(), &out, digest.String(), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runVerify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runVerify() error = %v\n%s", err, out.String())
+			}
+		})
+	}
+
+	// The JSON output reports the checked attestation.
+	var out bytes.Buffer
+	opts := verifyOptions{keys: []string{keyPath}, predicateTypes: []string{predicate.AggregateType}, policyPath: passing, output: "json"}
+	_ = runVerify(context.Background(), &out, digest.String(), opts)
+
+	var result verifyResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("decoding output: %v\n%s", err, out.String())
+	}
+	if result.Verified || len(result.Attestations) != 1 {
+		t.Fatalf("runVerify() result = %+v, want a single unaccepted attestation", result)
+	}
+	att := result.Attestations[0]
+	if att.Accepted || att.Policy == nil || !att.Policy.Passed() {
+		t.Errorf("runVerify() attestation = %+v, want an unaccepted attestation passing the policy", att)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
@@ -18,8 +19,13 @@ type EventCache struct {
 	ctx          context.Context
 	log          logr.Logger
 	clientConfig *tetragon.GrpcClientConfig
-	filter       *tetragonv1.Filter
 	Store        map[string]*predicate.Predicate
+
+	// mu guards filter and cancelStream.
+	mu     sync.Mutex
+	filter *tetragonv1.Filter
+	// cancelStream cancels the current event stream, which is reopened with the current filter.
+	cancelStream context.CancelFunc
 }
 
 func New(ctx context.Context, log logr.Logger, tlsConfig options.TLSConfig, tetragonAddr string, podFilter *tetragonv1.Filter) (*EventCache, error) {
@@ -56,11 +62,6 @@ func (c *EventCache) Start() error {
 
 	client := tetragonv1.NewFineGuidanceSensorsClient(conn)
 
-	stream, err := getEventStream(c.ctx, client, c.filter)
-	if err != nil {
-		c.log.Error(err, "Failed to get tetragon events: ")
-	}
-
 	errCh := make(chan error)
 	done := make(chan struct{})
 	go func() {
@@ -72,6 +73,55 @@ func (c *EventCache) Start() error {
 		}
 	}()
 
+	for {
+		streamCtx, stream, err := c.eventStream(client)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to get tetragon events"), err)
+		}
+
+		err = c.receive(stream, errCh, done)
+
+		// The stream is cancelled when the filter is updated, in which case it is reopened. The cached events are kept.
+		if streamCtx.Err() != nil && c.ctx.Err() == nil {
+			c.log.Info("Pod filter updated, reopening tetragon event stream")
+			continue
+		}
+
+		return err
+	}
+}
+
+// SetFilter replaces the filter of the tetragon event stream, reopening the stream with the new filter without
+// dropping the cached events.
+func (c *EventCache) SetFilter(filter *tetragonv1.Filter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filter = filter
+	if c.cancelStream != nil {
+		c.cancelStream()
+	}
+}
+
+// eventStream opens a tetragon event stream with the current filter.
+func (c *EventCache) eventStream(client tetragonv1.FineGuidanceSensorsClient) (context.Context, tetragonv1.FineGuidanceSensors_GetEventsClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.cancelStream = cancel
+
+	stream, err := getEventStream(ctx, client, c.filter)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	return ctx, stream, nil
+}
+
+// receive adds the events of the stream to the cache until the stream or the garbage collector fails.
+func (c *EventCache) receive(stream tetragonv1.FineGuidanceSensors_GetEventsClient, errCh <-chan error, done <-chan struct{}) error {
 	for {
 		select {
 		case err := <-errCh:
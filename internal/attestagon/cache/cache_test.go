@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	tetragonv1 "github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+)
+
+// sensors is a tetragon server that sends the filter of every event stream that is opened and keeps the stream open
+// until the client cancels it.
+type sensors struct {
+	tetragonv1.UnimplementedFineGuidanceSensorsServer
+	filters chan *tetragonv1.Filter
+}
+
+func (s *sensors) GetEvents(request *tetragonv1.GetEventsRequest, stream tetragonv1.FineGuidanceSensors_GetEventsServer) error {
+	var filter *tetragonv1.Filter
+	if len(request.AllowList) > 0 {
+		filter = request.AllowList[0]
+	}
+	s.filters <- filter
+
+	<-stream.Context().Done()
+	return nil
+}
+
+// nextFilter returns the filter of the next event stream opened on the server.
+func (s *sensors) nextFilter(t *testing.T) *tetragonv1.Filter {
+	t.Helper()
+
+	select {
+	case filter := <-s.filters:
+		return filter
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event stream was opened")
+		return nil
+	}
+}
+
+// sameFilter returns whether the filters select the same namespaces and binaries.
+func sameFilter(a, b *tetragonv1.Filter) bool {
+	return reflect.DeepEqual(a.GetNamespace(), b.GetNamespace()) && reflect.DeepEqual(a.GetBinaryRegex(), b.GetBinaryRegex())
+}
+
+func TestSetFilter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	s := &sensors{filters: make(chan *tetragonv1.Filter, 2)}
+	tetragonv1.RegisterFineGuidanceSensorsServer(srv, s)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	initial := &tetragonv1.Filter{Namespace: []string{"builds"}}
+	c, err := New(ctx, logr.Discard(), options.TLSConfig{}, lis.Addr().String(), initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Store["build"] = &predicate.Predicate{Pod: predicate.Pod{Name: "build", Namespace: "builds"}}
+
+	go c.Start()
+
+	if got := s.nextFilter(t); !sameFilter(got, initial) {
+		t.Fatalf("event stream opened with filter %v, want %v", got, initial)
+	}
+
+	updated := &tetragonv1.Filter{Namespace: []string{"builds", "releases"}, BinaryRegex: []string{"kaniko"}}
+	c.SetFilter(updated)
+
+	if got := s.nextFilter(t); !sameFilter(got, updated) {
+		t.Fatalf("event stream reopened with filter %v, want %v", got, updated)
+	}
+	if _, ok := c.Store["build"]; !ok {
+		t.Error("cached events were dropped when the filter was updated")
+	}
+}
@@ -0,0 +1,595 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	attestagonv1alpha1 "github.com/chaosinthecrd/attestagon/pkg/apis/attestagon/v1alpha1"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// aggregateInterval is how often the owners of collected pods are checked for completion.
+	aggregateInterval = 15 * time.Second
+
+	// maxOwnerDepth is the maximum number of controller owners followed from a pod to its aggregate owner.
+	maxOwnerDepth = 5
+
+	// aggregatedTTL is how long finished aggregates are remembered, which must be long enough for their pods to be
+	// released.
+	aggregatedTTL = time.Hour
+
+	// ownerUIDLabel is the label of Attestation resources recording the UID of the owner of an aggregate attestation.
+	ownerUIDLabel = "attestagon.io/owner-uid"
+)
+
+// aggregateKinds are the kinds of owners pods can be aggregated by.
+var aggregateKinds = map[string]bool{
+	"TaskRun":     true,
+	"PipelineRun": true,
+	"Job":         true,
+	"Workflow":    true,
+}
+
+// AggregateConfig configures the aggregation of the pods building an artifact into one attestation per owner.
+type AggregateConfig struct {
+	// Kind is the kind of the owner pods are aggregated by, one of TaskRun, PipelineRun, Job or Workflow.
+	Kind string `yaml:"kind"`
+}
+
+// validate returns an error if the aggregation is not valid.
+func (a *AggregateConfig) validate() error {
+	if a == nil {
+		return nil
+	}
+
+	if !aggregateKinds[a.Kind] {
+		return fmt.Errorf("unsupported aggregate kind %q, must be one of TaskRun, PipelineRun, Job or Workflow", a.Kind)
+	}
+
+	return nil
+}
+
+// aggregate collects the pods owned by an object until the object completes. Pods are collected by reconcilers while
+// the aggregate is processed, so every field other than art, owner and createdAt is guarded by the aggregatesMu of the
+// controller.
+type aggregate struct {
+	art   *Artifact
+	owner predicate.Owner
+
+	// createdAt is when the first pod was collected.
+	createdAt time.Time
+
+	// finishedAt is when the owner was first seen completed.
+	finishedAt time.Time
+
+	// pods are the predicates of the collected pods, in the order they were collected.
+	pods []predicate.Predicate
+
+	// podUIDs are the UIDs of the collected pods, so that a pod is only collected once.
+	podUIDs map[types.UID]bool
+
+	// subjects are the subjects resolved from the collected pods.
+	subjects []subject.Subject
+
+	// pod is the last collected pod. Its credentials are used for the registry and its name for the Attestation.
+	pod *corev1.Pod
+
+	// written are the locations the attestation has been written to keyed by sink name.
+	written map[string]string
+
+	// writtenSummary are the locations the verification summary has been written to keyed by sink name.
+	writtenSummary map[string]string
+}
+
+// collectAggregates collects the completed pod into the aggregates of the artifacts that are aggregated by an owner
+// of the pod, and returns the artifacts that are attested for the pod itself. It also returns whether the pod is in an
+// aggregate that is not finished with yet, in which case the pod must not be released.
+func (c *Controller) collectAggregates(ctx context.Context, pod *corev1.Pod, arts []*Artifact) ([]*Artifact, bool, error) {
+	completed := pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+
+	var direct []*Artifact
+	var pending bool
+	for _, art := range arts {
+		if art.Aggregate == nil {
+			direct = append(direct, art)
+			continue
+		}
+
+		if !completed {
+			continue
+		}
+
+		owner, err := c.aggregateOwner(ctx, pod, art.Aggregate.Kind)
+		if err != nil {
+			return nil, false, err
+		}
+		if owner == nil {
+			c.log.Info("Pod is not owned by the aggregate kind of the artifact, skipping", "pod_name", pod.Name, "artifact", art.Name, "kind", art.Aggregate.Kind)
+			continue
+		}
+
+		if c.collectPod(ctx, pod, art, owner) {
+			pending = true
+		}
+	}
+
+	return direct, pending, nil
+}
+
+// collectPod adds the predicate and subjects of the pod to the aggregate of the artifact for the owner. It returns
+// false if the aggregate has already been finished with, in which case the pod is not collected.
+func (c *Controller) collectPod(ctx context.Context, pod *corev1.Pod, art *Artifact, owner *unstructured.Unstructured) bool {
+	key := fmt.Sprintf("%s/%s", owner.GetUID(), art.Name)
+
+	c.aggregatesMu.Lock()
+	_, finished := c.aggregated[key]
+	collected := c.aggregates[key] != nil && c.aggregates[key].podUIDs[pod.UID]
+	c.aggregatesMu.Unlock()
+
+	if finished {
+		c.log.Info("Aggregate of pod was already finished with, releasing pod", "pod_name", pod.Name, "artifact", art.Name, "owner_kind", owner.GetKind(), "owner_name", owner.GetName())
+		return false
+	}
+	if collected {
+		return true
+	}
+
+	var pred predicate.Predicate
+	if cached := c.eventCache.Store[pod.Name]; cached != nil {
+		pred = *cached
+	}
+	outcome := predicate.OutcomeFromPod(pod)
+	pred.Outcome = &outcome
+
+	subjects, err := c.resolveSubjects(ctx, pod, art)
+	if err != nil && !errors.Is(err, subject.ErrNotFound) {
+		c.log.Error(err, "Failed to resolve subjects of aggregated pod", "pod_name", pod.Name, "artifact", art.Name)
+	}
+
+	c.aggregatesMu.Lock()
+	defer c.aggregatesMu.Unlock()
+
+	agg, ok := c.aggregates[key]
+	if !ok {
+		agg = &aggregate{
+			art: art,
+			owner: predicate.Owner{
+				APIVersion: owner.GetAPIVersion(),
+				Kind:       owner.GetKind(),
+				Namespace:  owner.GetNamespace(),
+				Name:       owner.GetName(),
+				UID:        owner.GetUID(),
+			},
+			createdAt: time.Now(),
+			podUIDs:   make(map[types.UID]bool),
+		}
+		c.aggregates[key] = agg
+	}
+
+	if agg.podUIDs[pod.UID] {
+		return true
+	}
+	agg.podUIDs[pod.UID] = true
+	agg.pods = append(agg.pods, pred)
+	agg.subjects = append(agg.subjects, subjects...)
+	agg.pod = pod.DeepCopy()
+
+	c.log.Info("Collected pod for aggregate attestation", "pod_name", pod.Name, "artifact", art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name)
+
+	return true
+}
+
+// aggregateOwner follows the controller owners of the pod up to the owner of the given kind. It returns nil if the pod
+// is not owned by an object of that kind.
+func (c *Controller) aggregateOwner(ctx context.Context, pod *corev1.Pod, kind string) (*unstructured.Unstructured, error) {
+	refs := pod.OwnerReferences
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		var ref *metav1.OwnerReference
+		for i := range refs {
+			if refs[i].Controller != nil && *refs[i].Controller {
+				ref = &refs[i]
+				break
+			}
+		}
+		if ref == nil {
+			return nil, nil
+		}
+
+		owner := &unstructured.Unstructured{}
+		owner.SetAPIVersion(ref.APIVersion)
+		owner.SetKind(ref.Kind)
+		err := c.client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, owner)
+		if apierrors.IsNotFound(err) {
+			// The pod is released when its owner is deleted, as there is nothing left to aggregate it into.
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting owner %s %s/%s: %w", ref.Kind, pod.Namespace, ref.Name, err)
+		}
+
+		if owner.GetKind() == kind {
+			return owner, nil
+		}
+		refs = owner.GetOwnerReferences()
+	}
+
+	return nil, nil
+}
+
+// runAggregates periodically attests the aggregates whose owner completed. It only runs on the elected leader.
+func (c *Controller) runAggregates(ctx context.Context) error {
+	ticker := time.NewTicker(aggregateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.processAggregates(ctx)
+		}
+	}
+}
+
+// processAggregates attests every aggregate whose owner completed. Aggregates that fail are retried until the give up
+// period has passed since their owner completed. Aggregates that are finished with are remembered for aggregatedTTL, and
+// their pods are released the next time they are reconciled.
+func (c *Controller) processAggregates(ctx context.Context) {
+	c.aggregatesMu.Lock()
+	pending := make(map[string]*aggregate, len(c.aggregates))
+	for k, agg := range c.aggregates {
+		pending[k] = agg
+	}
+	for k, finishedAt := range c.aggregated {
+		if time.Since(finishedAt) > aggregatedTTL {
+			delete(c.aggregated, k)
+		}
+	}
+	c.aggregatesMu.Unlock()
+
+	for key, agg := range pending {
+		done, err := c.processAggregate(ctx, agg)
+		if err != nil {
+			c.log.Error(err, "Failed to attest aggregate", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name)
+
+			c.aggregatesMu.Lock()
+			finishedAt := agg.finishedAt
+			c.aggregatesMu.Unlock()
+
+			if !finishedAt.IsZero() && time.Since(finishedAt) > c.giveUpPeriod {
+				c.log.Info("Giving up attesting aggregate", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name)
+				done = true
+			}
+		}
+
+		if done {
+			c.aggregatesMu.Lock()
+			delete(c.aggregates, key)
+			c.aggregated[key] = time.Now()
+			c.aggregatesMu.Unlock()
+		}
+	}
+}
+
+// processAggregate attests the aggregate if its owner completed and every pod of the owner building the artifact has
+// been collected, returning true once the aggregate is finished with. Pods that are not collected within the give up
+// period after the owner completed are left out of the attestation.
+func (c *Controller) processAggregate(ctx context.Context, agg *aggregate) (bool, error) {
+	owner := &unstructured.Unstructured{}
+	owner.SetAPIVersion(agg.owner.APIVersion)
+	owner.SetKind(agg.owner.Kind)
+	err := c.client.Get(ctx, types.NamespacedName{Namespace: agg.owner.Namespace, Name: agg.owner.Name}, owner)
+	if apierrors.IsNotFound(err) {
+		c.log.Info("Owner of aggregate was deleted, dropping it", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	completed, failed := ownerCompletion(owner)
+	if !completed {
+		return false, nil
+	}
+	c.aggregatesMu.Lock()
+	if agg.finishedAt.IsZero() {
+		agg.finishedAt = time.Now()
+	}
+	finishedAt := agg.finishedAt
+	c.aggregatesMu.Unlock()
+
+	if failed && !agg.art.attestFailed() {
+		return true, nil
+	}
+
+	// The aggregate may have been attested before the controller restarted, with some of its pods not yet released.
+	attested, err := c.aggregateAttested(ctx, agg)
+	if err != nil {
+		return false, err
+	}
+	if attested {
+		c.log.Info("Aggregate was already attested", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name)
+		return true, nil
+	}
+
+	uncollected, err := c.uncollectedPods(ctx, agg)
+	if err != nil {
+		return false, err
+	}
+	if uncollected > 0 {
+		if time.Since(finishedAt) < c.giveUpPeriod {
+			return false, nil
+		}
+		c.log.Info("Attesting aggregate without pods that were not collected", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name, "pods", uncollected)
+	}
+
+	ref := &corev1.ObjectReference{
+		APIVersion: agg.owner.APIVersion,
+		Kind:       agg.owner.Kind,
+		Namespace:  agg.owner.Namespace,
+		Name:       agg.owner.Name,
+		UID:        agg.owner.UID,
+	}
+
+	result, err := c.attestAggregate(ctx, agg, ownerResults(owner), failed)
+	c.aggregatesMu.Lock()
+	if result != nil && len(result.locations) > 0 {
+		agg.written = result.locations
+	}
+	if result != nil && result.summary != nil && len(result.summary.locations) > 0 {
+		agg.writtenSummary = result.summary.locations
+	}
+	c.aggregatesMu.Unlock()
+
+	switch {
+	case errors.Is(err, subject.ErrNotFound):
+		c.objectEvent(ref, corev1.EventTypeWarning, eventSubjectNotFound, "No subject of artifact %s found: %v", agg.art.Name, err)
+		return false, err
+	case err != nil:
+		c.objectEvent(ref, corev1.EventTypeWarning, eventAttestationFailed, "Failed to attest artifact %s: %v", agg.art.Name, err)
+		return false, err
+	}
+
+	c.objectEvent(ref, corev1.EventTypeNormal, eventAttestationCreated, "Attestation sha256:%s of artifact %s with predicate type %s written to %s",
+		result.statementDigest, agg.art.Name, result.predicateType, strings.Join(result.locationList(), ", "))
+	if result.summary != nil {
+		c.objectEvent(ref, corev1.EventTypeNormal, eventAttestationCreated, "%s", summaryEvent(agg.art.Name, result.summary))
+	}
+
+	return true, nil
+}
+
+// uncollectedPods returns the number of pods of the owner of the aggregate that build its artifact but have not been
+// collected or released yet.
+func (c *Controller) uncollectedPods(ctx context.Context, agg *aggregate) (int, error) {
+	var pods corev1.PodList
+	if err := c.cache.List(ctx, &pods, runtimeclient.InNamespace(agg.owner.Namespace), ownerPodLabels(agg.owner)); err != nil {
+		return 0, fmt.Errorf("listing pods of %s %s/%s: %w", agg.owner.Kind, agg.owner.Namespace, agg.owner.Name, err)
+	}
+
+	c.aggregatesMu.Lock()
+	collected := make(map[types.UID]bool, len(agg.podUIDs))
+	for uid := range agg.podUIDs {
+		collected[uid] = true
+	}
+	c.aggregatesMu.Unlock()
+
+	var uncollected int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if collected[pod.UID] || pod.Annotations[attestedAnnotation] == "true" {
+			continue
+		}
+
+		arts, err := c.podArtifacts(ctx, pod)
+		if err != nil {
+			return 0, err
+		}
+		if slices.ContainsFunc(arts, func(art *Artifact) bool { return art.Name == agg.art.Name }) {
+			uncollected++
+		}
+	}
+
+	return uncollected, nil
+}
+
+// ownerPodLabels returns the labels the controller of the owner sets on its pods.
+func ownerPodLabels(owner predicate.Owner) runtimeclient.MatchingLabels {
+	switch owner.Kind {
+	case "TaskRun":
+		return runtimeclient.MatchingLabels{"tekton.dev/taskRun": owner.Name}
+	case "PipelineRun":
+		return runtimeclient.MatchingLabels{"tekton.dev/pipelineRun": owner.Name}
+	case "Job":
+		return runtimeclient.MatchingLabels{"controller-uid": string(owner.UID)}
+	case "Workflow":
+		return runtimeclient.MatchingLabels{"workflows.argoproj.io/workflow": owner.Name}
+	}
+
+	return runtimeclient.MatchingLabels{}
+}
+
+// aggregateAttested returns whether an Attestation resource records that the attestation of the aggregate was written to
+// every sink. If the Attestation CRD is not installed, aggregates are never known to be attested.
+func (c *Controller) aggregateAttested(ctx context.Context, agg *aggregate) (bool, error) {
+	var records attestagonv1alpha1.AttestationList
+	err := c.cache.List(ctx, &records, runtimeclient.InNamespace(agg.owner.Namespace), runtimeclient.MatchingLabels{ownerUIDLabel: string(agg.owner.UID)})
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("listing attestations of %s %s/%s: %w", agg.owner.Kind, agg.owner.Namespace, agg.owner.Name, err)
+	}
+
+	for _, record := range records.Items {
+		if record.Spec.Artifact == agg.art.Name && record.Spec.PredicateType != predicate.VerificationSummaryType &&
+			meta.IsStatusConditionTrue(record.Status.Conditions, attestagonv1alpha1.ConditionWritten) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// attestAggregate signs and writes one attestation combining every pod of the aggregate. The subjects are read from
+// the results of the owner, falling back to the subjects resolved from the pods.
+func (c *Controller) attestAggregate(ctx context.Context, agg *aggregate, results map[string]string, failed bool) (*attestationResult, error) {
+	signerOpts, err := c.signerOptions(ctx, agg.art)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pods that complete late are still collected while the aggregate is attested, so it is read under the lock.
+	c.aggregatesMu.Lock()
+	pods := append([]predicate.Predicate(nil), agg.pods...)
+	podSubjects := append([]subject.Subject(nil), agg.subjects...)
+	pod := agg.pod.DeepCopy()
+	written, writtenSummary := agg.written, agg.writtenSummary
+	c.aggregatesMu.Unlock()
+
+	subjects, err := subject.TektonSubjects(results)
+	if err != nil {
+		return nil, fmt.Errorf("reading subjects from results of %s %s/%s: %w", agg.owner.Kind, agg.owner.Namespace, agg.owner.Name, err)
+	}
+	if len(subjects) == 0 {
+		subjects = podSubjects
+	}
+	if len(subjects) == 0 {
+		if !failed {
+			return nil, subject.ErrNotFound
+		}
+
+		// A failed owner may not have produced anything, in which case the owner itself is the subject.
+		sum := sha256.Sum256([]byte(agg.owner.UID))
+		subjects = []subject.Subject{{
+			Name:   fmt.Sprintf("%s:%s/%s", strings.ToLower(agg.owner.Kind), agg.owner.Namespace, agg.owner.Name),
+			Digest: subject.DigestSet{"sha256": hex.EncodeToString(sum[:])},
+			Type:   subject.TypeFile,
+		}}
+	}
+
+	predicateType := predicate.AggregateType
+	if failed {
+		predicateType = predicate.FailedBuildType
+	}
+
+	pred := &predicate.Aggregate{
+		CreatedAt: agg.createdAt,
+		Owner:     agg.owner,
+		Failed:    failed,
+		Pods:      pods,
+	}
+
+	statement := in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v0.1",
+			PredicateType: predicateType,
+		},
+		Predicate: pred,
+	}
+
+	// The phase of the last pod is set from the owner so that failed owners are attested as failed builds.
+	pod.Status.Phase = corev1.PodSucceeded
+	if failed {
+		pod.Status.Phase = corev1.PodFailed
+	}
+
+	c.log.Info("Signing and writing aggregate attestation", "artifact", agg.art.Name, "owner_kind", agg.owner.Kind, "owner_name", agg.owner.Name, "pods", len(pods))
+
+	result, err := c.attest(ctx, pod, statement, subjects, agg.art, signerOpts, written)
+	if err != nil || failed || !agg.art.attestSummary() {
+		return result, err
+	}
+
+	report := agg.art.engine.EvaluateAggregate(pred)
+	result.summary, err = c.attestSummary(ctx, pod, agg.art, subjects, signerOpts, result, report, writtenSummary)
+
+	return result, err
+}
+
+// ownerCompletion returns whether the owner completed and whether it failed.
+func ownerCompletion(owner *unstructured.Unstructured) (bool, bool) {
+	if owner.GetKind() == "Workflow" {
+		phase, _, _ := unstructured.NestedString(owner.Object, "status", "phase")
+		switch phase {
+		case "Succeeded":
+			return true, false
+		case "Failed", "Error":
+			return true, true
+		}
+		return false, false
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(owner.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditionType, _ := condition["type"].(string)
+		status, _ := condition["status"].(string)
+
+		switch {
+		// TaskRuns and PipelineRuns.
+		case conditionType == "Succeeded" && status == "True":
+			return true, false
+		case conditionType == "Succeeded" && status == "False":
+			return true, true
+		// Jobs.
+		case conditionType == "Complete" && status == "True":
+			return true, false
+		case conditionType == "Failed" && status == "True":
+			return true, true
+		}
+	}
+
+	return false, false
+}
+
+// ownerResults returns the string results of a TaskRun or PipelineRun, or the output parameters of a Workflow.
+func ownerResults(owner *unstructured.Unstructured) map[string]string {
+	var paths [][]string
+	switch owner.GetKind() {
+	case "TaskRun":
+		paths = [][]string{{"status", "results"}, {"status", "taskResults"}}
+	case "PipelineRun":
+		paths = [][]string{{"status", "results"}, {"status", "pipelineResults"}}
+	case "Workflow":
+		paths = [][]string{{"status", "outputs", "parameters"}}
+	}
+
+	results := make(map[string]string)
+	for _, path := range paths {
+		items, _, _ := unstructured.NestedSlice(owner.Object, path...)
+		for _, item := range items {
+			result, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := result["name"].(string)
+			value, ok := result["value"].(string)
+			if name == "" || !ok {
+				continue
+			}
+			results[name] = value
+		}
+	}
+
+	return results
+}
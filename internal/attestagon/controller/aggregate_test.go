@@ -0,0 +1,572 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/sink"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// testOwner returns an object in the builds namespace, controlled by the parent if it is not nil.
+func testOwner(apiVersion, kind, name string, parent *unstructured.Unstructured) *unstructured.Unstructured {
+	owner := &unstructured.Unstructured{}
+	owner.SetAPIVersion(apiVersion)
+	owner.SetKind(kind)
+	owner.SetNamespace("builds")
+	owner.SetName(name)
+	owner.SetUID(types.UID(strings.ToLower(kind) + "-" + name))
+	if parent != nil {
+		owner.SetOwnerReferences([]metav1.OwnerReference{controllerRef(parent)})
+	}
+
+	return owner
+}
+
+// controllerRef returns a controller owner reference to the owner.
+func controllerRef(owner *unstructured.Unstructured) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: owner.GetAPIVersion(),
+		Kind:       owner.GetKind(),
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+		Controller: &controller,
+	}
+}
+
+// ownedPod returns a pod in the phase controlled by the owner.
+func ownedPod(name string, owner *unstructured.Unstructured, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "builds",
+			UID:             types.UID("pod-" + name),
+			OwnerReferences: []metav1.OwnerReference{controllerRef(owner)},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+// completeOwner sets the condition of the owner in the cluster to true.
+func completeOwner(t *testing.T, c *Controller, owner *unstructured.Unstructured, conditionType string) {
+	t.Helper()
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(owner.GroupVersionKind())
+	if err := c.client.Get(context.Background(), runtimeclient.ObjectKeyFromObject(owner), current); err != nil {
+		t.Fatal(err)
+	}
+	conditions := []interface{}{map[string]interface{}{"type": conditionType, "status": "True"}}
+	if err := unstructured.SetNestedSlice(current.Object, conditions, "status", "conditions"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.client.Status().Update(context.Background(), current); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeManifest writes a subject manifest with a single file subject for the pod to the shared volume.
+func writeManifest(t *testing.T, volume string, pod *corev1.Pod, name, digest string) {
+	t.Helper()
+
+	dir := filepath.Join(volume, pod.Namespace, pod.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"subjects":[{"name":"` + name + `","digest":{"sha256":"` + digest + `"}}]}`
+	if err := os.WriteFile(filepath.Join(dir, subject.ManifestFile), []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// aggregatePods returns the number of pods collected per owner name.
+func (c *Controller) aggregatePods() map[string]int {
+	c.aggregatesMu.Lock()
+	defer c.aggregatesMu.Unlock()
+
+	pods := make(map[string]int)
+	for _, agg := range c.aggregates {
+		pods[agg.owner.Name] += len(agg.pods)
+	}
+
+	return pods
+}
+
+func TestCollectAggregates(t *testing.T) {
+	pipelineRun := testOwner("tekton.dev/v1", "PipelineRun", "release", nil)
+	build := testOwner("tekton.dev/v1", "TaskRun", "release-build", pipelineRun)
+	test := testOwner("tekton.dev/v1", "TaskRun", "release-test", pipelineRun)
+	job := testOwner("batch/v1", "Job", "nightly", nil)
+
+	buildPod := ownedPod("release-build-pod", build, corev1.PodSucceeded)
+	testPod := ownedPod("release-test-pod", test, corev1.PodFailed)
+	jobPod := ownedPod("nightly-1", job, corev1.PodSucceeded)
+	retriedJobPod := ownedPod("nightly-2", job, corev1.PodSucceeded)
+	runningJobPod := ownedPod("nightly-3", job, corev1.PodRunning)
+
+	tests := []struct {
+		name string
+		kind string
+		pods []*corev1.Pod
+
+		// want is the number of pods collected per owner name.
+		want map[string]int
+	}{
+		{
+			name: "TaskRun",
+			kind: "TaskRun",
+			pods: []*corev1.Pod{buildPod, testPod},
+			want: map[string]int{"release-build": 1, "release-test": 1},
+		},
+		{
+			name: "PipelineRun through its TaskRuns",
+			kind: "PipelineRun",
+			pods: []*corev1.Pod{buildPod, testPod},
+			want: map[string]int{"release": 2},
+		},
+		{
+			name: "Job",
+			kind: "Job",
+			pods: []*corev1.Pod{jobPod, retriedJobPod},
+			want: map[string]int{"nightly": 2},
+		},
+		{
+			name: "pod collected once",
+			kind: "Job",
+			pods: []*corev1.Pod{jobPod, jobPod},
+			want: map[string]int{"nightly": 1},
+		},
+		{
+			name: "running pod",
+			kind: "Job",
+			pods: []*corev1.Pod{runningJobPod},
+			want: map[string]int{},
+		},
+		{
+			name: "pod not owned by the kind",
+			kind: "Job",
+			pods: []*corev1.Pod{buildPod},
+			want: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testController(t, pipelineRun, build, test, job)
+			arts := []*Artifact{
+				{Name: "app", Aggregate: &AggregateConfig{Kind: tt.kind}},
+				{Name: "docs"},
+			}
+
+			for _, pod := range tt.pods {
+				direct, pending, err := c.collectAggregates(context.Background(), pod, arts)
+				if err != nil {
+					t.Fatalf("collectAggregates() error = %v", err)
+				}
+				if len(direct) != 1 || direct[0].Name != "docs" {
+					t.Errorf("collectAggregates() returned %d artifacts, want only docs to be attested for the pod", len(direct))
+				}
+				if want := len(tt.want) > 0; pending != want {
+					t.Errorf("collectAggregates() pending = %t, want %t", pending, want)
+				}
+			}
+
+			if got := c.aggregatePods(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected pods per owner = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessAggregates(t *testing.T) {
+	ctx := context.Background()
+
+	// The HTTP sink fails the first time, so that the aggregate is retried.
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	// Both pods of the Job build the artifact.
+	job := testOwner("batch/v1", "Job", "nightly", nil)
+	first := ownedPod("nightly-1", job, corev1.PodSucceeded)
+	second := ownedPod("nightly-2", job, corev1.PodSucceeded)
+	for _, pod := range []*corev1.Pod{first, second} {
+		pod.Labels = map[string]string{"controller-uid": string(job.GetUID())}
+		pod.Annotations = map[string]string{artifactAnnotation: "cli"}
+	}
+
+	volume := t.TempDir()
+	writeManifest(t, volume, first, "cli_linux_amd64", strings.Repeat("a", 64))
+	writeManifest(t, volume, second, "cli_darwin_arm64", strings.Repeat("b", 64))
+
+	dir := t.TempDir()
+	maxRetries := 0
+	art := &Artifact{
+		Name:      "cli",
+		Subjects:  SubjectConfig{Resolvers: []string{"manifest"}},
+		Signer:    testSigner,
+		Aggregate: &AggregateConfig{Kind: "Job"},
+		Sinks: []SinkConfig{
+			{Filesystem: &FilesystemSinkConfig{Path: dir, Format: sink.FormatDSSE}},
+			{HTTP: &HTTPSinkConfig{URL: srv.URL, MaxRetries: &maxRetries}},
+		},
+	}
+
+	c := testController(t, job, first, second)
+	c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{*art}})
+	c.subjectVolumePath = volume
+	c.giveUpPeriod = time.Hour
+
+	// The aggregate waits for its owner to complete, and then for every pod of the owner to be collected.
+	if _, _, err := c.collectAggregates(ctx, first, []*Artifact{art}); err != nil {
+		t.Fatal(err)
+	}
+	c.processAggregates(ctx)
+	if files := sinkFiles(t, dir); len(files) != 0 {
+		t.Fatalf("attestations %v written before the Job completed", files)
+	}
+	completeOwner(t, c, job, "Complete")
+	c.processAggregates(ctx)
+	if files := sinkFiles(t, dir); len(files) != 0 {
+		t.Fatalf("attestations %v written before every pod of the Job was collected", files)
+	}
+
+	// Once every pod is collected they are attested together, and the aggregate is kept because the HTTP sink failed.
+	if _, _, err := c.collectAggregates(ctx, second, []*Artifact{art}); err != nil {
+		t.Fatal(err)
+	}
+	c.processAggregates(ctx)
+
+	files := sinkFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("filesystem sink has attestations %v, want 1", files)
+	}
+	statement := readAggregateStatement(t, filepath.Join(dir, files[0]))
+	if statement.PredicateType != predicate.AggregateType || len(statement.Subject) != 2 {
+		t.Errorf("attestation has predicate type %s and %d subjects, want %s and 2", statement.PredicateType, len(statement.Subject), predicate.AggregateType)
+	}
+	aggregated := statement.Predicate
+	if len(aggregated.Pods) != 2 || aggregated.Owner.Name != "nightly" || aggregated.Failed {
+		t.Errorf("predicate of owner %s has %d pods and failed %t, want both pods of the succeeded nightly Job", aggregated.Owner.Name, len(aggregated.Pods), aggregated.Failed)
+	}
+	if got := c.aggregatePods(); !reflect.DeepEqual(got, map[string]int{"nightly": 2}) {
+		t.Fatalf("aggregates = %v, want the nightly Job kept for a retry", got)
+	}
+
+	// The retry only writes to the HTTP sink, the filesystem sink is not written again.
+	if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+		t.Fatal(err)
+	}
+	c.processAggregates(ctx)
+
+	if files := sinkFiles(t, dir); len(files) != 0 {
+		t.Errorf("filesystem sink was written again with %v", files)
+	}
+	mu.Lock()
+	if requests != 2 {
+		t.Errorf("HTTP sink received %d requests, want 2", requests)
+	}
+	mu.Unlock()
+	if got := c.aggregatePods(); len(got) != 0 {
+		t.Errorf("aggregates = %v, want none once attested", got)
+	}
+
+	// Pods reconciled after their aggregate was attested are released.
+	if _, pending, err := c.collectAggregates(ctx, first, []*Artifact{art}); err != nil || pending {
+		t.Errorf("collectAggregates() pending = %t, error = %v, want the pod released", pending, err)
+	}
+
+	// After a restart the aggregate is found to be attested by its Attestation resource and not written again.
+	restarted := newTestController(c.client, c.clientset)
+	restarted.runtimeConfig.Store(c.config())
+	restarted.subjectVolumePath = volume
+	if _, _, err := restarted.collectAggregates(ctx, second, []*Artifact{art}); err != nil {
+		t.Fatal(err)
+	}
+	restarted.processAggregates(ctx)
+	if files := sinkFiles(t, dir); len(files) != 0 {
+		t.Errorf("attestation was written again after a restart to %v", files)
+	}
+	if got := restarted.aggregatePods(); len(got) != 0 {
+		t.Errorf("aggregates = %v, want the attested aggregate dropped", got)
+	}
+}
+
+func TestProcessAggregatesGiveUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		condition    string
+		deleted      bool
+		giveUpPeriod time.Duration
+
+		wantKept bool
+	}{
+		{
+			name:         "retried within the give up period",
+			condition:    "Complete",
+			giveUpPeriod: time.Hour,
+			wantKept:     true,
+		},
+		{
+			name:      "given up after the give up period",
+			condition: "Complete",
+		},
+		{
+			name:     "running owner is not given up",
+			wantKept: true,
+		},
+		{
+			name:    "deleted owner",
+			deleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := testOwner("batch/v1", "Job", "nightly", nil)
+			pod := ownedPod("nightly-1", job, corev1.PodSucceeded)
+
+			// No subject is found for the pod, so attesting the aggregate keeps failing.
+			art := &Artifact{
+				Name:      "cli",
+				Subjects:  SubjectConfig{Resolvers: []string{"manifest"}},
+				Signer:    testSigner,
+				Aggregate: &AggregateConfig{Kind: "Job"},
+				Sinks:     []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: t.TempDir()}}},
+			}
+
+			c := testController(t, job)
+			c.subjectVolumePath = t.TempDir()
+			c.giveUpPeriod = tt.giveUpPeriod
+			if _, _, err := c.collectAggregates(context.Background(), pod, []*Artifact{art}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.condition != "" {
+				completeOwner(t, c, job, tt.condition)
+			}
+			if tt.deleted {
+				if err := c.client.Delete(context.Background(), job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c.processAggregates(context.Background())
+
+			if kept := len(c.aggregatePods()) == 1; kept != tt.wantKept {
+				t.Errorf("aggregate kept = %t, want %t", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+// TestProcessAggregatesConcurrently collects pods while the aggregate is processed, which the race detector checks.
+func TestProcessAggregatesConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	job := testOwner("batch/v1", "Job", "nightly", nil)
+	volume := t.TempDir()
+	var pods []*corev1.Pod
+	for i := 0; i < 8; i++ {
+		pod := ownedPod(fmt.Sprintf("nightly-%d", i), job, corev1.PodSucceeded)
+		pod.Labels = map[string]string{"controller-uid": string(job.GetUID())}
+		pod.Annotations = map[string]string{artifactAnnotation: "cli"}
+		writeManifest(t, volume, pod, fmt.Sprintf("cli_%d", i), strings.Repeat(strconv.Itoa(i), 64))
+		pods = append(pods, pod)
+	}
+
+	dir := t.TempDir()
+	art := &Artifact{
+		Name:      "cli",
+		Subjects:  SubjectConfig{Resolvers: []string{"manifest"}},
+		Signer:    testSigner,
+		Aggregate: &AggregateConfig{Kind: "Job"},
+		Sinks:     []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: dir, Format: sink.FormatDSSE}}},
+	}
+
+	objects := []runtimeclient.Object{job}
+	for _, pod := range pods {
+		objects = append(objects, pod)
+	}
+	c := testController(t, objects...)
+	c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{*art}})
+	c.subjectVolumePath = volume
+	c.giveUpPeriod = time.Hour
+	completeOwner(t, c, job, "Complete")
+
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod *corev1.Pod) {
+			defer wg.Done()
+			if _, _, err := c.collectAggregates(ctx, pod, []*Artifact{art}); err != nil {
+				t.Error(err)
+			}
+		}(pod)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			c.processAggregates(ctx)
+		}
+	}()
+	wg.Wait()
+
+	// Whether or not the aggregate was attested while pods were collected, it is attested once with every pod.
+	c.processAggregates(ctx)
+
+	files := sinkFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("filesystem sink has attestations %v, want 1", files)
+	}
+	if statement := readAggregateStatement(t, filepath.Join(dir, files[0])); len(statement.Predicate.Pods) != len(pods) {
+		t.Errorf("aggregate has %d pods, want %d", len(statement.Predicate.Pods), len(pods))
+	}
+}
+
+func TestOwnerCompletion(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		condition map[string]interface{}
+		phase     string
+
+		wantCompleted bool
+		wantFailed    bool
+	}{
+		{
+			name:          "succeeded TaskRun",
+			kind:          "TaskRun",
+			condition:     map[string]interface{}{"type": "Succeeded", "status": "True"},
+			wantCompleted: true,
+		},
+		{
+			name:          "failed PipelineRun",
+			kind:          "PipelineRun",
+			condition:     map[string]interface{}{"type": "Succeeded", "status": "False"},
+			wantCompleted: true,
+			wantFailed:    true,
+		},
+		{
+			name:      "running PipelineRun",
+			kind:      "PipelineRun",
+			condition: map[string]interface{}{"type": "Succeeded", "status": "Unknown"},
+		},
+		{
+			name:          "complete Job",
+			kind:          "Job",
+			condition:     map[string]interface{}{"type": "Complete", "status": "True"},
+			wantCompleted: true,
+		},
+		{
+			name:          "failed Job",
+			kind:          "Job",
+			condition:     map[string]interface{}{"type": "Failed", "status": "True"},
+			wantCompleted: true,
+			wantFailed:    true,
+		},
+		{
+			name:      "suspended Job",
+			kind:      "Job",
+			condition: map[string]interface{}{"type": "Suspended", "status": "True"},
+		},
+		{
+			name:          "succeeded Workflow",
+			kind:          "Workflow",
+			phase:         "Succeeded",
+			wantCompleted: true,
+		},
+		{
+			name:          "errored Workflow",
+			kind:          "Workflow",
+			phase:         "Error",
+			wantCompleted: true,
+			wantFailed:    true,
+		},
+		{
+			name:  "running Workflow",
+			kind:  "Workflow",
+			phase: "Running",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := testOwner("v1", tt.kind, "owner", nil)
+			if tt.condition != nil {
+				owner.Object["status"] = map[string]interface{}{"conditions": []interface{}{tt.condition}}
+			}
+			if tt.phase != "" {
+				owner.Object["status"] = map[string]interface{}{"phase": tt.phase}
+			}
+
+			completed, failed := ownerCompletion(owner)
+			if completed != tt.wantCompleted || failed != tt.wantFailed {
+				t.Errorf("ownerCompletion() = %t, %t, want %t, %t", completed, failed, tt.wantCompleted, tt.wantFailed)
+			}
+		})
+	}
+}
+
+// aggregateStatement is a statement with an aggregate predicate.
+type aggregateStatement struct {
+	in_toto.StatementHeader
+	Predicate predicate.Aggregate `json:"predicate"`
+}
+
+// readAggregateStatement reads the aggregate statement of the DSSE envelope in the file.
+func readAggregateStatement(t *testing.T, path string) aggregateStatement {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statement aggregateStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		t.Fatal(err)
+	}
+
+	return statement
+}
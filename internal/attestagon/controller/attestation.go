@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	attestagonv1alpha1 "github.com/chaosinthecrd/attestagon/pkg/apis/attestagon/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recordAttestation creates or updates the Attestation resource recording the signed attestation of the artifact built
+// by the pod and the locations it was written to. If the Attestation CRD is not installed, nothing is recorded. The
+// resource is owned by the pod, or by the owner of an aggregate, so that it is garbage collected along with it.
+func (c *Controller) recordAttestation(ctx context.Context, pod *corev1.Pod, art *Artifact, att *image.Attestation, locations map[string]string, writeErr error) error {
+	statementDigest, err := att.StatementDigest()
+	if err != nil {
+		return err
+	}
+
+	record := &attestagonv1alpha1.Attestation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      attestationName(pod.Name, statementDigest),
+			Namespace: pod.Namespace,
+			Labels: map[string]string{
+				"attestagon.io/pod": pod.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+			}},
+		},
+		Spec: attestagonv1alpha1.AttestationSpec{
+			Artifact:        art.Name,
+			Policy:          art.Policy.Name,
+			Pod:             attestagonv1alpha1.PodReference{Name: pod.Name, UID: pod.UID},
+			PredicateType:   att.Statement.PredicateType,
+			StatementDigest: statementDigest,
+		},
+	}
+
+	// Attestations of aggregates are found by the UID of their owner, so that they are not attested again.
+	if agg, ok := att.Statement.Predicate.(*predicate.Aggregate); ok {
+		record.Labels[ownerUIDLabel] = string(agg.Owner.UID)
+		record.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: agg.Owner.APIVersion,
+			Kind:       agg.Owner.Kind,
+			Name:       agg.Owner.Name,
+			UID:        agg.Owner.UID,
+		}}
+	}
+
+	for _, s := range att.Statement.Subject {
+		record.Spec.Subjects = append(record.Spec.Subjects, attestagonv1alpha1.Subject{Name: s.Name, Digest: s.Digest})
+	}
+
+	if err := c.client.Create(ctx, record); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		if !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("creating attestation %s/%s: %w", record.Namespace, record.Name, err)
+		}
+		if err := c.client.Get(ctx, runtimeclient.ObjectKeyFromObject(record), record); err != nil {
+			return err
+		}
+	}
+
+	sinks := make([]string, 0, len(locations))
+	for s := range locations {
+		sinks = append(sinks, s)
+	}
+	sort.Strings(sinks)
+
+	record.Status.Locations = nil
+	for _, s := range sinks {
+		record.Status.Locations = append(record.Status.Locations, attestagonv1alpha1.Location{Sink: s, Location: locations[s]})
+	}
+
+	condition := metav1.Condition{
+		Type:    attestagonv1alpha1.ConditionWritten,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Written",
+		Message: "Attestation was written to every sink",
+	}
+	if writeErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "WriteFailed"
+		condition.Message = writeErr.Error()
+	}
+	meta.SetStatusCondition(&record.Status.Conditions, condition)
+
+	if err := c.client.Status().Update(ctx, record); err != nil {
+		return fmt.Errorf("updating status of attestation %s/%s: %w", record.Namespace, record.Name, err)
+	}
+
+	return nil
+}
+
+// attestationName returns the name of the Attestation resource for the statement produced by the pod.
+func attestationName(podName, statementDigest string) string {
+	// Names must be at most 253 characters long.
+	if len(podName) > 200 {
+		podName = strings.TrimRight(podName[:200], "-.")
+	}
+	return fmt.Sprintf("%s-%s", podName, statementDigest[:16])
+}
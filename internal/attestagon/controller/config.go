@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	tetragonv1 "github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/fsnotify/fsnotify"
+)
+
+// runtimeConfig is the configuration of the controller that is loaded from the config file. It is replaced as a whole
+// when the config file changes, so it must not be modified once it is in use.
+type runtimeConfig struct {
+	// artifacts are the artifacts for which attestagon should generate attestations for.
+	artifacts []Artifact
+
+	// podFilter is the filter applied to the tetragon events.
+	podFilter PodFilter
+
+	// signerConfig is the signer configuration for the attestagon controller to use for signing the attestation.
+	signerConfig options.SignerConfig
+
+	// keyLoader loads the private key used for signing when not signing keyless.
+	keyLoader *image.KeyLoader
+
+	// verification are the policies the validating admission webhook verifies pod images against.
+	verification []verificationPolicy
+
+	// artifactPolicies restricts what the ArtifactPolicies of namespaces may configure.
+	artifactPolicies ArtifactPolicyConfig
+
+	// raw is the content of the config file the configuration was loaded from.
+	raw []byte
+}
+
+// config returns the current configuration of the controller.
+func (c *Controller) config() *runtimeConfig {
+	return c.runtimeConfig.Load()
+}
+
+// loadRuntimeConfig loads and validates the configuration from the config file.
+func (c *Controller) loadRuntimeConfig() (*runtimeConfig, error) {
+	raw, err := os.ReadFile(c.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &runtimeConfig{
+		artifacts:        config.Artifacts,
+		podFilter:        config.PodFilter,
+		signerConfig:     config.Signer.apply(c.signerFlags),
+		artifactPolicies: config.ArtifactPolicies,
+		raw:              raw,
+	}
+
+	if err := rc.artifactPolicies.validate(); err != nil {
+		return nil, fmt.Errorf("invalid artifact policy configuration: %w", err)
+	}
+
+	if !rc.signerConfig.Keyless && rc.signerConfig.PrivateKeyPath != "" {
+		rc.keyLoader, err = image.NewKeyLoader(rc.signerConfig.PrivateKeyPath, rc.signerConfig.PrivateKeyPasswordPath, rc.signerConfig.PrivateKeyPasswordEnv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signer private key: %w", err)
+		}
+	}
+
+	for _, p := range config.Verification.Policies {
+		vp, err := loadVerificationPolicy(c.ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification policy %q: %w", p.Name, err)
+		}
+		rc.verification = append(rc.verification, vp)
+	}
+
+	for i := range rc.artifacts {
+		if err := rc.artifacts[i].Selector.validate(); err != nil {
+			return nil, fmt.Errorf("invalid selector for artifact %q: %w", rc.artifacts[i].Name, err)
+		}
+		if err := rc.artifacts[i].Aggregate.validate(); err != nil {
+			return nil, fmt.Errorf("invalid aggregation for artifact %q: %w", rc.artifacts[i].Name, err)
+		}
+		if _, err := c.sinks(&rc.artifacts[i], image.RemoteOptions{}, false); err != nil {
+			return nil, fmt.Errorf("invalid sink configuration for artifact %q: %w", rc.artifacts[i].Name, err)
+		}
+		if rc.artifacts[i].attestFailed() {
+			if _, err := c.sinks(&rc.artifacts[i], image.RemoteOptions{}, true); err != nil {
+				return nil, fmt.Errorf("invalid failed build sink configuration for artifact %q: %w", rc.artifacts[i].Name, err)
+			}
+		}
+		if _, err := c.subjectResolvers(&rc.artifacts[i], image.RemoteOptions{}); err != nil {
+			return nil, fmt.Errorf("invalid subject configuration for artifact %q: %w", rc.artifacts[i].Name, err)
+		}
+		if rc.artifacts[i].Rules != nil {
+			if rc.artifacts[i].engine, err = policy.NewEngine(*rc.artifacts[i].Rules); err != nil {
+				return nil, fmt.Errorf("invalid rules for artifact %q: %w", rc.artifacts[i].Name, err)
+			}
+		}
+		if err := rc.artifacts[i].VSA.validate(rc.artifacts[i].Rules); err != nil {
+			return nil, fmt.Errorf("invalid verification summary for artifact %q: %w", rc.artifacts[i].Name, err)
+		}
+	}
+
+	return rc, nil
+}
+
+// reloadConfig reloads the config file and swaps in the new configuration if it changed. If the new configuration is
+// invalid, the current configuration is kept. The tetragon filter is updated without dropping the event cache.
+func (c *Controller) reloadConfig() {
+	rc, err := c.loadRuntimeConfig()
+	if err != nil {
+		c.log.Error(err, "Failed to reload attestagon config, keeping the current config")
+		return
+	}
+
+	old := c.runtimeConfig.Load()
+	if bytes.Equal(old.raw, rc.raw) {
+		return
+	}
+
+	c.runtimeConfig.Store(rc)
+	c.log.Info("Reloaded attestagon config", "artifacts", len(rc.artifacts))
+
+	if !reflect.DeepEqual(old.podFilter, rc.podFilter) {
+		c.eventCache.SetFilter(rc.podFilter.tetragonFilter())
+	}
+}
+
+// watchConfig reloads the config file when it changes or a reload is requested, until the context is done. The
+// directory of the config file is watched, as ConfigMap volumes are updated by swapping a symlink.
+func (c *Controller) watchConfig(ctx context.Context, reload <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(c.configPath)); err != nil {
+		return fmt.Errorf("watching config file: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-reload:
+			c.reloadConfig()
+		case <-watcher.Events:
+			c.reloadConfig()
+		case err := <-watcher.Errors:
+			c.log.Error(err, "Error watching config file")
+		}
+	}
+}
+
+// tetragonFilter returns the tetragon filter for the pod filter.
+func (f PodFilter) tetragonFilter() *tetragonv1.Filter {
+	return &tetragonv1.Filter{
+		Namespace:   f.Namespaces,
+		BinaryRegex: f.Regex,
+	}
+}
+
+// apply returns the signer flags overridden by the fields set in the config file.
+func (s SignerOverrides) apply(flags options.SignerConfig) options.SignerConfig {
+	if s.PrivateKeyPath != "" {
+		flags.PrivateKeyPath = s.PrivateKeyPath
+	}
+	if s.PrivateKeyPasswordPath != "" {
+		flags.PrivateKeyPasswordPath = s.PrivateKeyPasswordPath
+	}
+	if s.Keyless != nil {
+		flags.Keyless = *s.Keyless
+	}
+	if s.FulcioURL != "" {
+		flags.FulcioURL = s.FulcioURL
+	}
+	if s.RekorURL != "" {
+		flags.RekorURL = s.RekorURL
+	}
+	if s.TlogUpload != nil {
+		flags.TlogUpload = *s.TlogUpload
+	}
+	if s.TSAURL != "" {
+		flags.TSAURL = s.TSAURL
+	}
+
+	return flags
+}
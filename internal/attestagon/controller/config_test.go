@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/cache"
+	tetragonv1 "github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+)
+
+// sensors is a tetragon server that sends the filter of every event stream that is opened and keeps the stream open
+// until the client cancels it.
+type sensors struct {
+	tetragonv1.UnimplementedFineGuidanceSensorsServer
+	filters chan *tetragonv1.Filter
+}
+
+func (s *sensors) GetEvents(request *tetragonv1.GetEventsRequest, stream tetragonv1.FineGuidanceSensors_GetEventsServer) error {
+	var filter *tetragonv1.Filter
+	if len(request.AllowList) > 0 {
+		filter = request.AllowList[0]
+	}
+	s.filters <- filter
+
+	<-stream.Context().Done()
+	return nil
+}
+
+// startSensors starts a tetragon server, returning its address.
+func startSensors(t *testing.T) (*sensors, string) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	s := &sensors{filters: make(chan *tetragonv1.Filter, 10)}
+	tetragonv1.RegisterFineGuidanceSensorsServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return s, lis.Addr().String()
+}
+
+// nextFilter returns the filter of the next event stream opened within the timeout, or nil if none was opened.
+func (s *sensors) nextFilter(timeout time.Duration) *tetragonv1.Filter {
+	select {
+	case filter := <-s.filters:
+		return filter
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// testConfig returns a config file attesting the artifacts to filesystem sinks with the pod filter of the namespaces.
+func testConfig(t *testing.T, namespaces []string, artifacts ...string) string {
+	t.Helper()
+
+	config := fmt.Sprintf("podFilter:\n  namespaces: [%s]\nartifacts:\n", strings.Join(namespaces, ", "))
+	for _, art := range artifacts {
+		config += fmt.Sprintf("- name: %s\n  sinks:\n  - filesystem:\n      path: %s\n", art, t.TempDir())
+	}
+
+	return config
+}
+
+// configController returns a controller with the configuration loaded from the config file, whose event cache
+// streams events from the tetragon server at the address.
+func configController(t *testing.T, config, addr string) *Controller {
+	t.Helper()
+
+	c := &Controller{ctx: context.Background(), log: logr.Discard(), configPath: filepath.Join(t.TempDir(), "config.yaml")}
+	if err := os.WriteFile(c.configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := c.loadRuntimeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.runtimeConfig.Store(rc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.eventCache, err = cache.New(ctx, logr.Discard(), options.TLSConfig{}, addr, rc.podFilter.tetragonFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// artifactNames returns the names of the artifacts of the configuration.
+func (rc *runtimeConfig) artifactNames() []string {
+	var names []string
+	for _, art := range rc.artifacts {
+		names = append(names, art.Name)
+	}
+
+	return names
+}
+
+func TestReloadConfig(t *testing.T) {
+	s, addr := startSensors(t)
+	initial := testConfig(t, []string{"builds"}, "app")
+	c := configController(t, initial, addr)
+	go c.eventCache.Start()
+	if got := s.nextFilter(10 * time.Second); !reflect.DeepEqual(got.GetNamespace(), []string{"builds"}) {
+		t.Fatalf("event stream opened with filter %v, want the builds namespace", got)
+	}
+	current := c.config()
+
+	tests := []struct {
+		name   string
+		config string
+
+		// wantArtifacts are the artifacts of the new configuration, nil if the current configuration must be kept.
+		wantArtifacts []string
+		// wantNamespaces are the namespaces of the reopened event stream, nil if it must not be reopened.
+		wantNamespaces []string
+	}{
+		{
+			name:   "unchanged config",
+			config: initial,
+		},
+		{
+			name:   "invalid YAML",
+			config: "artifacts: [",
+		},
+		{
+			name:   "invalid sink",
+			config: "artifacts:\n- name: app\n  sinks:\n  - {}\n",
+		},
+		{
+			name:   "unknown subject resolver",
+			config: "artifacts:\n- name: app\n  subjects:\n    resolvers: [unknown]\n",
+		},
+		{
+			name:          "changed artifacts",
+			config:        testConfig(t, []string{"builds"}, "app", "cli"),
+			wantArtifacts: []string{"app", "cli"},
+		},
+		{
+			name:           "changed pod filter",
+			config:         testConfig(t, []string{"builds", "releases"}, "app"),
+			wantArtifacts:  []string{"app"},
+			wantNamespaces: []string{"builds", "releases"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.runtimeConfig.Store(current)
+			if err := os.WriteFile(c.configPath, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			c.reloadConfig()
+
+			got := c.config()
+			switch {
+			case tt.wantArtifacts == nil && got != current:
+				t.Errorf("reloadConfig() replaced the config with artifacts %v, want the current config kept", got.artifactNames())
+			case tt.wantArtifacts != nil && !reflect.DeepEqual(got.artifactNames(), tt.wantArtifacts):
+				t.Errorf("reloadConfig() loaded artifacts %v, want %v", got.artifactNames(), tt.wantArtifacts)
+			}
+
+			timeout := 10 * time.Second
+			if tt.wantNamespaces == nil {
+				timeout = 100 * time.Millisecond
+			}
+			if filter := s.nextFilter(timeout); !reflect.DeepEqual(filter.GetNamespace(), tt.wantNamespaces) {
+				t.Errorf("event stream reopened with namespaces %v, want %v", filter.GetNamespace(), tt.wantNamespaces)
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	_, addr := startSensors(t)
+	c := configController(t, testConfig(t, []string{"builds"}, "app"), addr)
+
+	// A reload, e.g. on SIGHUP, reloads the config file even if it did not change while it was watched.
+	if err := os.WriteFile(c.configPath, []byte(testConfig(t, []string{"builds"}, "docs")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- c.watchConfig(ctx, reload)
+	}()
+
+	// waitForArtifacts waits until the configuration has the artifacts.
+	waitForArtifacts := func(want ...string) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !reflect.DeepEqual(c.config().artifactNames(), want); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("config has artifacts %v, want %v", c.config().artifactNames(), want)
+			}
+		}
+	}
+
+	reload <- struct{}{}
+	waitForArtifacts("docs")
+
+	// The config file is reloaded when it is written.
+	if err := os.WriteFile(c.configPath, []byte(testConfig(t, []string{"builds"}, "app", "cli")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForArtifacts("app", "cli")
+
+	// ConfigMap volumes are updated by replacing the file.
+	next := filepath.Join(filepath.Dir(c.configPath), "next.yaml")
+	if err := os.WriteFile(next, []byte(testConfig(t, []string{"builds"}, "chart")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(next, c.configPath); err != nil {
+		t.Fatal(err)
+	}
+	waitForArtifacts("chart")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("watchConfig() error = %v", err)
+	}
+}
@@ -4,25 +4,34 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
 	"github.com/chaosinthecrd/attestagon/internal/attestagon/cache"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
 	tetragonconfig "github.com/chaosinthecrd/attestagon/internal/tetragon"
-	tetragonv1 "github.com/cilium/tetragon/api/v1/tetragon"
+	attestagonv1alpha1 "github.com/chaosinthecrd/attestagon/pkg/apis/attestagon/v1alpha1"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	runtimeconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // Options holds the options needed for the controller
@@ -36,11 +45,26 @@ type Options struct {
 	// SignerConfig is the signer configuration for the attestagon controller to use for signing the attestation.
 	SignerConfig options.SignerConfig
 
+	// SubjectVolumePath is the path of the volume shared with build pods that digest and metadata files are read from.
+	SubjectVolumePath string
+
 	// TetragonServerAdddress is the address for the tetragon GRPC server.
 	TetragonServerAddress string
 
 	// RestConfig is used for interacting with the Kubernetes API server.
 	RestConfig *rest.Config
+
+	// Reload receives a value when the config file should be reloaded, e.g. on SIGHUP.
+	Reload <-chan struct{}
+
+	// GiveUpPeriod is how long after a pod finished attestation is retried before the pod is released.
+	GiveUpPeriod time.Duration
+
+	// LeaderElection configures the leader election between replicas of the controller.
+	LeaderElection options.LeaderElection
+
+	// Webhook configures the validating admission webhook.
+	Webhook options.Webhook
 }
 
 // Controller is used for running the attestagon controller. Controller will watch the attestagon logs and generate signed attestations from those logs based on pods that are marked to be attested (using pod annotations).
@@ -51,17 +75,29 @@ type Controller struct {
 	// log is the Controller logger.
 	log logr.Logger
 
-	// artifacts are the artifacts for which attestagon should generate attestations for.
-	artifacts []Artifact
+	// configPath is the path to the attestagon controller configuration file.
+	configPath string
+
+	// runtimeConfig is the current configuration loaded from the config file.
+	runtimeConfig atomic.Pointer[runtimeConfig]
+
+	// reload receives a value when the config file should be reloaded.
+	reload <-chan struct{}
 
 	// tetragonGrpcClientConfig is the config used to connect to the tetragon grpc server.
 	tetragonGrpcClientConfig tetragonconfig.GrpcClientConfig
 
-	// signerConfig is the signer configuration for the attestagon controller to use for signing the attestation.
-	signerConfig options.SignerConfig
+	// signerFlags is the signer configuration from the command line flags, which the config file can override.
+	signerFlags options.SignerConfig
+
+	// giveUpPeriod is how long after a pod finished attestation is retried before the pod is released.
+	giveUpPeriod time.Duration
+
+	// subjectVolumePath is the path of the volume shared with build pods that digest and metadata files are read from.
+	subjectVolumePath string
 
 	// clientSet is the Kubernetes clientset used for interacting with the kubernetes api.
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 
 	// controllerManager is the controller-runtime manager used to run the controller.
 	controllerManager manager.Manager
@@ -73,16 +109,47 @@ type Controller struct {
 	client runtimeclient.Client
 
 	// eventCache is the cache of tetragon events
-	eventCache cache.EventCache
+	eventCache *cache.EventCache
+
+	// recorder records Kubernetes events on attested pods and their owners.
+	recorder record.EventRecorder
 
 	// mutex is the mutex to ensure that only one process function is executed per pod
 	mutex map[string]*sync.Mutex
+
+	// aggregates are the pods collected for artifacts aggregated by an owner, keyed by owner UID and artifact name.
+	aggregates map[string]*aggregate
+
+	// aggregated records when the aggregates that are finished with were completed, keyed like aggregates, so that pods
+	// collected after their owner was attested are released instead of being attested again.
+	aggregated map[string]time.Time
+
+	// aggregatesMu guards aggregates, aggregated and the collected pods and progress of each aggregate.
+	aggregatesMu sync.Mutex
 }
 
-// Config is the config file for the attestagon controller.
+// Config is the config file for the attestagon controller. The file is reloaded when it changes.
 type Config struct {
-	Artifacts []Artifact `yaml:"artifacts"`
-	PodFilter PodFilter  `yaml:"podFilter"`
+	Artifacts []Artifact      `yaml:"artifacts"`
+	PodFilter PodFilter       `yaml:"podFilter"`
+	Signer    SignerOverrides `yaml:"signer"`
+
+	// Verification configures the validating admission webhook that verifies the attestations of pod images.
+	Verification VerificationConfig `yaml:"verification"`
+
+	// ArtifactPolicies restricts what the ArtifactPolicies of namespaces may configure.
+	ArtifactPolicies ArtifactPolicyConfig `yaml:"artifactPolicies"`
+}
+
+// SignerOverrides overrides the signer flags of the controller. Fields that are not set keep the value of the flag.
+type SignerOverrides struct {
+	PrivateKeyPath         string `yaml:"privateKeyPath"`
+	PrivateKeyPasswordPath string `yaml:"privateKeyPasswordPath"`
+	Keyless                *bool  `yaml:"keyless"`
+	FulcioURL              string `yaml:"fulcioURL"`
+	RekorURL               string `yaml:"rekorURL"`
+	TlogUpload             *bool  `yaml:"tlogUpload"`
+	TSAURL                 string `yaml:"tsaURL"`
 }
 
 // PodFilter are the filters applied to the tetragon events that are monitored by the attestagon controller.
@@ -95,33 +162,201 @@ type PodFilter struct {
 type Artifact struct {
 	Name string `yaml:"name"`
 	Ref  string `yaml:"ref"`
+
+	// Storage is how attestations are stored in the registry at Ref, either "tag" (the default) for the cosign tag
+	// scheme or "referrers" for OCI 1.1 referrers, falling back to the tag scheme if the registry does not support it.
+	Storage string `yaml:"storage"`
+
+	// Credentials configures where the credentials for the registry at Ref are resolved from.
+	Credentials RegistryCredentials `yaml:"credentials"`
+
+	// Transport configures how the registry at Ref is contacted.
+	Transport RegistryTransport `yaml:"transport"`
+
+	// Subjects configures how the digest of the artifact is discovered from the build pod.
+	Subjects SubjectConfig `yaml:"subjects"`
+
+	// Signer overrides the signer of the controller for this artifact.
+	Signer *ArtifactSigner `yaml:"signer"`
+
+	// Sinks are the destinations the signed attestation is written to in addition to the registry at Ref.
+	Sinks []SinkConfig `yaml:"sinks"`
+
+	// Policy is the namespace/name of the ArtifactPolicy the artifact was loaded from, if any.
+	Policy types.NamespacedName `yaml:"-"`
+
+	// Selector selects the pods that build the artifact. Pods naming the artifact in the attestagon.io/artifact or
+	// attestagon.io/artifacts annotation must also match the selector if it is set.
+	Selector *PodSelector `yaml:"selector"`
+
+	// FailedBuilds configures the attestation of pods that fail to build the artifact. Failed builds are not
+	// attested unless enabled.
+	FailedBuilds *FailedBuildConfig `yaml:"failedBuilds"`
+
+	// Aggregate combines the pods building the artifact into one attestation per owner, such as a PipelineRun, instead
+	// of attesting every pod.
+	Aggregate *AggregateConfig `yaml:"aggregate"`
+
+	// Rules are checked against the predicate of every pod building the artifact. Violations are reported as events,
+	// the attestation is written regardless so that the evidence is kept.
+	Rules *policy.Rules `yaml:"rules"`
+
+	// VSA writes a SLSA verification summary attestation recording whether the predicate passed Rules.
+	VSA *VSAConfig `yaml:"vsa"`
+
+	// engine evaluates Rules. It is nil if the artifact has no rules.
+	engine *policy.Engine
 }
 
-// New constructs a new Controller instance.
-func New(log logr.Logger, opts Options) (*Controller, error) {
-	ctx := context.Background()
+// FailedBuildConfig configures the attestation of failed builds. Attestations of failed builds use the
+// https://attestagon.io/failed-build/v0.1 predicate type and are never written to the registry at Ref, so that
+// policies never accept them in place of the provenance of a successful build.
+type FailedBuildConfig struct {
+	Enabled bool `yaml:"enabled"`
 
-	config, err := loadConfig(opts.ConfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load attestagon config: %w", err)
-	}
+	// Sinks are the destinations attestations of failed builds are written to. The sinks of the artifact are used
+	// if none are set.
+	Sinks []SinkConfig `yaml:"sinks"`
+}
 
-	filters := &tetragonv1.Filter{
-		Namespace:   config.PodFilter.Namespaces,
-		BinaryRegex: config.PodFilter.Regex,
-	}
+// attestFailed returns whether failed builds of the artifact are attested.
+func (a *Artifact) attestFailed() bool {
+	return a.FailedBuilds != nil && a.FailedBuilds.Enabled
+}
 
-	ec, err := cache.New(ctx, log.WithName("attestagon-cache"), opts.TLSConfig, opts.TetragonServerAddress, filters)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create event cache: %w", err)
-	}
+// ArtifactSigner configures the private key used to sign the attestations of an artifact.
+type ArtifactSigner struct {
+	// KeySecretRef is a reference to the Secret key containing the PEM encoded private key.
+	KeySecretRef SecretKeyReference `yaml:"keySecretRef"`
+
+	// PasswordKey is the key of the same Secret containing the password of the private key.
+	PasswordKey string `yaml:"passwordKey"`
+}
+
+// SecretKeyReference is a reference to a key of a Kubernetes Secret.
+type SecretKeyReference struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Key       string `yaml:"key"`
+}
+
+// RegistryCredentials configures the sources of registry credentials for an artifact, in addition to the docker config
+// of the controller.
+type RegistryCredentials struct {
+	// SecretRef is a reference to a kubernetes.io/dockerconfigjson Secret. If the namespace is empty, the namespace of
+	// the pod is used.
+	SecretRef *SecretReference `yaml:"secretRef"`
+
+	// UsePodCredentials uses the imagePullSecrets of the pod and of its service account.
+	UsePodCredentials bool `yaml:"usePodCredentials"`
+
+	// CloudKeychains uses the Google, AWS ECR and Azure ACR keychains, e.g. with workload identity.
+	CloudKeychains bool `yaml:"cloudKeychains"`
+}
+
+// RegistryTransport configures the connection to the registry of an artifact.
+type RegistryTransport struct {
+	// CABundleRef is a reference to a ConfigMap key containing PEM encoded CA certificates to trust in addition to the
+	// system roots. If the namespace is empty, the namespace of the pod is used.
+	CABundleRef *KeyReference `yaml:"caBundleRef"`
+
+	// AllowInsecure allows the registry to be contacted over plain HTTP or with an unverified TLS certificate.
+	AllowInsecure bool `yaml:"allowInsecure"`
+
+	// ProxyURL is the URL of the proxy used to contact the registry. If empty, the proxy environment variables of the
+	// controller are used.
+	ProxyURL string `yaml:"proxyURL"`
+
+	// ClientCertSecretRef is a reference to a kubernetes.io/tls Secret containing the client certificate used for
+	// mutual TLS. If the namespace is empty, the namespace of the pod is used.
+	ClientCertSecretRef *SecretReference `yaml:"clientCertSecretRef"`
+}
+
+// SubjectConfig configures the resolvers used to discover the subjects of an attestation.
+type SubjectConfig struct {
+	// Resolvers are the names of the resolvers to try, in order. The first resolver that finds a subject is used.
+	// Valid names are "tekton", "annotation", "kaniko", "buildkit", "manifest" and "registry". Defaults to every
+	// resolver in that order, with "registry" only included if Tag is set.
+	Resolvers []string `yaml:"resolvers"`
+
+	// Tag is the tag the build pushes to the repository at Ref, used by the "registry" resolver.
+	Tag string `yaml:"tag"`
+
+	// References maps the names of build results, e.g. API_IMAGE_DIGEST, to the image repository of the subject read
+	// from that result. Subjects without a reference use the image name reported by the build, or else Ref.
+	References map[string]string `yaml:"references"`
+}
+
+// KeyReference is a reference to a key of a Kubernetes ConfigMap.
+type KeyReference struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Key       string `yaml:"key"`
+}
+
+// SinkConfig is the configuration of a destination for signed attestations. Exactly one field must be set.
+type SinkConfig struct {
+	Filesystem *FilesystemSinkConfig `yaml:"filesystem"`
+	Archivista *ArchivistaSinkConfig `yaml:"archivista"`
+	HTTP       *HTTPSinkConfig       `yaml:"http"`
+}
+
+// FilesystemSinkConfig is the configuration for writing signed attestations to a directory.
+type FilesystemSinkConfig struct {
+	// Path is the directory the attestations are written to.
+	Path string `yaml:"path"`
+
+	// Format is either "bundle" (the default) for sigstore bundles or "dsse" for DSSE envelopes.
+	Format string `yaml:"format"`
+}
+
+// ArchivistaSinkConfig is the configuration for uploading signed attestations to Archivista.
+type ArchivistaSinkConfig struct {
+	// URL is the address of the Archivista instance.
+	URL string `yaml:"url"`
+
+	// HeadersSecretRef is a reference to a Secret whose keys and values are added as headers to upload requests.
+	HeadersSecretRef *SecretReference `yaml:"headersSecretRef"`
+
+	// MaxRetries is the number of times a failed upload is retried. Defaults to 3.
+	MaxRetries *int `yaml:"maxRetries"`
+}
+
+// HTTPSinkConfig is the configuration for posting signed attestations to an HTTP endpoint.
+type HTTPSinkConfig struct {
+	// URL is the address the attestations are posted to.
+	URL string `yaml:"url"`
+
+	// Format is either "bundle" (the default) for sigstore bundles or "dsse" for DSSE envelopes.
+	Format string `yaml:"format"`
+
+	// HeadersSecretRef is a reference to a Secret whose keys and values are added as headers to requests.
+	HeadersSecretRef *SecretReference `yaml:"headersSecretRef"`
+
+	// MaxRetries is the number of times a failed request is retried. Defaults to 3.
+	MaxRetries *int `yaml:"maxRetries"`
+}
+
+// SecretReference is a reference to a Kubernetes Secret.
+type SecretReference struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+// New constructs a new Controller instance.
+func New(log logr.Logger, opts Options) (*Controller, error) {
+	ctx := context.Background()
 
 	c := &Controller{
-		ctx:          ctx,
-		log:          log.WithName("attestagon"),
-		signerConfig: opts.SignerConfig,
-		artifacts:    config.Artifacts,
-		eventCache:   *ec,
+		ctx:               ctx,
+		log:               log.WithName("attestagon"),
+		configPath:        opts.ConfigPath,
+		reload:            opts.Reload,
+		signerFlags:       opts.SignerConfig,
+		subjectVolumePath: opts.SubjectVolumePath,
+		giveUpPeriod:      opts.GiveUpPeriod,
+		aggregates:        make(map[string]*aggregate),
+		aggregated:        make(map[string]time.Time),
 	}
 
 	// Set sane defaults.
@@ -132,7 +367,33 @@ func New(log logr.Logger, opts Options) (*Controller, error) {
 
 	c.clientset = client
 
-	mgr, err := manager.New(runtimeconfig.GetConfigOrDie(), manager.Options{Scheme: scheme.Scheme, Metrics: metricsserver.Options{BindAddress: "0"}})
+	config, err := c.loadRuntimeConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attestagon config: %w", err)
+	}
+	c.runtimeConfig.Store(config)
+
+	c.eventCache, err = cache.New(ctx, log.WithName("attestagon-cache"), opts.TLSConfig, opts.TetragonServerAddress, config.podFilter.tetragonFilter())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event cache: %w", err)
+	}
+
+	utilruntime.Must(attestagonv1alpha1.AddToScheme(scheme.Scheme))
+
+	// The pod controller only runs on the elected leader so that pods are attested once. The event cache is started
+	// outside of the manager and runs on every replica.
+	mgr, err := manager.New(runtimeconfig.GetConfigOrDie(), manager.Options{
+		Scheme:                        scheme.Scheme,
+		Metrics:                       metricsserver.Options{BindAddress: "0"},
+		LeaderElection:                opts.LeaderElection.Enabled,
+		LeaderElectionNamespace:       opts.LeaderElection.Namespace,
+		LeaderElectionID:              opts.LeaderElection.ID,
+		LeaderElectionReleaseOnCancel: true,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    opts.Webhook.Port,
+			CertDir: opts.Webhook.CertDir,
+		}),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -141,14 +402,32 @@ func New(log logr.Logger, opts Options) (*Controller, error) {
 
 	c.cache = c.controllerManager.GetCache()
 	c.client = c.controllerManager.GetClient()
-	err = builder.ControllerManagedBy(c.controllerManager).For(&corev1.Pod{}).Complete(c)
-	if err != nil {
+	c.recorder = c.controllerManager.GetEventRecorderFor("attestagon")
+	if err := c.setupWithManager(mgr); err != nil {
 		return nil, err
 	}
 
+	// The webhook is served by every replica, not only the leader.
+	if opts.Webhook.Port != 0 {
+		mgr.GetWebhookServer().Register(validatePodPath, &webhook.Admission{
+			Handler: &podValidator{c: c, decoder: admission.NewDecoder(scheme.Scheme)},
+		})
+	}
+
 	return c, nil
 }
 
+// setupWithManager registers the pod controller and the attestation of aggregates with the manager. Both only run on
+// the elected leader, so that every pod and aggregate is attested by a single replica.
+func (c *Controller) setupWithManager(mgr manager.Manager) error {
+	if err := builder.ControllerManagedBy(mgr).For(&corev1.Pod{}).Complete(c); err != nil {
+		return err
+	}
+
+	// Aggregates are attested by the leader once their owner completes.
+	return mgr.Add(manager.RunnableFunc(c.runAggregates))
+}
+
 func (c *Controller) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
 	// Observe the state of the world
 	pod := new(corev1.Pod)
@@ -161,22 +440,108 @@ func (c *Controller) Reconcile(ctx context.Context, request reconcile.Request) (
 		return reconcile.Result{}, err
 	}
 
+	if pod.Annotations[attestedAnnotation] == "true" {
+		if controllerutil.ContainsFinalizer(pod, attestationFinalizer) {
+			return reconcile.Result{}, c.finishPod(ctx, pod, pod.Annotations[outcomeAnnotation])
+		}
+		return reconcile.Result{}, nil
+	}
+
 	// Check if it needs to be attestagon'd
-	if art := c.ReadyForProcessing(pod); art != nil {
-		pod.SetAnnotations(map[string]string{"attestagon.io/attested": "true"})
-		err = c.client.Update(ctx, pod)
-		if err != nil {
-			return reconcile.Result{}, err
+	arts, err := c.podArtifacts(ctx, pod)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if len(arts) == 0 {
+		if controllerutil.ContainsFinalizer(pod, attestationFinalizer) {
+			// The pod no longer builds any artifact, e.g. because the config changed.
+			return reconcile.Result{}, c.finishPod(ctx, pod, outcomeNotCompleted)
 		}
+		return reconcile.Result{}, nil
+	}
 
-		err = c.ProcessPod(ctx, pod, art)
-		if err != nil {
-			c.log.Error(err, "Failed to process pod")
-			return reconcile.Result{}, err
+	// Artifacts aggregated by an owner of the pod are attested once the owner completes. The pod keeps its finalizer
+	// until then, so that it is collected again if the controller restarts, and its other artifacts are attested after.
+	arts, pending, err := c.collectAggregates(ctx, pod, arts)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if pending {
+		return reconcile.Result{RequeueAfter: aggregateInterval}, nil
+	}
+
+	completed := pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+	if len(arts) == 0 && completed {
+		delete(c.eventCache.Store, pod.Name)
+		return reconcile.Result{}, c.finishPod(ctx, pod, outcomeAggregated)
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return c.attestPod(ctx, pod, arts)
+	case corev1.PodFailed:
+		var failed []*Artifact
+		for _, art := range arts {
+			if art.attestFailed() {
+				failed = append(failed, art)
+			}
+		}
+
+		if len(failed) == 0 {
+			delete(c.eventCache.Store, pod.Name)
+			return reconcile.Result{}, c.finishPod(ctx, pod, outcomeNotCompleted)
 		}
+
+		return c.attestPod(ctx, pod, failed)
+	default:
+		if pod.DeletionTimestamp != nil {
+			// The pod is deleted before it completed, so there is nothing to attest.
+			if controllerutil.ContainsFinalizer(pod, attestationFinalizer) {
+				return reconcile.Result{}, c.finishPod(ctx, pod, outcomeNotCompleted)
+			}
+			return reconcile.Result{}, nil
+		}
+
+		// Keep the pod from being deleted before it has been attested.
+		return reconcile.Result{}, c.ensureFinalizer(ctx, pod)
 	}
+}
 
-	return reconcile.Result{}, err
+// attestPod makes an attempt to attest the artifacts of the completed pod, recording its progress in the annotations
+// of the pod. Failed attempts are retried with exponential backoff until the give up period has passed. Sinks that an
+// artifact has already been written to are not written to again.
+func (c *Controller) attestPod(ctx context.Context, pod *corev1.Pod, arts []*Artifact) (reconcile.Result, error) {
+	// Updates of the pod requeue it right away, so the backoff of a failed attempt is enforced here.
+	if wait := retryAfter(pod); wait > 0 {
+		return reconcile.Result{RequeueAfter: wait}, nil
+	}
+
+	if err := c.startAttempt(ctx, pod); err != nil {
+		return reconcile.Result{}, err
+	}
+	attempts := podAttempts(pod)
+
+	err := c.ProcessPod(ctx, pod, arts)
+	if err == nil {
+		return reconcile.Result{}, c.finishPod(ctx, pod, outcomeAttested)
+	}
+
+	c.log.Error(err, "Failed to process pod", "pod_name", pod.Name, "attempt", attempts)
+	if err := c.failAttempt(ctx, pod, err); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if c.gaveUp(pod) {
+		c.log.Info("Giving up attesting pod", "pod_name", pod.Name, "give_up_period", c.giveUpPeriod, "attempts", attempts)
+		delete(c.eventCache.Store, pod.Name)
+		return reconcile.Result{}, c.finishPod(ctx, pod, outcomeGaveUp)
+	}
+
+	delay := requeueDelay(attempts)
+	c.log.Info("Retrying attestation of pod", "pod_name", pod.Name, "attempt", attempts, "requeue_after", delay)
+
+	return reconcile.Result{RequeueAfter: delay}, nil
 }
 
 func (c *Controller) Run() error {
@@ -185,7 +550,15 @@ func (c *Controller) Run() error {
 	c.ctx, cancel = context.WithCancel(c.ctx)
 	defer cancel()
 
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 3)
+
+	go func() {
+		select {
+		case <-c.controllerManager.Elected():
+			c.log.Info("Elected leader, attesting pods")
+		case <-c.ctx.Done():
+		}
+	}()
 
 	go func() {
 		if err := c.eventCache.Start(); err != nil {
@@ -199,6 +572,12 @@ func (c *Controller) Run() error {
 		}
 	}()
 
+	go func() {
+		if err := c.watchConfig(c.ctx, c.reload); err != nil {
+			errChan <- fmt.Errorf("config watcher error: %w", err)
+		}
+	}()
+
 	// Wait for an error from any goroutine or both to complete
 	select {
 	case err := <-errChan:
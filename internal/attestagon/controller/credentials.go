@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
+	"github.com/google/go-containerregistry/pkg/authn"
+	kauth "github.com/google/go-containerregistry/pkg/authn/kubernetes"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// remoteOptions returns the options for accessing the registry of the artifact built by the pod. Registry credentials
+// are resolved from the following sources, in order, using the first that has credentials for the registry:
+//
+//  1. the kubernetes.io/dockerconfigjson Secret referenced by the artifact credentials,
+//  2. the imagePullSecrets of the pod and of its service account, if usePodCredentials is set,
+//  3. the Google, AWS ECR and Azure ACR keychains using workload identity, if cloudKeychains is set,
+//  4. the docker config of the controller at $DOCKER_CONFIG.
+//
+// The credentials of the controller, sources 3 and 4, are never used for the artifacts of ArtifactPolicies.
+func (c *Controller) remoteOptions(ctx context.Context, pod *corev1.Pod, art *Artifact) (image.RemoteOptions, error) {
+	var sources []image.KeychainSource
+
+	if ref := art.Credentials.SecretRef; ref != nil {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+
+		secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return image.RemoteOptions{}, fmt.Errorf("getting registry credentials secret %s/%s: %w", namespace, ref.Name, err)
+		}
+
+		kc, err := kauth.NewFromPullSecrets(ctx, []corev1.Secret{*secret})
+		if err != nil {
+			return image.RemoteOptions{}, fmt.Errorf("loading registry credentials secret %s/%s: %w", namespace, ref.Name, err)
+		}
+
+		sources = append(sources, image.KeychainSource{Name: fmt.Sprintf("secret %s/%s", namespace, ref.Name), Keychain: kc})
+	}
+
+	if art.Credentials.UsePodCredentials {
+		source, err := c.podKeychain(ctx, pod)
+		if err != nil {
+			return image.RemoteOptions{}, err
+		}
+		sources = append(sources, source)
+	}
+
+	controllerCredentials := art.Policy.Name == ""
+
+	if controllerCredentials && art.Credentials.CloudKeychains {
+		sources = append(sources,
+			image.KeychainSource{Name: "google", Keychain: google.Keychain},
+			image.KeychainSource{Name: "ecr", Keychain: authn.NewKeychainFromHelper(ecr.NewECRHelper(ecr.WithLogger(io.Discard)))},
+			image.KeychainSource{Name: "acr", Keychain: authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper())},
+		)
+	}
+
+	if controllerCredentials {
+		sources = append(sources, image.KeychainSource{Name: "docker config", Keychain: authn.DefaultKeychain})
+	}
+
+	transport, err := c.registryTransport(ctx, pod, art)
+	if err != nil {
+		return image.RemoteOptions{}, err
+	}
+
+	return image.RemoteOptions{
+		Keychain:  image.NewKeychain(c.log.WithName("keychain").WithValues("artifact", art.Name), sources...),
+		Transport: transport,
+		Insecure:  art.Transport.AllowInsecure,
+	}, nil
+}
+
+// podKeychain returns the keychain of the imagePullSecrets of the pod and of its service account.
+func (c *Controller) podKeychain(ctx context.Context, pod *corev1.Pod) (image.KeychainSource, error) {
+	var pullSecrets []string
+	for _, s := range pod.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, s.Name)
+	}
+
+	kc, err := kauth.New(ctx, c.clientset, kauth.Options{
+		Namespace:          pod.Namespace,
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+		ImagePullSecrets:   pullSecrets,
+	})
+	if err != nil {
+		return image.KeychainSource{}, fmt.Errorf("loading registry credentials of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+
+	return image.KeychainSource{Name: fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name), Keychain: kc}, nil
+}
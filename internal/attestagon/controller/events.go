@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// eventAttestationCreated is the reason of the event emitted when an artifact was attested.
+	eventAttestationCreated = "AttestationCreated"
+
+	// eventAttestationFailed is the reason of the event emitted when an artifact could not be attested.
+	eventAttestationFailed = "AttestationFailed"
+
+	// eventSubjectNotFound is the reason of the event emitted when no subject of an artifact could be found.
+	eventSubjectNotFound = "SubjectNotFound"
+
+	// eventPolicyViolation is the reason of the event emitted when the predicate of an artifact violates its rules.
+	eventPolicyViolation = "PolicyViolation"
+)
+
+const (
+	// digestAnnotation records the digests of the in-toto statements of the attestations of the pod.
+	digestAnnotation = "attestagon.io/attestation-digest"
+
+	// predicateTypeAnnotation records the predicate types of the attestations of the pod.
+	predicateTypeAnnotation = "attestagon.io/predicate-type"
+
+	// locationAnnotation records where the attestations of the pod were written to.
+	locationAnnotation = "attestagon.io/attestation-location"
+)
+
+// attestationResult describes the attestation of an artifact.
+type attestationResult struct {
+	// statementDigest is the sha256 digest of the in-toto statement.
+	statementDigest string
+
+	// predicateType is the predicate type of the in-toto statement.
+	predicateType string
+
+	// locations are the locations the attestation was written to keyed by sink name.
+	locations map[string]string
+
+	// verificationResult is the result recorded in a verification summary.
+	verificationResult string
+
+	// summary is the verification summary written alongside the attestation, if any.
+	summary *attestationResult
+}
+
+// locationList returns the locations of the attestation as sink=location pairs sorted by sink name.
+func (r *attestationResult) locationList() []string {
+	sinks := make([]string, 0, len(r.locations))
+	for s := range r.locations {
+		sinks = append(sinks, s)
+	}
+	sort.Strings(sinks)
+
+	list := make([]string, 0, len(sinks))
+	for _, s := range sinks {
+		list = append(list, s+"="+r.locations[s])
+	}
+
+	return list
+}
+
+// summaryEvent formats the message of the event emitted when the verification summary of an artifact was written.
+func summaryEvent(art string, summary *attestationResult) string {
+	return fmt.Sprintf("Verification summary sha256:%s of artifact %s with result %s written to %s",
+		summary.statementDigest, art, summary.verificationResult, strings.Join(summary.locationList(), ", "))
+}
+
+// event emits an event on the pod and on the controller owning the pod, such as a TaskRun or Job, if it has one.
+func (c *Controller) event(pod *corev1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.recorder == nil {
+		return
+	}
+
+	c.recorder.Eventf(pod, eventType, reason, messageFmt, args...)
+
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		ref := &corev1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			Namespace:  pod.Namespace,
+			UID:        owner.UID,
+		}
+		c.objectEvent(ref, eventType, reason, "Pod %s: %s", pod.Name, fmt.Sprintf(messageFmt, args...))
+	}
+}
+
+// objectEvent emits an event on the referenced object, such as the owner of aggregated pods.
+func (c *Controller) objectEvent(ref *corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.recorder == nil {
+		return
+	}
+
+	c.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// resultAnnotations returns the annotations recording the attestations of the pod, in the order of the artifacts.
+// Values of several artifacts are separated by commas.
+func resultAnnotations(results []*attestationResult) map[string]string {
+	var digests, predicateTypes, locations []string
+	for _, r := range results {
+		digests = append(digests, "sha256:"+r.statementDigest)
+		predicateTypes = append(predicateTypes, r.predicateType)
+		locations = append(locations, r.locationList()...)
+	}
+
+	return map[string]string{
+		digestAnnotation:        strings.Join(digests, ","),
+		predicateTypeAnnotation: strings.Join(predicateTypes, ","),
+		locationAnnotation:      strings.Join(locations, ","),
+	}
+}
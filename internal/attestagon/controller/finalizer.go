@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// attestationFinalizer keeps pods from being deleted before they have been attested.
+	attestationFinalizer = "attestagon.io/attestation"
+
+	// attestedAnnotation marks pods that attestagon has finished with.
+	attestedAnnotation = "attestagon.io/attested"
+
+	// outcomeAnnotation records how attestagon finished with a pod.
+	outcomeAnnotation = "attestagon.io/outcome"
+)
+
+const (
+	// outcomeAttested is recorded when every artifact of the pod was attested.
+	outcomeAttested = "attested"
+
+	// outcomeGaveUp is recorded when the pod could not be attested within the give up period.
+	outcomeGaveUp = "gave-up"
+
+	// outcomeNotCompleted is recorded when the pod failed or was deleted before it succeeded.
+	outcomeNotCompleted = "not-completed"
+
+	// outcomeAggregated is recorded when the pod was collected into the attestation of its owner.
+	outcomeAggregated = "aggregated"
+)
+
+// ensureFinalizer adds the attestation finalizer to the pod if it does not have it and marks the pod as pending.
+func (c *Controller) ensureFinalizer(ctx context.Context, pod *corev1.Pod) error {
+	if controllerutil.ContainsFinalizer(pod, attestationFinalizer) {
+		return nil
+	}
+
+	patch := pod.DeepCopy()
+	controllerutil.AddFinalizer(patch, attestationFinalizer)
+	if patch.Annotations[stateAnnotation] == "" {
+		if patch.Annotations == nil {
+			patch.Annotations = make(map[string]string)
+		}
+		patch.Annotations[stateAnnotation] = statePending
+	}
+
+	return c.client.Patch(ctx, patch, runtimeclient.MergeFromWithOptions(pod, runtimeclient.MergeFromWithOptimisticLock{}))
+}
+
+// finishPod records the outcome on the pod, marks it as attested and removes the attestation finalizer so that the pod
+// can be deleted. If every artifact of the pod was attested, the state of the pod becomes pushed.
+func (c *Controller) finishPod(ctx context.Context, pod *corev1.Pod, outcome string) error {
+	c.log.Info("Finished with pod", "pod_name", pod.Name, "outcome", outcome)
+
+	patch := pod.DeepCopy()
+	if patch.Annotations == nil {
+		patch.Annotations = make(map[string]string)
+	}
+	patch.Annotations[attestedAnnotation] = "true"
+	patch.Annotations[outcomeAnnotation] = outcome
+	if outcome == outcomeAttested {
+		patch.Annotations[stateAnnotation] = statePushed
+		delete(patch.Annotations, reasonAnnotation)
+	}
+	controllerutil.RemoveFinalizer(patch, attestationFinalizer)
+
+	return c.client.Patch(ctx, patch, runtimeclient.MergeFromWithOptions(pod, runtimeclient.MergeFromWithOptimisticLock{}))
+}
+
+// gaveUp returns true if the pod finished longer ago than the give up period.
+func (c *Controller) gaveUp(pod *corev1.Pod) bool {
+	return time.Since(podFinishedAt(pod)) > c.giveUpPeriod
+}
+
+// podFinishedAt returns the time the last container of the pod terminated, or the creation time of the pod if no
+// container has terminated.
+func podFinishedAt(pod *corev1.Pod) time.Time {
+	finishedAt := pod.CreationTimestamp.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if t := status.State.Terminated; t != nil && t.FinishedAt.Time.After(finishedAt) {
+			finishedAt = t.FinishedAt.Time
+		}
+	}
+
+	return finishedAt
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// testDeletionRaces deletes pods building an artifact at different stages of their attestation and checks that the
+// attestation finalizer keeps every pod around until it has been attested or attestagon gave up on it. The controller
+// must have testSigner available.
+func testDeletionRaces(t *testing.T, c *Controller) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		phase corev1.PodPhase
+
+		// resolvers are the subject resolvers of the artifact, which fail to find a subject unless the annotation
+		// resolver is used.
+		resolvers    []string
+		finishedAgo  time.Duration
+		giveUpPeriod time.Duration
+
+		wantDeleted     bool
+		wantAttestation bool
+	}{
+		{
+			name:        "deleted while running",
+			phase:       corev1.PodRunning,
+			wantDeleted: true,
+		},
+		{
+			name:            "deleted before it was attested",
+			phase:           corev1.PodSucceeded,
+			resolvers:       []string{"annotation"},
+			giveUpPeriod:    time.Hour,
+			wantDeleted:     true,
+			wantAttestation: true,
+		},
+		{
+			name:        "failed build deleted",
+			phase:       corev1.PodFailed,
+			resolvers:   []string{"annotation"},
+			wantDeleted: true,
+		},
+		{
+			name:         "deleted while attestation fails",
+			phase:        corev1.PodSucceeded,
+			resolvers:    []string{"kaniko"},
+			giveUpPeriod: time.Hour,
+		},
+		{
+			name:         "deleted after the give up period",
+			phase:        corev1.PodSucceeded,
+			resolvers:    []string{"kaniko"},
+			finishedAgo:  2 * time.Hour,
+			giveUpPeriod: time.Hour,
+			wantDeleted:  true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c.giveUpPeriod = tt.giveUpPeriod
+			c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{{
+				Name:     "app",
+				Subjects: SubjectConfig{Resolvers: tt.resolvers},
+				Signer:   testSigner,
+				Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: dir}}},
+			}}})
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "build-" + string(rune('a'+i)),
+					Namespace: "builds",
+					Annotations: map[string]string{
+						artifactAnnotation:       "app",
+						subject.DigestAnnotation: "sha256:" + strings.Repeat("a", 64),
+					},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "build", Image: "gcr.io/kaniko-project/executor"}}},
+			}
+			if err := c.client.Create(ctx, pod); err != nil {
+				t.Fatal(err)
+			}
+			request := reconcile.Request{NamespacedName: runtimeclient.ObjectKeyFromObject(pod)}
+
+			// The finalizer is added while the pod is pending.
+			if _, err := c.Reconcile(ctx, request); err != nil {
+				t.Fatalf("Reconcile() of the pending pod error = %v", err)
+			}
+			if err := c.client.Get(ctx, request.NamespacedName, pod); err != nil {
+				t.Fatal(err)
+			}
+			if !controllerutil.ContainsFinalizer(pod, attestationFinalizer) || pod.Annotations[stateAnnotation] != statePending {
+				t.Fatalf("pending pod has finalizers %v and state %q, want the attestation finalizer", pod.Finalizers, pod.Annotations[stateAnnotation])
+			}
+
+			// The pod completes and is deleted before attestagon sees it completed.
+			status := corev1.ContainerStatus{Name: "build", Image: "gcr.io/kaniko-project/executor"}
+			if tt.phase == corev1.PodRunning {
+				status.State.Running = &corev1.ContainerStateRunning{StartedAt: metav1.Now()}
+			} else {
+				finishedAt := metav1.NewTime(time.Now().Add(-tt.finishedAgo).Truncate(time.Second))
+				status.State.Terminated = &corev1.ContainerStateTerminated{StartedAt: finishedAt, FinishedAt: finishedAt}
+				if tt.phase == corev1.PodFailed {
+					status.State.Terminated.ExitCode = 1
+				}
+			}
+			pod.Status = corev1.PodStatus{Phase: tt.phase, ContainerStatuses: []corev1.ContainerStatus{status}}
+			if err := c.client.Status().Update(ctx, pod); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.client.Delete(ctx, pod); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := c.Reconcile(ctx, request)
+			if err != nil {
+				t.Fatalf("Reconcile() of the deleted pod error = %v", err)
+			}
+
+			err = c.client.Get(ctx, request.NamespacedName, pod)
+			switch {
+			case tt.wantDeleted && !errors.IsNotFound(err):
+				t.Errorf("pod was kept with finalizers %v and annotations %v, want it deleted", pod.Finalizers, pod.Annotations)
+			case !tt.wantDeleted && err != nil:
+				t.Errorf("getting the pod: %v, want it kept until it is attested", err)
+			case !tt.wantDeleted:
+				if !controllerutil.ContainsFinalizer(pod, attestationFinalizer) || pod.Annotations[stateAnnotation] != stateFailed {
+					t.Errorf("kept pod has finalizers %v and state %q, want the finalizer and a failed attempt", pod.Finalizers, pod.Annotations[stateAnnotation])
+				}
+				if result.RequeueAfter == 0 {
+					t.Error("Reconcile() did not requeue the failed attempt")
+				}
+			}
+
+			if files := sinkFiles(t, dir); (len(files) == 1) != tt.wantAttestation || len(files) > 1 {
+				t.Errorf("sink has attestations %v, want attestation %v", files, tt.wantAttestation)
+			}
+
+			// Pods that are gone are ignored.
+			if tt.wantDeleted {
+				if _, err := c.Reconcile(ctx, request); err != nil {
+					t.Errorf("Reconcile() of the gone pod error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileDeletion(t *testing.T) {
+	testDeletionRaces(t, testController(t))
+}
+
+func TestReconcileDeletionEnvtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, see https://book.kubebuilder.io/reference/envtest")
+	}
+
+	deploy := filepath.Join("..", "..", "..", "deploy")
+	env := &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join(deploy, "attestagon.io_artifactpolicies.yaml"),
+			filepath.Join(deploy, "attestagon.io_attestations.yaml"),
+		},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := env.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client, err := runtimeclient.New(cfg, runtimeclient.Options{Scheme: testScheme(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, namespace := range []string{testSigner.KeySecretRef.Namespace, "builds"} {
+		if err := client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Create(ctx, testSignerSecret(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	testDeletionRaces(t, newTestController(client, clientset))
+
+	// Only the pod whose attestation keeps failing is left, waiting for its finalizer to be removed.
+	var pods corev1.PodList
+	if err := client.List(ctx, &pods, runtimeclient.InNamespace("builds")); err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			t.Errorf("pod %s was not deleted", types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+		}
+	}
+}
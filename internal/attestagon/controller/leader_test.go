@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	runtimecache "sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllertest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// memoryLock is a leader election lock shared by the replicas of a test, which stands in for the Lease in the cluster.
+type memoryLock struct {
+	mu     *sync.Mutex
+	record **resourcelock.LeaderElectionRecord
+
+	identity string
+}
+
+// newMemoryLocks returns a lock for each of the identities, all guarding the same record.
+func newMemoryLocks(identities ...string) []*memoryLock {
+	var (
+		mu     sync.Mutex
+		record *resourcelock.LeaderElectionRecord
+	)
+
+	locks := make([]*memoryLock, len(identities))
+	for i, identity := range identities {
+		locks[i] = &memoryLock{mu: &mu, record: &record, identity: identity}
+	}
+
+	return locks
+}
+
+func (l *memoryLock) Get(context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.record == nil {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "attestagon")
+	}
+	record := **l.record
+
+	return &record, []byte(record.HolderIdentity + record.RenewTime.String()), nil
+}
+
+func (l *memoryLock) Create(_ context.Context, record resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.record != nil {
+		return apierrors.NewAlreadyExists(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "attestagon")
+	}
+	*l.record = &record
+
+	return nil
+}
+
+func (l *memoryLock) Update(_ context.Context, record resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	*l.record = &record
+
+	return nil
+}
+
+func (l *memoryLock) RecordEvent(string) {}
+
+func (l *memoryLock) Identity() string { return l.identity }
+
+func (l *memoryLock) Describe() string { return "memory/attestagon" }
+
+// podInformers are fake informers sharing a pod informer between the replicas of a test, which stands in for the pods
+// in the cluster.
+type podInformers struct {
+	*informertest.FakeInformers
+	pods *podInformer
+}
+
+func (i *podInformers) GetInformer(context.Context, runtimeclient.Object, ...runtimecache.InformerGetOption) (runtimecache.Informer, error) {
+	return i.pods, nil
+}
+
+// podInformer is a fake informer that events can be sent to while the replicas add their handlers.
+type podInformer struct {
+	*controllertest.FakeInformer
+	mu sync.Mutex
+}
+
+func (i *podInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.FakeInformer.AddEventHandler(handler)
+}
+
+// Add sends an add event for the pod to the handlers of the replicas.
+func (i *podInformer) Add(pod *corev1.Pod) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.FakeInformer.Add(pod)
+}
+
+// replica is a controller running in a manager with leader election, like one of the replicas of the deployment.
+type replica struct {
+	c       *Controller
+	mgr     manager.Manager
+	dir     string
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// startReplica starts a controller with the lock whose pod controller shares the informers and the client with the
+// other replicas. The artifact of the replica writes to its own directory, which tells apart the replicas that pushed.
+func startReplica(t *testing.T, lock *memoryLock, informers *podInformers, client runtimeclient.Client, c *Controller) *replica {
+	t.Helper()
+
+	leaseDuration, renewDeadline, retryPeriod := time.Second, 500*time.Millisecond, 50*time.Millisecond
+	mgr, err := manager.New(&rest.Config{Host: "https://127.0.0.1:1"}, manager.Options{
+		Scheme:                              informers.Scheme,
+		Metrics:                             metricsserver.Options{BindAddress: "0"},
+		LeaderElection:                      true,
+		LeaderElectionResourceLockInterface: lock,
+		LeaderElectionReleaseOnCancel:       true,
+		LeaseDuration:                       &leaseDuration,
+		RenewDeadline:                       &renewDeadline,
+		RetryPeriod:                         &retryPeriod,
+		NewCache: func(*rest.Config, runtimecache.Options) (runtimecache.Cache, error) {
+			return informers, nil
+		},
+		NewClient: func(*rest.Config, runtimeclient.Options) (runtimeclient.Client, error) {
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &replica{c: c, mgr: mgr, dir: t.TempDir(), stopped: make(chan struct{})}
+	c.controllerManager = mgr
+	c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{{
+		Name:     "app",
+		Subjects: SubjectConfig{Resolvers: []string{"annotation"}},
+		Signer:   testSigner,
+		Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: r.dir}}},
+	}}})
+	if err := c.setupWithManager(mgr); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx context.Context
+	ctx, r.stop = context.WithCancel(context.Background())
+	go func() {
+		defer close(r.stopped)
+		if err := mgr.Start(ctx); err != nil {
+			t.Errorf("starting manager of %s: %v", lock.Identity(), err)
+		}
+	}()
+	t.Cleanup(func() {
+		r.stop()
+		<-r.stopped
+	})
+
+	return r
+}
+
+// elected returns whether the replica is the leader.
+func (r *replica) elected() bool {
+	select {
+	case <-r.mgr.Elected():
+		return true
+	default:
+		return false
+	}
+}
+
+// testBuildPod creates a succeeded pod building the artifact of the replicas.
+func testBuildPod(t *testing.T, client runtimeclient.Client, name string) *corev1.Pod {
+	t.Helper()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "builds",
+			Annotations: map[string]string{
+				artifactAnnotation:       "app",
+				subject.DigestAnnotation: "sha256:" + strings.Repeat("a", 64),
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+	if err := client.Create(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+
+	return pod
+}
+
+// sendPodEvents sends events for the pod to the replicas for the duration or until it has been attested, returning
+// whether it was attested.
+func sendPodEvents(t *testing.T, informer *podInformer, client runtimeclient.Client, pod *corev1.Pod, d time.Duration) bool {
+	t.Helper()
+	ctx := context.Background()
+
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		informer.Add(pod)
+
+		if err := client.Get(ctx, runtimeclient.ObjectKeyFromObject(pod), pod); err != nil {
+			t.Fatal(err)
+		}
+		if pod.Annotations[attestedAnnotation] == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestLeaderElection(t *testing.T) {
+	locks := newMemoryLocks("replica-a", "replica-b")
+	c := testController(t)
+	informers := &podInformers{
+		FakeInformers: &informertest.FakeInformers{Scheme: testScheme(t)},
+		pods:          &podInformer{FakeInformer: &controllertest.FakeInformer{Synced: true}},
+	}
+
+	a := startReplica(t, locks[0], informers, c.client, newTestController(c.client, c.clientset))
+	for deadline := time.Now().Add(10 * time.Second); !a.elected(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("replica-a was not elected")
+		}
+	}
+	b := startReplica(t, locks[1], informers, c.client, newTestController(c.client, c.clientset))
+
+	// While the leader does not attest the artifact, nothing attests the pod.
+	config := a.c.config()
+	a.c.runtimeConfig.Store(&runtimeConfig{})
+	pod := testBuildPod(t, c.client, "build-1")
+	if sendPodEvents(t, informers.pods, c.client, pod, time.Second) {
+		t.Fatal("pod was attested by a replica that is not the leader")
+	}
+	if b.elected() {
+		t.Fatal("replica-b was elected while replica-a holds the lock")
+	}
+
+	a.c.runtimeConfig.Store(config)
+	if !sendPodEvents(t, informers.pods, c.client, pod, 10*time.Second) {
+		t.Fatal("pod was not attested by the leader")
+	}
+	if got := sinkFiles(t, a.dir); len(got) != 1 {
+		t.Errorf("leader wrote attestations %v, want 1", got)
+	}
+	if got := sinkFiles(t, b.dir); len(got) != 0 {
+		t.Errorf("follower wrote attestations %v, want none", got)
+	}
+
+	// Once the leader stops, the other replica takes over.
+	a.stop()
+	<-a.stopped
+	if !sendPodEvents(t, informers.pods, c.client, testBuildPod(t, c.client, "build-2"), 10*time.Second) {
+		t.Fatal("pod was not attested after the leader stopped")
+	}
+	if !b.elected() {
+		t.Error("replica-b attested a pod without being elected")
+	}
+	if got := sinkFiles(t, a.dir); len(got) != 1 {
+		t.Errorf("stopped replica wrote attestations %v, want only the first", got)
+	}
+	if got := sinkFiles(t, b.dir); len(got) != 1 {
+		t.Errorf("new leader wrote attestations %v, want 1", got)
+	}
+}
@@ -2,72 +2,178 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
 
-	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
 	_ "github.com/in-toto/go-witness/signer/kms/aws"
 	_ "github.com/in-toto/go-witness/signer/kms/gcp"
 	"github.com/in-toto/in-toto-golang/in_toto"
-	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	corev1 "k8s.io/api/core/v1"
 )
 
-func (c *Controller) ProcessPod(ctx context.Context, pod *corev1.Pod, art *Artifact) error {
-	for i := 0; i < len(c.artifacts); i++ {
-		fmt.Println("Processing pod", pod.Name)
+// ProcessPod generates, signs and writes exactly one attestation for each artifact built by the pod. Every artifact is
+// attempted even if an earlier one fails, and the errors of all failed artifacts are returned together. The cached
+// events of the pod are kept if any artifact fails so that it can be retried.
+func (c *Controller) ProcessPod(ctx context.Context, pod *corev1.Pod, arts []*Artifact) error {
+	c.log.Info("Processing pod", "pod_name", pod.Name, "artifacts", len(arts))
 
-		// NOTE: I get a sense that we should be taking it now. Technically more events could come but :shrug:
-		// Also we have already assembled the predicate while caching. This may make no sense and we might have to revisit.
-		predicate := c.eventCache.Store[pod.Name]
+	// NOTE: I get a sense that we should be taking it now. Technically more events could come but :shrug:
+	// Also we have already assembled the predicate while caching. This may make no sense and we might have to revisit.
+	predicate := c.eventCache.Store[pod.Name]
 
-		digest, err := image.FindImageDigest(pod)
-		if err != nil {
-			c.log.Error(err, "Failed to get image digest from pod: ")
-		}
+	written := podWritten(pod)
 
-		dig := strings.Split(digest, ":")
-		if len(dig) != 2 {
-			return errors.New("invalid digest")
+	var (
+		errs    []error
+		gitoids []string
+		results []*attestationResult
+	)
+	for _, art := range arts {
+		result, err := c.processArtifact(ctx, pod, predicate, art, written[art.Name], written[summaryKey(art.Name)])
+		if result != nil && len(result.locations) > 0 {
+			written[art.Name] = result.locations
+			for key, location := range result.locations {
+				if strings.HasPrefix(key, "archivista:") {
+					gitoids = append(gitoids, location)
+				}
+			}
+		}
+		if result != nil && result.summary != nil && len(result.summary.locations) > 0 {
+			written[summaryKey(art.Name)] = result.summary.locations
 		}
 
-		statement := in_toto.Statement{
-			StatementHeader: in_toto.StatementHeader{
-				Type:          "https://in-toto.io/Statement/v0.1",
-				PredicateType: "https://attestagon.io/provenance/v0.1",
-				Subject:       []in_toto.Subject{{Name: art.Name, Digest: common.DigestSet{dig[0]: dig[1]}}},
-			},
-			Predicate: predicate,
+		switch {
+		case errors.Is(err, subject.ErrNotFound):
+			c.event(pod, corev1.EventTypeWarning, eventSubjectNotFound, "No subject of artifact %s found: %v", art.Name, err)
+		case err != nil:
+			c.event(pod, corev1.EventTypeWarning, eventAttestationFailed, "Failed to attest artifact %s: %v", art.Name, err)
+		default:
+			c.event(pod, corev1.EventTypeNormal, eventAttestationCreated, "Attestation sha256:%s of artifact %s with predicate type %s written to %s",
+				result.statementDigest, art.Name, result.predicateType, strings.Join(result.locationList(), ", "))
+			if result.summary != nil {
+				c.event(pod, corev1.EventTypeNormal, eventAttestationCreated, "%s", summaryEvent(art.Name, result.summary))
+			}
+			results = append(results, result)
 		}
 
-		statementMarshaled, err := json.Marshal(statement)
 		if err != nil {
-			return errors.Join(err, fmt.Errorf("failed to marshal statement to json"))
+			c.log.Error(err, "Failed to attest artifact", "pod_name", pod.Name, "artifact", art.Name)
+			errs = append(errs, fmt.Errorf("artifact %q: %w", art.Name, err))
 		}
+	}
 
-		os.WriteFile(fmt.Sprintf("./%s-statement.json", art.Name), statementMarshaled, 0644)
-
-		imageRef := fmt.Sprintf("%s@%s", art.Ref, digest)
-		c.log.Info("Signing and pushing attestation", "reference", imageRef)
-
-		if c.signerConfig.KMSRef != "" {
-			c.log.Info("KMS signing not implemented yet for non-witness mode")
-		} else if c.signerConfig.PrivateKeyPath != "" {
-			err = image.SignAndPush(ctx, statement, imageRef, c.signerConfig.PrivateKeyPath)
-			if err != nil {
-				c.log.Error(err, "Failed to sign and push image: ")
-				return fmt.Errorf("error signing and pushing image: %s", err.Error())
-			} else {
-				return errors.New("no signer configuration provided")
+	if len(written) > 0 {
+		annotations := make(map[string]string)
+		if raw, err := json.Marshal(written); err == nil {
+			annotations[writtenAnnotation] = string(raw)
+		}
+		if len(gitoids) > 0 {
+			annotations["attestagon.io/archivista-gitoid"] = strings.Join(gitoids, ",")
+		}
+		if len(errs) == 0 {
+			for k, v := range resultAnnotations(results) {
+				annotations[k] = v
 			}
 		}
 
-		c.log.Info("Deleting pod from cache", "pod_name", pod.Name)
-		delete(c.eventCache.Store, pod.Name)
+		// Not recording the written sinks would write the attestations again on retry, so this fails the attempt.
+		if err := c.annotatePod(ctx, pod, annotations); err != nil {
+			c.log.Error(err, "Failed to record written sinks on pod")
+			errs = append(errs, err)
+		}
 	}
 
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	c.log.Info("Deleting pod from cache", "pod_name", pod.Name)
+	delete(c.eventCache.Store, pod.Name)
+
 	return nil
 }
+
+// processArtifact generates, signs and writes the attestation for a single artifact built by the pod, returning the
+// digest of the statement and the locations it was written to. Sinks in written already have the attestation and are
+// skipped, as are sinks in writtenSummary for the verification summary.
+func (c *Controller) processArtifact(ctx context.Context, pod *corev1.Pod, cached *predicate.Predicate, art *Artifact, written, writtenSummary map[string]string) (*attestationResult, error) {
+	signerOpts, err := c.signerOptions(ctx, art)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := pod.Status.Phase == corev1.PodFailed
+
+	subjects, err := c.resolveSubjects(ctx, pod, art)
+	if err != nil && !(failed && errors.Is(err, subject.ErrNotFound)) {
+		return nil, fmt.Errorf("failed to resolve subjects of pod: %w", err)
+	}
+
+	// A failed build may not have produced anything, in which case the pod itself is the subject.
+	if len(subjects) == 0 {
+		subjects = []subject.Subject{podSubject(pod)}
+	}
+
+	// The cached predicate is shared by every artifact of the pod, so the outcome is set on a copy.
+	var pred predicate.Predicate
+	if cached != nil {
+		pred = *cached
+	}
+	outcome := predicate.OutcomeFromPod(pod)
+	pred.Outcome = &outcome
+
+	predicateType := predicate.ProvenanceType
+	if failed {
+		predicateType = predicate.FailedBuildType
+	}
+
+	var report policy.Report
+	if art.engine != nil && !failed {
+		report = art.engine.Evaluate(&pred)
+		if !report.Passed() {
+			c.log.Info("Predicate violates the rules of the artifact", "artifact", art.Name, "violations", report.String())
+			c.event(pod, corev1.EventTypeWarning, eventPolicyViolation, "Artifact %s violates its rules: %s", art.Name, report)
+		}
+	}
+
+	statement := in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v0.1",
+			PredicateType: predicateType,
+		},
+		Predicate: &pred,
+	}
+
+	c.log.Info("Signing and writing attestation", "artifact", art.Name, "subjects", len(subjects))
+
+	result, err := c.attest(ctx, pod, statement, subjects, art, signerOpts, written)
+	if err != nil {
+		return result, fmt.Errorf("error signing and writing attestation: %w", err)
+	}
+
+	if art.attestSummary() && !failed {
+		result.summary, err = c.attestSummary(ctx, pod, art, subjects, signerOpts, result, report, writtenSummary)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// podSubject returns a subject identifying the pod, used for failed builds that did not produce any subjects.
+func podSubject(pod *corev1.Pod) subject.Subject {
+	sum := sha256.Sum256([]byte(pod.UID))
+	return subject.Subject{
+		Name:   fmt.Sprintf("pod:%s/%s", pod.Namespace, pod.Name),
+		Digest: subject.DigestSet{"sha256": hex.EncodeToString(sum[:])},
+		Type:   subject.TypeFile,
+	}
+}
@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/cache"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	attestagonv1alpha1 "github.com/chaosinthecrd/attestagon/pkg/apis/attestagon/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	runtimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testSigner is the Secret key holding the private key the artifacts of the tests are signed with.
+var testSigner = &ArtifactSigner{KeySecretRef: SecretKeyReference{Name: "signer", Namespace: "attestagon", Key: "cosign.key"}}
+
+// testSignerSecret returns the Secret holding a new private key for testSigner.
+func testSignerSecret(t *testing.T) *corev1.Secret {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSigner.KeySecretRef.Name, Namespace: testSigner.KeySecretRef.Namespace},
+		Data:       map[string][]byte{testSigner.KeySecretRef.Key: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})},
+	}
+}
+
+// testScheme returns a scheme with the Kubernetes and attestagon types.
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, attestagonv1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return scheme
+}
+
+// newTestController returns a controller using the clients with an empty configuration.
+func newTestController(client runtimeclient.Client, clientset kubernetes.Interface) *Controller {
+	c := &Controller{
+		ctx:        context.Background(),
+		log:        logr.Discard(),
+		clientset:  clientset,
+		cache:      client,
+		client:     client,
+		eventCache: &cache.EventCache{Store: make(map[string]*predicate.Predicate)},
+		recorder:   record.NewFakeRecorder(100),
+		aggregates: make(map[string]*aggregate),
+		aggregated: make(map[string]time.Time),
+	}
+	c.runtimeConfig.Store(&runtimeConfig{})
+
+	return c
+}
+
+// testController returns a controller backed by fake clients holding the objects, with a Secret holding the private
+// key of testSigner and an empty configuration.
+func testController(t *testing.T, objects ...runtimeclient.Object) *Controller {
+	t.Helper()
+
+	client := runtimefake.NewClientBuilder().
+		WithScheme(testScheme(t)).
+		WithObjects(objects...).
+		WithStatusSubresource(&corev1.Pod{}, &attestagonv1alpha1.Attestation{}).
+		Build()
+
+	return newTestController(client, fake.NewSimpleClientset(testSignerSecret(t)))
+}
+
+// pushImage pushes a random image to the repository, returning its digest reference.
+func pushImage(t *testing.T, repository string) name.Digest {
+	t.Helper()
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(repository + ":latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref.Context().Digest(h.String())
+}
+
+// sinkFiles returns the names of the attestations written to the directory of a filesystem sink.
+func sinkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+
+	return files
+}
+
+func TestPodArtifactAnnotations(t *testing.T) {
+	policy := &attestagonv1alpha1.ArtifactPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "docs", Namespace: "builds"},
+		Spec: attestagonv1alpha1.ArtifactPolicySpec{
+			Selector: &attestagonv1alpha1.PodSelector{LabelSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "docs"}}},
+			Signer:   &attestagonv1alpha1.Signer{KeySecretRef: attestagonv1alpha1.KeySelector{Name: "signer", Key: "cosign.key"}},
+		},
+	}
+	// Policies must sign with their own key.
+	unsigned := &attestagonv1alpha1.ArtifactPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "unsigned", Namespace: "builds"},
+		Spec:       attestagonv1alpha1.ArtifactPolicySpec{Selector: &attestagonv1alpha1.PodSelector{LabelSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "docs"}}}},
+	}
+	c := testController(t, policy, unsigned)
+	c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{{Name: "api"}, {Name: "worker"}, {Name: "chart"}}})
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+
+		want []string
+	}{
+		{
+			name:        "single artifact",
+			annotations: map[string]string{artifactAnnotation: "api"},
+			want:        []string{"api"},
+		},
+		{
+			name:        "comma separated artifacts",
+			annotations: map[string]string{artifactAnnotation: "worker, api"},
+			want:        []string{"worker", "api"},
+		},
+		{
+			name:        "artifacts list comes first",
+			annotations: map[string]string{artifactsAnnotation: `["chart","api"]`, artifactAnnotation: "worker"},
+			want:        []string{"chart", "api", "worker"},
+		},
+		{
+			name:        "duplicate artifacts are attested once",
+			annotations: map[string]string{artifactsAnnotation: `["api"]`, artifactAnnotation: "api,api"},
+			want:        []string{"api"},
+		},
+		{
+			name:        "unknown artifacts are ignored",
+			annotations: map[string]string{artifactAnnotation: "missing,api"},
+			want:        []string{"api"},
+		},
+		{
+			name:        "invalid artifacts list",
+			annotations: map[string]string{artifactsAnnotation: "api", artifactAnnotation: "worker"},
+			want:        []string{"worker"},
+		},
+		{
+			name:        "artifact of a policy",
+			labels:      map[string]string{"app": "docs"},
+			annotations: map[string]string{artifactAnnotation: "api,docs"},
+			want:        []string{"api", "docs"},
+		},
+		{
+			name:        "policy without signer",
+			labels:      map[string]string{"app": "docs"},
+			annotations: map[string]string{artifactAnnotation: "unsigned"},
+			want:        []string{"docs"},
+		},
+		{
+			name:        "pod not selected by the policy",
+			labels:      map[string]string{"app": "api"},
+			annotations: map[string]string{artifactAnnotation: "api,docs"},
+			want:        []string{"api"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "builds", Labels: tt.labels, Annotations: tt.annotations},
+			}
+
+			arts, err := c.podArtifacts(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("podArtifacts() error = %v", err)
+			}
+
+			var got []string
+			for _, art := range arts {
+				got = append(got, art.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podArtifacts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPodArtifacts(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	repository := strings.TrimPrefix(srv.URL, "http://") + "/example/app"
+	digest := pushImage(t, repository)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "build",
+			Namespace:   "builds",
+			UID:         "0b3c1f0e-6b7a-4c3e-9d2a-5f8e7c6b5a49",
+			Annotations: map[string]string{subject.DigestAnnotation: digest.DigestStr()},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+
+	// The image is found through the pod annotation and the binary through the manifest on the shared volume, nothing
+	// is found for the chart.
+	volume := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(volume, pod.Namespace, pod.Name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"subjects":[{"name":"cli_linux_amd64","digest":{"sha256":"` + strings.Repeat("c", 64) + `"}}]}`
+	if err := os.WriteFile(filepath.Join(volume, pod.Namespace, pod.Name, subject.ManifestFile), []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	appDir, cliDir, chartDir := t.TempDir(), t.TempDir(), t.TempDir()
+	arts := []*Artifact{
+		{
+			Name:     "app",
+			Ref:      repository,
+			Subjects: SubjectConfig{Resolvers: []string{"annotation"}},
+			Signer:   testSigner,
+			Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: appDir}}},
+		},
+		{
+			Name:     "cli",
+			Subjects: SubjectConfig{Resolvers: []string{"manifest"}},
+			Signer:   testSigner,
+			Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: cliDir}}},
+		},
+		{
+			Name:     "chart",
+			Subjects: SubjectConfig{Resolvers: []string{"kaniko"}},
+			Signer:   testSigner,
+			Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: chartDir}}},
+		},
+	}
+
+	c := testController(t, pod)
+	c.subjectVolumePath = volume
+	c.eventCache.Store[pod.Name] = &predicate.Predicate{}
+
+	// The chart keeps failing, which must neither stop the other artifacts from being attested nor write them again
+	// when the pod is retried. The sinks are emptied after the first attempt, so anything written again shows up.
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := c.ProcessPod(ctx, pod, arts)
+		if !errors.Is(err, subject.ErrNotFound) || !strings.Contains(err.Error(), `artifact "chart"`) {
+			t.Fatalf("attempt %d: ProcessPod() error = %v, want the chart subject not to be found", attempt, err)
+		}
+		if strings.Contains(err.Error(), `artifact "app"`) || strings.Contains(err.Error(), `artifact "cli"`) {
+			t.Errorf("attempt %d: ProcessPod() error = %v, want only the chart to fail", attempt, err)
+		}
+		if _, ok := c.eventCache.Store[pod.Name]; !ok {
+			t.Errorf("attempt %d: events of the pod were dropped although an artifact failed", attempt)
+		}
+
+		want := map[string]int{appDir: 1, cliDir: 1, chartDir: 0}
+		if attempt > 1 {
+			want = map[string]int{appDir: 0, cliDir: 0, chartDir: 0}
+		}
+		for dir, n := range want {
+			files := sinkFiles(t, dir)
+			if len(files) != n {
+				t.Errorf("attempt %d: filesystem sink %s has attestations %v, want %d", attempt, dir, files, n)
+			}
+			for _, file := range files {
+				if err := os.Remove(filepath.Join(dir, file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	attestations, err := remote.Image(digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + ".att"))
+	if err != nil {
+		t.Fatalf("fetching the attestations of the image: %v", err)
+	}
+	layers, err := attestations.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Errorf("image has %d attestations, want 1", len(layers))
+	}
+
+	var written map[string]map[string]string
+	if err := json.Unmarshal([]byte(pod.Annotations[writtenAnnotation]), &written); err != nil {
+		t.Fatalf("parsing written annotation: %v", err)
+	}
+	if len(written["app"]) != 2 || len(written["cli"]) != 1 || len(written["chart"]) != 0 {
+		t.Errorf("written annotation = %v, want the image and filesystem sink of app and the filesystem sink of cli", written)
+	}
+
+	var records attestagonv1alpha1.AttestationList
+	if err := c.client.List(ctx, &records, runtimeclient.InNamespace(pod.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := make(map[string]int)
+	for _, record := range records.Items {
+		artifacts[record.Spec.Artifact]++
+	}
+	if len(records.Items) != 2 || artifacts["app"] != 1 || artifacts["cli"] != 1 {
+		t.Errorf("Attestation resources of artifacts %v, want one for app and one for cli", artifacts)
+	}
+
+	// Once the chart is attested the pod is done and its events are dropped.
+	arts[2].Subjects.Resolvers = []string{"manifest"}
+	if err := c.ProcessPod(ctx, pod, arts); err != nil {
+		t.Fatalf("ProcessPod() error = %v", err)
+	}
+	if len(sinkFiles(t, appDir)) != 0 || len(sinkFiles(t, cliDir)) != 0 || len(sinkFiles(t, chartDir)) != 1 {
+		t.Error("want only the chart attestation to be written")
+	}
+	if _, ok := c.eventCache.Store[pod.Name]; ok {
+		t.Error("events of the pod were kept after every artifact was attested")
+	}
+}
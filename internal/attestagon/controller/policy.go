@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	attestagonv1alpha1 "github.com/chaosinthecrd/attestagon/pkg/apis/attestagon/v1alpha1"
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ArtifactPolicyConfig restricts what ArtifactPolicies may configure, as policies are created by the teams of a
+// namespace rather than by the administrators of the controller.
+type ArtifactPolicyConfig struct {
+	// Repositories are the image repositories policies may attach attestations to, e.g. ghcr.io/example/app. A pattern
+	// ending in * matches every repository starting with the pattern, and {namespace} is replaced with the namespace of
+	// the policy. Policies whose ref or subject references are not matched are ignored, so that without repositories
+	// policies can only write to their sinks.
+	Repositories []string `yaml:"repositories"`
+
+	// AllowInsecure allows policies to set transport.allowInsecure.
+	AllowInsecure bool `yaml:"allowInsecure"`
+}
+
+// validate returns an error if a repository pattern is malformed.
+func (p ArtifactPolicyConfig) validate() error {
+	for _, pattern := range p.Repositories {
+		if pattern == "" {
+			return errors.New("empty repository pattern")
+		}
+		if strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+			return fmt.Errorf("repository pattern %q may only end in *", pattern)
+		}
+	}
+
+	return nil
+}
+
+// allowRepository returns an error unless the repository of ref is allowed for policies in the namespace.
+func (p ArtifactPolicyConfig) allowRepository(ref, namespace string) error {
+	repo, err := name.NewRepository(ref)
+	if err != nil {
+		return fmt.Errorf("parsing repository %q: %w", ref, err)
+	}
+
+	for _, pattern := range p.Repositories {
+		pattern = strings.ReplaceAll(pattern, "{namespace}", namespace)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(repo.Name(), prefix) {
+				return nil
+			}
+		} else if repo.Name() == pattern {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("repository %s is not allowed for artifact policies in namespace %s", repo.Name(), namespace)
+}
+
+// policyArtifacts returns the artifacts configured by the ArtifactPolicies in the namespace. Invalid policies are
+// logged and skipped. If the ArtifactPolicy CRD is not installed, no artifacts are returned.
+func (c *Controller) policyArtifacts(ctx context.Context, namespace string) ([]Artifact, error) {
+	var policies attestagonv1alpha1.ArtifactPolicyList
+	if err := c.cache.List(ctx, &policies, runtimeclient.InNamespace(namespace)); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing artifact policies: %w", err)
+	}
+
+	cfg := c.config().artifactPolicies
+
+	var arts []Artifact
+	for i := range policies.Items {
+		art, err := artifactFromPolicy(&policies.Items[i], cfg)
+		if err != nil {
+			c.log.Error(err, "Ignoring invalid artifact policy", "policy", policies.Items[i].Namespace+"/"+policies.Items[i].Name)
+			continue
+		}
+		arts = append(arts, art)
+	}
+
+	return arts, nil
+}
+
+// artifactFromPolicy converts the ArtifactPolicy to an Artifact. References to Secrets and ConfigMaps are resolved in
+// the namespace of the policy so that policies cannot read objects of other namespaces. Policies must sign with their
+// own key and may only attach attestations to the repositories allowed by cfg, so that a namespace cannot use the
+// identity or registry access of the controller.
+func artifactFromPolicy(policy *attestagonv1alpha1.ArtifactPolicy, cfg ArtifactPolicyConfig) (Artifact, error) {
+	spec := policy.Spec
+	namespace := policy.Namespace
+
+	if spec.Signer == nil {
+		return Artifact{}, errors.New("artifact policies must configure a signer")
+	}
+
+	if spec.Ref != "" {
+		if err := cfg.allowRepository(spec.Ref, namespace); err != nil {
+			return Artifact{}, err
+		}
+	}
+	for _, ref := range spec.Subjects.References {
+		if err := cfg.allowRepository(ref, namespace); err != nil {
+			return Artifact{}, err
+		}
+	}
+
+	if spec.Transport.AllowInsecure && !cfg.AllowInsecure {
+		return Artifact{}, errors.New("insecure registries are not allowed for artifact policies")
+	}
+
+	art := Artifact{
+		Name:    spec.ArtifactName,
+		Ref:     spec.Ref,
+		Storage: spec.Storage,
+		Credentials: RegistryCredentials{
+			UsePodCredentials: spec.Credentials.UsePodCredentials,
+		},
+		Transport: RegistryTransport{
+			AllowInsecure: spec.Transport.AllowInsecure,
+			ProxyURL:      spec.Transport.ProxyURL,
+		},
+		Subjects: SubjectConfig{
+			Resolvers:  spec.Subjects.Resolvers,
+			Tag:        spec.Subjects.Tag,
+			References: spec.Subjects.References,
+		},
+		Policy: types.NamespacedName{Namespace: namespace, Name: policy.Name},
+	}
+
+	if art.Name == "" {
+		art.Name = policy.Name
+	}
+
+	if ref := spec.Credentials.SecretRef; ref != nil {
+		art.Credentials.SecretRef = &SecretReference{Name: ref.Name, Namespace: namespace}
+	}
+
+	if ref := spec.Transport.CABundleRef; ref != nil {
+		art.Transport.CABundleRef = &KeyReference{Name: ref.Name, Namespace: namespace, Key: ref.Key}
+	}
+
+	if ref := spec.Transport.ClientCertSecretRef; ref != nil {
+		art.Transport.ClientCertSecretRef = &SecretReference{Name: ref.Name, Namespace: namespace}
+	}
+
+	art.Signer = &ArtifactSigner{
+		KeySecretRef: SecretKeyReference{Name: spec.Signer.KeySecretRef.Name, Namespace: namespace, Key: spec.Signer.KeySecretRef.Key},
+		PasswordKey:  spec.Signer.PasswordKey,
+	}
+
+	var err error
+	art.Sinks, err = sinksFromPolicy(spec.Sinks, namespace)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if a := spec.Aggregate; a != nil {
+		art.Aggregate = &AggregateConfig{Kind: a.Kind}
+		if err := art.Aggregate.validate(); err != nil {
+			return Artifact{}, err
+		}
+	}
+
+	if f := spec.FailedBuilds; f != nil {
+		art.FailedBuilds = &FailedBuildConfig{Enabled: f.Enabled}
+		art.FailedBuilds.Sinks, err = sinksFromPolicy(f.Sinks, namespace)
+		if err != nil {
+			return Artifact{}, err
+		}
+	}
+
+	if s := spec.Selector; s != nil {
+		art.Selector = &PodSelector{
+			MatchLabels: s.MatchLabels,
+			OwnerKinds:  s.OwnerKinds,
+			TektonTasks: s.TektonTasks,
+		}
+		for _, r := range s.MatchExpressions {
+			art.Selector.MatchExpressions = append(art.Selector.MatchExpressions, LabelSelectorRequirement{
+				Key:      r.Key,
+				Operator: string(r.Operator),
+				Values:   r.Values,
+			})
+		}
+
+		if err := art.Selector.validate(); err != nil {
+			return Artifact{}, err
+		}
+	}
+
+	return art, nil
+}
+
+// sinksFromPolicy converts the sinks of an ArtifactPolicy, forcing Secret references into the policy namespace.
+func sinksFromPolicy(sinks []attestagonv1alpha1.Sink, namespace string) ([]SinkConfig, error) {
+	var cfgs []SinkConfig
+	for _, s := range sinks {
+		switch {
+		case s.Archivista != nil && s.HTTP != nil:
+			return nil, errors.New("sink must configure exactly one of archivista or http")
+		case s.Archivista != nil:
+			cfg := &ArchivistaSinkConfig{URL: s.Archivista.URL, MaxRetries: s.Archivista.MaxRetries}
+			if ref := s.Archivista.HeadersSecretRef; ref != nil {
+				cfg.HeadersSecretRef = &SecretReference{Name: ref.Name, Namespace: namespace}
+			}
+			cfgs = append(cfgs, SinkConfig{Archivista: cfg})
+		case s.HTTP != nil:
+			cfg := &HTTPSinkConfig{URL: s.HTTP.URL, Format: s.HTTP.Format, MaxRetries: s.HTTP.MaxRetries}
+			if ref := s.HTTP.HeadersSecretRef; ref != nil {
+				cfg.HeadersSecretRef = &SecretReference{Name: ref.Name, Namespace: namespace}
+			}
+			cfgs = append(cfgs, SinkConfig{HTTP: cfg})
+		default:
+			return nil, fmt.Errorf("sink has no type configured")
+		}
+	}
+
+	return cfgs, nil
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// tektonTaskLabel is the label Tekton sets on TaskRun pods to the name of the Task.
+const tektonTaskLabel = "tekton.dev/task"
+
+// PodSelector selects the pods that build an artifact without the pod having to name the artifact in an annotation.
+// Every criterion that is set must match.
+type PodSelector struct {
+	// MatchLabels and MatchExpressions select pods by label.
+	MatchLabels      map[string]string          `yaml:"matchLabels"`
+	MatchExpressions []LabelSelectorRequirement `yaml:"matchExpressions"`
+
+	// Namespaces are the namespaces of the selected pods.
+	Namespaces []string `yaml:"namespaces"`
+
+	// NamespaceSelector selects the namespaces of the selected pods by label.
+	NamespaceSelector *LabelSelector `yaml:"namespaceSelector"`
+
+	// OwnerKinds are the kinds of controllers owning the selected pods, e.g. TaskRun, Job or Workflow.
+	OwnerKinds []string `yaml:"ownerKinds"`
+
+	// TektonTasks are the names of the Tekton Tasks whose TaskRun pods are selected.
+	TektonTasks []string `yaml:"tektonTasks"`
+}
+
+// LabelSelector is a Kubernetes label selector.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `yaml:"matchLabels"`
+	MatchExpressions []LabelSelectorRequirement `yaml:"matchExpressions"`
+}
+
+// LabelSelectorRequirement is a requirement of a Kubernetes label selector.
+type LabelSelectorRequirement struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values"`
+}
+
+// selector returns the label selector as a labels.Selector.
+func (s LabelSelector) selector() (labels.Selector, error) {
+	ls := &metav1.LabelSelector{MatchLabels: s.MatchLabels}
+	for _, r := range s.MatchExpressions {
+		ls.MatchExpressions = append(ls.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      r.Key,
+			Operator: metav1.LabelSelectorOperator(r.Operator),
+			Values:   r.Values,
+		})
+	}
+
+	return metav1.LabelSelectorAsSelector(ls)
+}
+
+// empty returns true if the selector has no criteria, in which case it selects no pods.
+func (s *PodSelector) empty() bool {
+	return s == nil || (len(s.MatchLabels) == 0 && len(s.MatchExpressions) == 0 && len(s.Namespaces) == 0 &&
+		s.NamespaceSelector == nil && len(s.OwnerKinds) == 0 && len(s.TektonTasks) == 0)
+}
+
+// validate returns an error if the label selectors of the selector are invalid.
+func (s *PodSelector) validate() error {
+	if s == nil {
+		return nil
+	}
+
+	if _, err := (LabelSelector{MatchLabels: s.MatchLabels, MatchExpressions: s.MatchExpressions}).selector(); err != nil {
+		return fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	if s.NamespaceSelector != nil {
+		if _, err := s.NamespaceSelector.selector(); err != nil {
+			return fmt.Errorf("invalid namespace selector: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if the pod matches every criterion of the selector. namespaceLabels is only called if the
+// selector has a namespace selector.
+func (s *PodSelector) matches(pod *corev1.Pod, namespaceLabels func() (labels.Set, error)) (bool, error) {
+	if s.empty() {
+		return true, nil
+	}
+
+	podSelector, err := (LabelSelector{MatchLabels: s.MatchLabels, MatchExpressions: s.MatchExpressions}).selector()
+	if err != nil {
+		return false, err
+	}
+	if !podSelector.Matches(labels.Set(pod.Labels)) {
+		return false, nil
+	}
+
+	if len(s.Namespaces) > 0 && !slices.Contains(s.Namespaces, pod.Namespace) {
+		return false, nil
+	}
+
+	if len(s.TektonTasks) > 0 && !slices.Contains(s.TektonTasks, pod.Labels[tektonTaskLabel]) {
+		return false, nil
+	}
+
+	if len(s.OwnerKinds) > 0 && !slices.ContainsFunc(pod.OwnerReferences, func(ref metav1.OwnerReference) bool {
+		return slices.Contains(s.OwnerKinds, ref.Kind)
+	}) {
+		return false, nil
+	}
+
+	if s.NamespaceSelector != nil {
+		nsSelector, err := s.NamespaceSelector.selector()
+		if err != nil {
+			return false, err
+		}
+
+		nsLabels, err := namespaceLabels()
+		if err != nil {
+			return false, err
+		}
+
+		if !nsSelector.Matches(nsLabels) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// namespaceLabels returns a function returning the labels of the namespace, fetching the namespace at most once.
+func (c *Controller) namespaceLabels(ctx context.Context, namespace string) func() (labels.Set, error) {
+	var (
+		set labels.Set
+		err error
+	)
+	return func() (labels.Set, error) {
+		if set == nil && err == nil {
+			ns := new(corev1.Namespace)
+			if err = c.cache.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+				err = fmt.Errorf("getting namespace %s: %w", namespace, err)
+				return nil, err
+			}
+			set = labels.Set(ns.Labels)
+		}
+		return set, err
+	}
+}
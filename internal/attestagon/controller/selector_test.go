@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// selectorPod returns a TaskRun pod of the kaniko Task in the builds namespace with the labels.
+func selectorPod(podLabels map[string]string) *corev1.Pod {
+	merged := map[string]string{tektonTaskLabel: "kaniko"}
+	for k, v := range podLabels {
+		merged[k] = v
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "build",
+			Namespace: "builds",
+			Labels:    merged,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "tekton.dev/v1",
+				Kind:       "TaskRun",
+				Name:       "build",
+			}},
+		},
+	}
+}
+
+func TestPodSelectorMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *PodSelector
+		pod      *corev1.Pod
+
+		// namespaceLabels are the labels of the namespace of the pod. Looking them up fails if they are nil.
+		namespaceLabels labels.Set
+
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "no selector",
+			pod:  selectorPod(nil),
+			want: true,
+		},
+		{
+			name:     "match labels",
+			selector: &PodSelector{MatchLabels: map[string]string{"app": "api"}},
+			pod:      selectorPod(map[string]string{"app": "api"}),
+			want:     true,
+		},
+		{
+			name:     "match labels mismatch",
+			selector: &PodSelector{MatchLabels: map[string]string{"app": "api"}},
+			pod:      selectorPod(map[string]string{"app": "web"}),
+		},
+		{
+			name:     "match expressions",
+			selector: &PodSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "In", Values: []string{"api", "web"}}}},
+			pod:      selectorPod(map[string]string{"app": "web"}),
+			want:     true,
+		},
+		{
+			name:     "match expressions mismatch",
+			selector: &PodSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "DoesNotExist"}}},
+			pod:      selectorPod(map[string]string{"app": "web"}),
+		},
+		{
+			name:     "namespace",
+			selector: &PodSelector{Namespaces: []string{"ci", "builds"}},
+			pod:      selectorPod(nil),
+			want:     true,
+		},
+		{
+			name:     "other namespace",
+			selector: &PodSelector{Namespaces: []string{"ci"}},
+			pod:      selectorPod(nil),
+		},
+		{
+			name:            "namespace selector",
+			selector:        &PodSelector{NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}}},
+			pod:             selectorPod(nil),
+			namespaceLabels: labels.Set{"team": "platform"},
+			want:            true,
+		},
+		{
+			name:            "namespace selector mismatch",
+			selector:        &PodSelector{NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}}},
+			pod:             selectorPod(nil),
+			namespaceLabels: labels.Set{"team": "web"},
+		},
+		{
+			name:     "namespace lookup fails",
+			selector: &PodSelector{NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}}},
+			pod:      selectorPod(nil),
+			wantErr:  true,
+		},
+		{
+			name: "namespace is not looked up once another criterion fails",
+			selector: &PodSelector{
+				MatchLabels:       map[string]string{"app": "api"},
+				NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}},
+			},
+			pod: selectorPod(nil),
+		},
+		{
+			name:     "owner kind",
+			selector: &PodSelector{OwnerKinds: []string{"Job", "TaskRun"}},
+			pod:      selectorPod(nil),
+			want:     true,
+		},
+		{
+			name:     "owner kind mismatch",
+			selector: &PodSelector{OwnerKinds: []string{"Workflow"}},
+			pod:      selectorPod(nil),
+		},
+		{
+			name:     "tekton task",
+			selector: &PodSelector{TektonTasks: []string{"buildah", "kaniko"}},
+			pod:      selectorPod(nil),
+			want:     true,
+		},
+		{
+			name:     "tekton task mismatch",
+			selector: &PodSelector{TektonTasks: []string{"buildah"}},
+			pod:      selectorPod(nil),
+		},
+		{
+			name: "every criterion",
+			selector: &PodSelector{
+				MatchLabels:       map[string]string{"app": "api"},
+				Namespaces:        []string{"builds"},
+				NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}},
+				OwnerKinds:        []string{"TaskRun"},
+				TektonTasks:       []string{"kaniko"},
+			},
+			pod:             selectorPod(map[string]string{"app": "api"}),
+			namespaceLabels: labels.Set{"team": "platform"},
+			want:            true,
+		},
+		{
+			name:     "invalid operator",
+			selector: &PodSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Matches"}}},
+			pod:      selectorPod(nil),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespaceLabels := func() (labels.Set, error) {
+				if tt.namespaceLabels == nil {
+					return nil, errors.New("namespace not found")
+				}
+				return tt.namespaceLabels, nil
+			}
+
+			got, err := tt.selector.matches(tt.pod, namespaceLabels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matches() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodSelectorValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *PodSelector
+
+		wantErr bool
+	}{
+		{
+			name: "no selector",
+		},
+		{
+			name: "valid",
+			selector: &PodSelector{
+				MatchExpressions:  []LabelSelectorRequirement{{Key: "app", Operator: "In", Values: []string{"api"}}},
+				NamespaceSelector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "team", Operator: "Exists"}}},
+			},
+		},
+		{
+			name:     "In without values",
+			selector: &PodSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "In"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid label value",
+			selector: &PodSelector{MatchLabels: map[string]string{"app": "not a label value"}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid namespace selector",
+			selector: &PodSelector{NamespaceSelector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "team", Operator: "Exists", Values: []string{"platform"}}}}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.selector.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPodArtifacts(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "builds", Labels: map[string]string{"team": "platform"}}}
+
+	c := testController(t, namespace)
+	c.runtimeConfig.Store(&runtimeConfig{artifacts: []Artifact{
+		{Name: "annotated"},
+		{Name: "kaniko", Selector: &PodSelector{TektonTasks: []string{"kaniko"}}},
+		{Name: "platform", Selector: &PodSelector{NamespaceSelector: &LabelSelector{MatchLabels: map[string]string{"team": "platform"}}}},
+		{Name: "jobs", Selector: &PodSelector{OwnerKinds: []string{"Job"}}},
+		{Name: "web", Selector: &PodSelector{MatchLabels: map[string]string{"app": "web"}}},
+	}})
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+
+		want []string
+	}{
+		{
+			name: "selected",
+			want: []string{"kaniko", "platform"},
+		},
+		{
+			name:        "named artifacts come first",
+			annotations: map[string]string{artifactAnnotation: "platform, annotated"},
+			want:        []string{"platform", "annotated", "kaniko"},
+		},
+		{
+			name:        "named artifacts list",
+			annotations: map[string]string{artifactsAnnotation: `["annotated","kaniko"]`},
+			want:        []string{"annotated", "kaniko", "platform"},
+		},
+		{
+			name:        "named artifacts must match their selector",
+			annotations: map[string]string{artifactAnnotation: "web,annotated"},
+			want:        []string{"annotated", "kaniko", "platform"},
+		},
+		{
+			name:        "unknown artifacts are ignored",
+			annotations: map[string]string{artifactAnnotation: "missing"},
+			want:        []string{"kaniko", "platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := selectorPod(nil)
+			pod.Annotations = tt.annotations
+
+			arts, err := c.podArtifacts(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("podArtifacts() error = %v", err)
+			}
+
+			var got []string
+			for _, art := range arts {
+				got = append(got, art.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podArtifacts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/app/options"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/sigstore/sigstore/pkg/signature"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// signerOptions builds the options used by image.Sign from the signer of the artifact, or the controller signer
+// configuration if the artifact has none. Artifacts of ArtifactPolicies never fall back to the controller signer.
+func (c *Controller) signerOptions(ctx context.Context, art *Artifact) (image.SignerOptions, error) {
+	config := c.config()
+	signerConfig := config.signerConfig
+
+	opts := image.SignerOptions{
+		FulcioURL:  signerConfig.FulcioURL,
+		RekorURL:   signerConfig.RekorURL,
+		TlogUpload: signerConfig.TlogUpload,
+	}
+
+	if signerConfig.TSAURL != "" {
+		opts.Timestamper = image.NewTimestampClient(signerConfig.TSAURL)
+	}
+
+	if art.Signer != nil {
+		key, err := c.secretSigner(ctx, art.Signer)
+		if err != nil {
+			return image.SignerOptions{}, err
+		}
+		opts.Key = key
+		return opts, nil
+	}
+
+	if art.Policy.Name != "" {
+		return image.SignerOptions{}, fmt.Errorf("artifact policy %s has no signer", art.Policy)
+	}
+
+	if signerConfig.KMSRef != "" {
+		return image.SignerOptions{}, errors.New("KMS signing not implemented yet for non-witness mode")
+	}
+
+	if !signerConfig.Keyless {
+		if config.keyLoader == nil {
+			return image.SignerOptions{}, errors.New("no signer configuration provided")
+		}
+
+		key, err := config.keyLoader.Signer()
+		if err != nil {
+			return image.SignerOptions{}, err
+		}
+		opts.Key = key
+		return opts, nil
+	}
+
+	token, err := c.identityToken(ctx, signerConfig)
+	if err != nil {
+		return image.SignerOptions{}, fmt.Errorf("failed to get identity token for keyless signing: %w", err)
+	}
+	opts.IDToken = token
+
+	return opts, nil
+}
+
+// secretSigner loads the private key of the artifact signer from its Secret.
+func (c *Controller) secretSigner(ctx context.Context, s *ArtifactSigner) (signature.SignerVerifier, error) {
+	ref := s.KeySecretRef
+	secret, err := c.clientset.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting signer secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	key, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("signer secret %s/%s has no key %q", ref.Namespace, ref.Name, ref.Key)
+	}
+
+	var password []byte
+	if s.PasswordKey != "" {
+		password = secret.Data[s.PasswordKey]
+	}
+
+	sv, err := image.LoadSigner(key, password)
+	if err != nil {
+		return nil, fmt.Errorf("loading private key from secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	return sv, nil
+}
+
+// identityToken returns the OIDC identity token exchanged with Fulcio for a signing certificate. The token is read from
+// the projected service account token if configured, and otherwise requested from the Kubernetes API for the configured
+// service account.
+func (c *Controller) identityToken(ctx context.Context, signerConfig options.SignerConfig) (string, error) {
+	if signerConfig.IdentityTokenPath != "" {
+		// Projected tokens are rotated by the kubelet, so we read it every time.
+		token, err := os.ReadFile(signerConfig.IdentityTokenPath)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	namespace, name, ok := strings.Cut(signerConfig.ServiceAccount, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", fmt.Errorf("invalid service account %q, expected <namespace>/<name>", signerConfig.ServiceAccount)
+	}
+
+	tr, err := c.clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: []string{signerConfig.IdentityTokenAudience},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return tr.Status.Token, nil
+}
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/sink"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// registrySinkKey is the key of the registry sink. Writes to the registry are recorded per image, under the key
+// returned by imageSinkKey.
+const registrySinkKey = "registry"
+
+// artifactSink is a sink of an artifact along with the key its writes are recorded under in the written annotation,
+// which tells it apart from the other sinks of the artifact.
+type artifactSink struct {
+	sink.Sink
+	key string
+}
+
+// imageSinkKey returns the key a write of an attestation to the image in the registry is recorded under.
+func imageSinkKey(digest name.Digest) string {
+	return registrySinkKey + ":" + digest.Context().Name() + "@" + digest.DigestStr()
+}
+
+// validate returns an error unless exactly one type of sink is configured.
+func (s SinkConfig) validate() error {
+	var n int
+	for _, set := range []bool{s.Filesystem != nil, s.Archivista != nil, s.HTTP != nil} {
+		if set {
+			n++
+		}
+	}
+
+	switch n {
+	case 0:
+		return errors.New("sink has no type configured")
+	case 1:
+		return nil
+	default:
+		return errors.New("sink must configure exactly one of filesystem, archivista or http")
+	}
+}
+
+// sinks returns the sinks the attestations for the artifact should be written to. If failed is set, the sinks for
+// attestations of failed builds are returned instead.
+func (c *Controller) sinks(art *Artifact, remoteOpts image.RemoteOptions, failed bool) ([]artifactSink, error) {
+	var sinks []artifactSink
+
+	cfgs := art.Sinks
+	if failed && art.FailedBuilds != nil && len(art.FailedBuilds.Sinks) > 0 {
+		cfgs = art.FailedBuilds.Sinks
+	}
+
+	// Attestations of failed builds are never attached to images, so that they are not mistaken for provenance.
+	if !failed && (art.Ref != "" || len(art.Subjects.References) > 0) {
+		refs := []string{art.Ref}
+		for _, ref := range art.Subjects.References {
+			refs = append(refs, ref)
+		}
+
+		for _, ref := range refs {
+			if ref == "" {
+				continue
+			}
+			if _, err := name.ParseReference(ref, remoteOpts.NameOptions()...); err != nil {
+				return nil, fmt.Errorf("parsing reference %q: %w", ref, err)
+			}
+		}
+
+		s, err := sink.NewRegistry(c.log.WithName("registry-sink"), art.Storage, remoteOpts)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, artifactSink{Sink: s, key: registrySinkKey})
+	}
+
+	for _, cfg := range cfgs {
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case cfg.Filesystem != nil:
+			s, err := sink.NewFilesystem(cfg.Filesystem.Path, cfg.Filesystem.Format)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, artifactSink{Sink: s, key: s.Name() + ":" + cfg.Filesystem.Path})
+		case cfg.Archivista != nil:
+			maxRetries := 3
+			if cfg.Archivista.MaxRetries != nil {
+				maxRetries = *cfg.Archivista.MaxRetries
+			}
+
+			var headers sink.HeaderFunc
+			if ref := cfg.Archivista.HeadersSecretRef; ref != nil {
+				headers = c.secretHeaders(*ref)
+			}
+
+			s, err := sink.NewArchivista(c.log.WithName("archivista-sink"), cfg.Archivista.URL, headers, maxRetries)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, artifactSink{Sink: s, key: s.Name() + ":" + cfg.Archivista.URL})
+		case cfg.HTTP != nil:
+			maxRetries := 3
+			if cfg.HTTP.MaxRetries != nil {
+				maxRetries = *cfg.HTTP.MaxRetries
+			}
+
+			var headers sink.HeaderFunc
+			if ref := cfg.HTTP.HeadersSecretRef; ref != nil {
+				headers = c.secretHeaders(*ref)
+			}
+
+			s, err := sink.NewHTTP(c.log.WithName("http-sink"), cfg.HTTP.URL, cfg.HTTP.Format, headers, maxRetries)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, artifactSink{Sink: s, key: s.Name() + ":" + cfg.HTTP.URL})
+		}
+	}
+
+	if len(sinks) == 0 {
+		return nil, errors.New("no sinks configured")
+	}
+
+	return sinks, nil
+}
+
+// secretHeaders returns a HeaderFunc that reads request headers from the referenced Secret. The Secret is read on every
+// request so that rotated credentials are picked up.
+func (c *Controller) secretHeaders(ref SecretReference) sink.HeaderFunc {
+	return func(ctx context.Context) (http.Header, error) {
+		secret, err := c.clientset.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("getting secret %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+
+		headers := make(http.Header, len(secret.Data))
+		for k, v := range secret.Data {
+			headers.Set(k, string(v))
+		}
+
+		return headers, nil
+	}
+}
+
+// attest fills the statement subjects from the subjects discovered for the artifact, signs the statement and writes
+// the signed attestation to every sink of the artifact, returning the locations it was written to keyed by sink key.
+// Image subjects are checked to exist in their registry before signing, file subjects are only recorded in the statement.
+// Sinks in written already have the attestation and are skipped, so that retries do not write duplicate attestations.
+// Writes to the registry are recorded per image, so that a retry only attaches the attestation to the images it failed
+// to be attached to. The result is returned even if writing to some of the sinks failed.
+func (c *Controller) attest(ctx context.Context, pod *corev1.Pod, statement in_toto.Statement, subjects []subject.Subject, art *Artifact, signerOpts image.SignerOptions, written map[string]string) (*attestationResult, error) {
+	remoteOpts, err := c.remoteOptions(ctx, pod, art)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := pod.Status.Phase == corev1.PodFailed
+	all, err := c.sinks(art, remoteOpts, failed)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]string, len(all))
+	var (
+		registry *artifactSink
+		sinks    []artifactSink
+	)
+	for i, s := range all {
+		if s.key == registrySinkKey {
+			registry = &all[i]
+			for key, location := range written {
+				if strings.HasPrefix(key, registrySinkKey+":") {
+					locations[key] = location
+				}
+			}
+			continue
+		}
+
+		if location, ok := written[s.key]; ok {
+			locations[s.key] = location
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+
+	var (
+		images        []name.Digest
+		imageSubjects int
+	)
+	statement.Subject = nil
+	seen := make(map[string]bool)
+	for _, s := range subjects {
+		if s.Type == subject.TypeFile {
+			key := s.Name + "@" + fmt.Sprint(s.Digest)
+			if !seen[key] {
+				seen[key] = true
+				statement.Subject = append(statement.Subject, in_toto.Subject{Name: s.Name, Digest: common.DigestSet(s.Digest)})
+			}
+			continue
+		}
+
+		repository, err := imageRepository(art, s)
+		if err != nil {
+			c.log.Info("Ignoring image subject", "pod_name", pod.Name, "artifact", art.Name, "reason", err.Error())
+			continue
+		}
+
+		subjectName := repository
+		if subjectName == "" {
+			subjectName = art.Name
+		}
+
+		key := subjectName + "@" + fmt.Sprint(s.Digest)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		statement.Subject = append(statement.Subject, in_toto.Subject{Name: subjectName, Digest: common.DigestSet(s.Digest)})
+
+		// Images of failed builds may be incomplete, they are recorded in the statement without being checked.
+		if repository == "" || failed {
+			continue
+		}
+		imageSubjects++
+
+		ociDigest, ok := s.Digest.OCI()
+		if !ok {
+			return nil, fmt.Errorf("image subject %s has no sha256 digest", subjectName)
+		}
+
+		imageRef := fmt.Sprintf("%s@%s", repository, ociDigest)
+		ref, err := name.NewDigest(imageRef, remoteOpts.NameOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reference %s: %w", imageRef, err)
+		}
+
+		// Images that already have the attestation do not need to be checked again.
+		attach := registry != nil && written[imageSinkKey(ref)] == ""
+		if !attach && len(sinks) == 0 {
+			continue
+		}
+
+		digest, err := image.ResolveDigest(ctx, imageRef, remoteOpts)
+		if err != nil {
+			return nil, fmt.Errorf("resolving digest of %s: %w", imageRef, err)
+		}
+		if attach {
+			images = append(images, digest)
+		}
+	}
+
+	statementDigest, err := image.StatementDigest(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &attestationResult{
+		statementDigest: statementDigest,
+		predicateType:   statement.PredicateType,
+		locations:       locations,
+	}
+
+	// Builds that only produce files have nothing to attach the attestation to in the registry.
+	if registry != nil && !failed && imageSubjects == 0 {
+		c.log.Info("No image subjects, not writing attestation to the registry", "pod_name", pod.Name, "artifact", art.Name)
+	}
+
+	if len(sinks) == 0 && len(images) == 0 {
+		c.log.Info("Attestation already written to every sink", "pod_name", pod.Name, "artifact", art.Name)
+		return result, nil
+	}
+
+	att, err := image.Sign(ctx, statement, signerOpts)
+	if err != nil {
+		return nil, err
+	}
+	att.Images = images
+
+	var errs []error
+	write := func(s artifactSink, key string, att *image.Attestation) {
+		location, err := s.Write(ctx, att)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writing attestation to %s sink: %w", s.Name(), err))
+			return
+		}
+		c.log.Info("Wrote attestation", "sink", key, "location", location)
+		locations[key] = location
+	}
+
+	for _, s := range sinks {
+		write(s, s.key, att)
+	}
+
+	for _, digest := range images {
+		imageAtt := *att
+		imageAtt.Images = []name.Digest{digest}
+		write(*registry, imageSinkKey(digest), &imageAtt)
+	}
+
+	writeErr := errors.Join(errs...)
+	if err := c.recordAttestation(ctx, pod, art, att, locations, writeErr); err != nil {
+		c.log.Error(err, "Failed to record attestation resource", "pod_name", pod.Name, "artifact", art.Name)
+	}
+
+	return result, writeErr
+}
+
+// imageRepository returns the repository of the image subject, which is the reference configured for the result the
+// subject was read from or the artifact reference. The image name reported by the build only selects between the
+// repositories configured for the artifact, so that a build cannot redirect its attestation to another repository; an
+// error is returned if it names any other repository. The repository is empty if the artifact configures none.
+func imageRepository(art *Artifact, s subject.Subject) (string, error) {
+	if ref := art.Subjects.References[s.Result]; s.Result != "" && ref != "" {
+		return repositoryName(ref), nil
+	}
+
+	refs := []string{art.Ref}
+	for _, ref := range art.Subjects.References {
+		refs = append(refs, ref)
+	}
+
+	var configured []string
+	for _, ref := range refs {
+		if ref != "" {
+			configured = append(configured, repositoryName(ref))
+		}
+	}
+
+	if s.Name == "" || len(configured) == 0 {
+		return repositoryName(art.Ref), nil
+	}
+
+	if reported := repositoryName(s.Name); slices.Contains(configured, reported) {
+		return reported, nil
+	}
+
+	return "", fmt.Errorf("image %s reported by the build is not in a repository of the artifact", s.Name)
+}
+
+// repositoryName returns the normalized name of the repository of the image reference.
+func repositoryName(ref string) string {
+	if r, err := name.ParseReference(ref); err == nil {
+		return r.Context().Name()
+	}
+
+	return ref
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// stateAnnotation records where the pod is in the attestation pipeline.
+	stateAnnotation = "attestagon.io/state"
+
+	// attemptsAnnotation records how many times attestation of the pod has been attempted.
+	attemptsAnnotation = "attestagon.io/attempts"
+
+	// lastAttemptAnnotation records when the last attempt to attest the pod started.
+	lastAttemptAnnotation = "attestagon.io/last-attempt"
+
+	// reasonAnnotation records why the last attempt to attest the pod failed.
+	reasonAnnotation = "attestagon.io/failure-reason"
+
+	// writtenAnnotation records the sinks each artifact of the pod has been written to as a JSON object of artifact
+	// names to sink names to locations, so that retries do not write the same attestation twice.
+	writtenAnnotation = "attestagon.io/written"
+)
+
+const (
+	// statePending is recorded when a pod that builds an artifact is seen before it completed.
+	statePending = "pending"
+
+	// stateSigning is recorded before an attempt to sign and write the attestations of the pod.
+	stateSigning = "signing"
+
+	// statePushed is recorded when the attestations of every artifact of the pod have been written.
+	statePushed = "pushed"
+
+	// stateFailed is recorded when an attempt failed. The attempt is retried until the give up period has passed.
+	stateFailed = "failed"
+)
+
+const (
+	// minRequeueDelay is the delay before the first retry of a failed attempt. It doubles with every attempt.
+	minRequeueDelay = 5 * time.Second
+
+	// maxRequeueDelay is the maximum delay between retries of failed attempts.
+	maxRequeueDelay = 10 * time.Minute
+
+	// maxReasonLength is the maximum length of the failure reason recorded on the pod.
+	maxReasonLength = 1024
+)
+
+// podAttempts returns the number of attempts recorded on the pod.
+func podAttempts(pod *corev1.Pod) int {
+	attempts, err := strconv.Atoi(pod.Annotations[attemptsAnnotation])
+	if err != nil {
+		return 0
+	}
+
+	return attempts
+}
+
+// requeueDelay returns the delay before retrying a pod after the given number of failed attempts.
+func requeueDelay(attempts int) time.Duration {
+	delay := minRequeueDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRequeueDelay {
+			return maxRequeueDelay
+		}
+	}
+
+	return delay
+}
+
+// podWritten returns the sinks each artifact of the pod has been written to, keyed by artifact name and sink name.
+func podWritten(pod *corev1.Pod) map[string]map[string]string {
+	written := make(map[string]map[string]string)
+	if v, ok := pod.Annotations[writtenAnnotation]; ok {
+		if err := json.Unmarshal([]byte(v), &written); err != nil {
+			return make(map[string]map[string]string)
+		}
+	}
+
+	return written
+}
+
+// retryAfter returns how long to wait before retrying a pod whose last attempt failed. It is zero once the pod is due.
+func retryAfter(pod *corev1.Pod) time.Duration {
+	if pod.Annotations[stateAnnotation] != stateFailed {
+		return 0
+	}
+
+	lastAttempt, err := time.Parse(time.RFC3339, pod.Annotations[lastAttemptAnnotation])
+	if err != nil {
+		return 0
+	}
+
+	if wait := time.Until(lastAttempt.Add(requeueDelay(podAttempts(pod)))); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+// startAttempt records the start of an attempt to attest the pod, incrementing its attempt count. The pod is updated
+// in place so that later patches apply on top of it.
+func (c *Controller) startAttempt(ctx context.Context, pod *corev1.Pod) error {
+	return c.annotatePod(ctx, pod, map[string]string{
+		stateAnnotation:       stateSigning,
+		attemptsAnnotation:    strconv.Itoa(podAttempts(pod) + 1),
+		lastAttemptAnnotation: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// failAttempt records that the current attempt to attest the pod failed and why.
+func (c *Controller) failAttempt(ctx context.Context, pod *corev1.Pod, attemptErr error) error {
+	reason := attemptErr.Error()
+	if len(reason) > maxReasonLength {
+		reason = reason[:maxReasonLength]
+	}
+
+	return c.annotatePod(ctx, pod, map[string]string{
+		stateAnnotation:  stateFailed,
+		reasonAnnotation: reason,
+	})
+}
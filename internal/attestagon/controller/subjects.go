@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultSubjectResolvers is the order resolvers are tried in when an artifact does not configure one.
+var defaultSubjectResolvers = []string{"tekton", "annotation", "kaniko", "buildkit", "manifest", "registry"}
+
+// subjectResolvers returns the resolver chain used to discover the subjects of the artifact.
+func (c *Controller) subjectResolvers(art *Artifact, remoteOpts image.RemoteOptions) (subject.Chain, error) {
+	names := art.Subjects.Resolvers
+	if len(names) == 0 {
+		names = defaultSubjectResolvers
+	}
+
+	var chain subject.Chain
+	for _, name := range names {
+		switch name {
+		case "tekton":
+			chain = append(chain, subject.Tekton{})
+		case "annotation":
+			chain = append(chain, subject.Annotation{})
+		case "kaniko":
+			chain = append(chain, subject.Kaniko{SharedVolumePath: c.subjectVolumePath})
+		case "buildkit":
+			chain = append(chain, subject.BuildKit{SharedVolumePath: c.subjectVolumePath})
+		case "manifest":
+			chain = append(chain, subject.Manifest{SharedVolumePath: c.subjectVolumePath})
+		case "registry":
+			if art.Ref == "" || art.Subjects.Tag == "" {
+				if len(art.Subjects.Resolvers) > 0 {
+					return nil, errors.New("registry resolver requires ref and subjects.tag to be set")
+				}
+				continue
+			}
+			chain = append(chain, subject.Registry{Ref: art.Ref + ":" + art.Subjects.Tag, RemoteOptions: remoteOpts})
+		default:
+			return nil, fmt.Errorf("unknown subject resolver %q", name)
+		}
+	}
+
+	return chain, nil
+}
+
+// resolveSubjects discovers the subjects produced by the pod for the artifact.
+func (c *Controller) resolveSubjects(ctx context.Context, pod *corev1.Pod, art *Artifact) ([]subject.Subject, error) {
+	var remoteOpts image.RemoteOptions
+	if art.Ref != "" && art.Subjects.Tag != "" {
+		var err error
+		remoteOpts, err = c.remoteOptions(ctx, pod, art)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain, err := c.subjectResolvers(art, remoteOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, resolver, err := chain.Resolve(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Info("Resolved subjects", "pod", pod.Name, "resolver", resolver, "subjects", len(subjects))
+
+	return subjects, nil
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// registryTransport returns the transport for contacting the registry of the artifact, configured with the CA bundle,
+// client certificate and proxy of the artifact transport settings. The referenced ConfigMaps and Secrets are read from
+// the namespace of the pod if they have no namespace set.
+func (c *Controller) registryTransport(ctx context.Context, pod *corev1.Pod, art *Artifact) (http.RoundTripper, error) {
+	cfg := art.Transport
+
+	t := remote.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- only set when explicitly configured for the artifact.
+		InsecureSkipVerify: cfg.AllowInsecure,
+	}
+
+	if ref := cfg.CABundleRef; ref != nil {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+
+		cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("getting CA bundle configmap %s/%s: %w", namespace, ref.Name, err)
+		}
+
+		bundle, ok := cm.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("CA bundle configmap %s/%s has no key %q", namespace, ref.Name, ref.Key)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(bundle)) {
+			return nil, fmt.Errorf("CA bundle configmap %s/%s key %q contains no certificates", namespace, ref.Name, ref.Key)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if ref := cfg.ClientCertSecretRef; ref != nil {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+
+		secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("getting client certificate secret %s/%s: %w", namespace, ref.Name, err)
+		}
+
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate secret %s/%s: %w", namespace, ref.Name, err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy url %q: %w", cfg.ProxyURL, err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore/pkg/signature"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testClientCertificate returns a self-signed client certificate and its PEM encoded certificate and key.
+func testClientCertificate(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "attestagon"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// testTLSRegistry starts an in-process registry serving TLS with a self-signed certificate, requiring client
+// certificates signed by clientCA if it is set. It returns the repository of the registry and the PEM encoded
+// certificate of the server.
+func testTLSRegistry(t *testing.T, clientCA *x509.Certificate) (string, []byte) {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	return strings.TrimPrefix(srv.URL, "https://") + "/test/image", caPEM
+}
+
+// pushTestImage pushes a random image to the repository with the transport, returning its digest reference.
+func pushTestImage(repository string, transport http.RoundTripper) (name.Digest, error) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	ref, err := name.ParseReference(repository + ":latest")
+	if err != nil {
+		return name.Digest{}, err
+	}
+	if err := remote.Write(ref, img, remote.WithTransport(transport)); err != nil {
+		return name.Digest{}, err
+	}
+
+	h, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	return ref.Context().Digest(h.String()), nil
+}
+
+func TestRegistryTransport(t *testing.T) {
+	clientCA, clientCert, clientKey := testClientCertificate(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := signature.LoadECDSASignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		mTLS      bool
+		transport RegistryTransport
+
+		wantErr string
+	}{
+		{
+			name:      "untrusted certificate",
+			transport: RegistryTransport{},
+			wantErr:   "certificate",
+		},
+		{
+			name:      "CA bundle",
+			transport: RegistryTransport{CABundleRef: &KeyReference{Name: "registry-ca", Key: "ca.crt"}},
+		},
+		{
+			name:      "CA bundle in another namespace",
+			transport: RegistryTransport{CABundleRef: &KeyReference{Name: "registry-ca", Namespace: "registry", Key: "ca.crt"}},
+		},
+		{
+			name:      "missing CA bundle key",
+			transport: RegistryTransport{CABundleRef: &KeyReference{Name: "registry-ca", Key: "missing"}},
+			wantErr:   `has no key "missing"`,
+		},
+		{
+			name:      "insecure",
+			transport: RegistryTransport{AllowInsecure: true},
+		},
+		{
+			name: "client certificate",
+			mTLS: true,
+			transport: RegistryTransport{
+				CABundleRef:         &KeyReference{Name: "registry-ca", Key: "ca.crt"},
+				ClientCertSecretRef: &SecretReference{Name: "registry-client"},
+			},
+		},
+		{
+			name:      "missing client certificate",
+			mTLS:      true,
+			transport: RegistryTransport{CABundleRef: &KeyReference{Name: "registry-ca", Key: "ca.crt"}},
+			wantErr:   "certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var ca *x509.Certificate
+			if tt.mTLS {
+				ca = clientCA
+			}
+			repository, caPEM := testTLSRegistry(t, ca)
+
+			var objects []runtime.Object
+			for _, namespace := range []string{"build", "registry"} {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "registry-ca", Namespace: namespace},
+					Data:       map[string]string{"ca.crt": string(caPEM)},
+				})
+			}
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "registry-client", Namespace: "build"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{corev1.TLSCertKey: clientCert, corev1.TLSPrivateKeyKey: clientKey},
+			})
+
+			c := &Controller{log: logr.Discard(), clientset: fake.NewSimpleClientset(objects...)}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "build"}}
+			art := &Artifact{Name: "test", Ref: repository, Transport: tt.transport}
+
+			// Digest resolution, attestation fetches and pushes all go through the options.
+			var digest name.Digest
+			ropts, err := c.remoteOptions(ctx, pod, art)
+			if err == nil {
+				digest, err = pushTestImage(repository, ropts.Transport)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			resolved, err := image.ResolveDigest(ctx, repository+":latest", ropts)
+			if err != nil {
+				t.Fatalf("ResolveDigest() error = %v", err)
+			}
+			if resolved.String() != digest.String() {
+				t.Errorf("ResolveDigest() = %s, want %s", resolved, digest)
+			}
+
+			att, err := image.Sign(ctx, in_toto.Statement{
+				StatementHeader: in_toto.StatementHeader{Type: "https://in-toto.io/Statement/v0.1", PredicateType: "https://example.com/test"},
+				Predicate:       map[string]string{},
+			}, image.SignerOptions{Key: sv})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := image.Push(ctx, att, resolved, ropts); err != nil {
+				t.Errorf("Push() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistryTransportProxy(t *testing.T) {
+	ctx := context.Background()
+
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+
+	// The proxy forwards the plain HTTP requests to the registry.
+	target, err := url.Parse(reg.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxied atomic.Int32
+	forward := httputil.NewSingleHostReverseProxy(target)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		forward.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	c := &Controller{log: logr.Discard(), clientset: fake.NewSimpleClientset()}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "build"}}
+	repository := "registry.invalid/test/image"
+	art := &Artifact{Name: "test", Ref: repository, Transport: RegistryTransport{AllowInsecure: true, ProxyURL: proxy.URL}}
+
+	ropts, err := c.remoteOptions(ctx, pod, art)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(repository+":latest", ropts.NameOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img, remote.WithTransport(ropts.Transport)); err != nil {
+		t.Fatalf("pushing through the proxy: %v", err)
+	}
+
+	if _, err := image.ResolveDigest(ctx, repository+":latest", ropts); err != nil {
+		t.Fatalf("ResolveDigest() error = %v", err)
+	}
+	if proxied.Load() == 0 {
+		t.Error("no requests went through the proxy")
+	}
+}
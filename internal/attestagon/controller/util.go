@@ -1,33 +1,124 @@
 package controller
 
 import (
-	"os"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func loadConfig(configPath string) (Config, error) {
-	c, err := os.ReadFile(configPath)
+func parseConfig(c []byte) (Config, error) {
+	var config Config
+	err := yaml.Unmarshal(c, &config)
 	if err != nil {
 		return Config{}, err
 	}
 
-	var config Config
-	err = yaml.Unmarshal(c, &config)
+	return config, nil
+}
+
+const (
+	// artifactAnnotation is the pod annotation naming the artifacts built by the pod, separated by commas.
+	artifactAnnotation = "attestagon.io/artifact"
+
+	// artifactsAnnotation is the pod annotation naming the artifacts built by the pod as a JSON list.
+	artifactsAnnotation = "attestagon.io/artifacts"
+)
+
+// podArtifacts returns the artifacts built by the pod. A pod builds the artifacts it names in its annotations, as long
+// as it matches their selector, and the artifacts whose selector selects it. Only the first artifact with a given name
+// is returned. Artifacts are looked up in the controller configuration first and then in the ArtifactPolicies of the
+// pod namespace.
+func (c *Controller) podArtifacts(ctx context.Context, pod *corev1.Pod) ([]*Artifact, error) {
+	policyArtifacts, err := c.policyArtifacts(ctx, pod.Namespace)
 	if err != nil {
-		return Config{}, err
+		return nil, err
 	}
 
-	return config, nil
+	artifacts := c.config().artifacts
+	candidates := make([]*Artifact, 0, len(artifacts)+len(policyArtifacts))
+	for i := range artifacts {
+		candidates = append(candidates, &artifacts[i])
+	}
+	for i := range policyArtifacts {
+		candidates = append(candidates, &policyArtifacts[i])
+	}
+
+	namespaceLabels := c.namespaceLabels(ctx, pod.Namespace)
+	names := c.podArtifactNames(pod)
+
+	var arts []*Artifact
+	selected := make(map[string]bool)
+	// Artifacts named by the pod come first, in the order they are named.
+	for _, name := range append(names, "") {
+		for _, art := range candidates {
+			if selected[art.Name] || (name != "" && art.Name != name) {
+				continue
+			}
+
+			// Without an annotation, an artifact must have a selector to select the pod.
+			if name == "" && art.Selector.empty() {
+				continue
+			}
+
+			ok, err := art.Selector.matches(pod, namespaceLabels)
+			if err != nil {
+				return nil, fmt.Errorf("matching selector of artifact %q: %w", art.Name, err)
+			}
+			if ok {
+				selected[art.Name] = true
+				arts = append(arts, art)
+			}
+		}
+	}
+
+	return arts, nil
 }
 
-func (c *Controller) ReadyForProcessing(pod *corev1.Pod) *Artifact {
-	for i := 0; i < len(c.artifacts); i++ {
-		if pod.Status.Phase == "Succeeded" && pod.Annotations["attestagon.io/artifact"] == c.artifacts[i].Name && c.artifacts[i].Name != "" && pod.Annotations["attestagon.io/attested"] != "true" {
-			return &c.artifacts[i]
+// podArtifactNames returns the unique names of the artifacts declared by the pod annotations.
+func (c *Controller) podArtifactNames(pod *corev1.Pod) []string {
+	var names []string
+	if value := pod.Annotations[artifactsAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &names); err != nil {
+			c.log.Error(err, "Invalid artifacts annotation", "pod_name", pod.Name, "annotation", artifactsAnnotation)
+		}
+	}
+
+	names = append(names, strings.Split(pod.Annotations[artifactAnnotation], ",")...)
+
+	var unique []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
 		}
+		seen[name] = true
+		unique = append(unique, name)
+	}
+
+	return unique
+}
+
+// annotatePod adds the annotations to the pod with a merge patch, leaving any other annotations untouched. The pod is
+// updated in place so that later patches apply on top of it.
+func (c *Controller) annotatePod(ctx context.Context, pod *corev1.Pod, annotations map[string]string) error {
+	patch := pod.DeepCopy()
+	if patch.Annotations == nil {
+		patch.Annotations = make(map[string]string)
+	}
+	for k, v := range annotations {
+		patch.Annotations[k] = v
+	}
+
+	if err := c.client.Patch(ctx, patch, runtimeclient.MergeFromWithOptions(pod, runtimeclient.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("patching annotations of pod %s/%s: %w", pod.Namespace, pod.Name, err)
 	}
+	*pod = *patch
 
 	return nil
 }
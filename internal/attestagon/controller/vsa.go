@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultVerifierID identifies attestagon as the verifier of verification summaries unless configured otherwise.
+const defaultVerifierID = "https://attestagon.io/verifier"
+
+// VSAConfig configures the SLSA verification summary attestation written alongside the attestation of an artifact,
+// recording whether its predicate passed the rules of the artifact.
+type VSAConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PolicyURI identifies the rules of the artifact in the summary.
+	PolicyURI string `yaml:"policyURI"`
+
+	// VerifierID identifies the verifier in the summary. Defaults to https://attestagon.io/verifier.
+	VerifierID string `yaml:"verifierID"`
+
+	// VerifiedLevels are the levels recorded in the summary when the rules pass.
+	VerifiedLevels []string `yaml:"verifiedLevels"`
+}
+
+// validate returns an error if the summary is enabled without rules to evaluate or a policy URI.
+func (v *VSAConfig) validate(rules *policy.Rules) error {
+	if v == nil || !v.Enabled {
+		return nil
+	}
+
+	if rules == nil {
+		return errors.New("verification summaries require rules")
+	}
+	if v.PolicyURI == "" {
+		return errors.New("no policy URI configured")
+	}
+
+	return nil
+}
+
+// attestSummary returns whether verification summaries are written for the artifact.
+func (a *Artifact) attestSummary() bool {
+	return a.VSA != nil && a.VSA.Enabled && a.engine != nil
+}
+
+// summaryKey is the key the sinks a verification summary was written to are recorded under in the written
+// annotation, next to those of the attestation of the artifact.
+func summaryKey(artifact string) string {
+	return artifact + "/vsa"
+}
+
+// attestSummary signs and writes the verification summary of the report against the attestation of the artifact
+// described by input. Sinks in written already have the summary and are skipped.
+func (c *Controller) attestSummary(ctx context.Context, pod *corev1.Pod, art *Artifact, subjects []subject.Subject, signerOpts image.SignerOptions, input *attestationResult, report policy.Report, written map[string]string) (*attestationResult, error) {
+	verifierID := art.VSA.VerifierID
+	if verifierID == "" {
+		verifierID = defaultVerifierID
+	}
+
+	summary := &predicate.VerificationSummary{
+		Verifier:     predicate.Verifier{ID: verifierID},
+		TimeVerified: time.Now().UTC(),
+		ResourceURI:  resourceURI(art, subjects),
+		Policy: predicate.ResourceDescriptor{
+			URI:    art.VSA.PolicyURI,
+			Digest: map[string]string{"sha256": art.engine.Digest()},
+		},
+		InputAttestations: []predicate.ResourceDescriptor{{
+			URI:    inputURI(input),
+			Digest: map[string]string{"sha256": input.statementDigest},
+		}},
+		VerificationResult: predicate.VerificationPassed,
+		VerifiedLevels:     append([]string{}, art.VSA.VerifiedLevels...),
+		SLSAVersion:        "1.0",
+	}
+	if !report.Passed() {
+		summary.VerificationResult = predicate.VerificationFailed
+		summary.VerifiedLevels = []string{}
+	}
+
+	statement := in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v0.1",
+			PredicateType: predicate.VerificationSummaryType,
+		},
+		Predicate: summary,
+	}
+
+	c.log.Info("Signing and writing verification summary", "artifact", art.Name, "result", summary.VerificationResult)
+
+	result, err := c.attest(ctx, pod, statement, subjects, art, signerOpts, written)
+	if result != nil {
+		result.verificationResult = summary.VerificationResult
+	}
+	if err != nil {
+		return result, fmt.Errorf("error signing and writing verification summary: %w", err)
+	}
+
+	return result, nil
+}
+
+// resourceURI returns the URI of the artifact a verification summary is about, the image reference of its first
+// subject if it is an image.
+func resourceURI(art *Artifact, subjects []subject.Subject) string {
+	if len(subjects) == 0 {
+		return art.Ref
+	}
+
+	s := subjects[0]
+	if s.Type == subject.TypeFile {
+		return s.Name
+	}
+
+	repository, err := imageRepository(art, s)
+	if err != nil {
+		return art.Ref
+	}
+	if digest, ok := s.Digest.OCI(); ok && repository != "" {
+		return repository + "@" + digest
+	}
+
+	return repository
+}
+
+// inputURI returns the location of the attestation a verification summary is about, preferring the registry.
+func inputURI(input *attestationResult) string {
+	sinks := make([]string, 0, len(input.locations))
+	for s := range input.locations {
+		sinks = append(sinks, s)
+	}
+	sort.Slice(sinks, func(i, j int) bool {
+		ri, rj := strings.HasPrefix(sinks[i], registrySinkKey+":"), strings.HasPrefix(sinks[j], registrySinkKey+":")
+		if ri != rj {
+			return ri
+		}
+		return sinks[i] < sinks[j]
+	})
+
+	if len(sinks) == 0 {
+		return ""
+	}
+
+	return input.locations[sinks[0]]
+}
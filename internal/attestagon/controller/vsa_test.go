@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/sink"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/subject"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writtenStatement is a statement read from a DSSE envelope written by a filesystem sink.
+type writtenStatement struct {
+	in_toto.StatementHeader
+	Predicate json.RawMessage `json:"predicate"`
+
+	// digest is the hex encoded sha256 digest of the payload of the envelope.
+	digest string
+}
+
+// dsseStatements returns the statements of the DSSE envelopes in the directory of a filesystem sink keyed by
+// predicate type.
+func dsseStatements(t *testing.T, dir string) map[string]writtenStatement {
+	t.Helper()
+
+	statements := make(map[string]writtenStatement)
+	for _, file := range sinkFiles(t, dir) {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var statement writtenStatement
+		if err := json.Unmarshal(payload, &statement); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(payload)
+		statement.digest = hex.EncodeToString(sum[:])
+		statements[statement.PredicateType] = statement
+	}
+
+	return statements
+}
+
+func TestAttestSummary(t *testing.T) {
+	const rulesDoc = "forbiddenProcesses: [/usr/bin/curl]\n"
+	rules, err := policy.ParseRules([]byte(rulesDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := policy.NewEngine(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesSum := sha256.Sum256([]byte(rulesDoc))
+
+	tests := []struct {
+		name      string
+		vsa       VSAConfig
+		processes map[string]int
+
+		wantVerifier string
+		wantResult   string
+		wantLevels   []string
+	}{
+		{
+			name:         "passing rules",
+			vsa:          VSAConfig{Enabled: true, PolicyURI: "https://example.com/policy.yaml", VerifiedLevels: []string{"SLSA_BUILD_LEVEL_2"}},
+			processes:    map[string]int{"/usr/bin/go": 1},
+			wantVerifier: defaultVerifierID,
+			wantResult:   predicate.VerificationPassed,
+			wantLevels:   []string{"SLSA_BUILD_LEVEL_2"},
+		},
+		{
+			name:         "violated rules",
+			vsa:          VSAConfig{Enabled: true, PolicyURI: "https://example.com/policy.yaml", VerifierID: "https://example.com/verifier", VerifiedLevels: []string{"SLSA_BUILD_LEVEL_2"}},
+			processes:    map[string]int{"/usr/bin/curl": 1},
+			wantVerifier: "https://example.com/verifier",
+			wantResult:   predicate.VerificationFailed,
+			wantLevels:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "builds", UID: "5d0f6a8e-3c1b-4f7e-9a2d-8b6c4e1f0a37"},
+				Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+			}
+			volume := t.TempDir()
+			writeManifest(t, volume, pod, "cli_linux_amd64", strings.Repeat("c", 64))
+
+			dir := t.TempDir()
+			vsa := tt.vsa
+			art := &Artifact{
+				Name:     "cli",
+				Subjects: SubjectConfig{Resolvers: []string{"manifest"}},
+				Signer:   testSigner,
+				Sinks:    []SinkConfig{{Filesystem: &FilesystemSinkConfig{Path: dir, Format: sink.FormatDSSE}}},
+				Rules:    &rules,
+				VSA:      &vsa,
+				engine:   engine,
+			}
+
+			c := testController(t, pod)
+			c.subjectVolumePath = volume
+
+			result, err := c.processArtifact(context.Background(), pod, &predicate.Predicate{ProcessesExecuted: tt.processes}, art, nil, nil)
+			if err != nil {
+				t.Fatalf("processArtifact() error = %v", err)
+			}
+			if result.summary == nil || result.summary.verificationResult != tt.wantResult {
+				t.Fatalf("processArtifact() summary = %+v, want a %s summary", result.summary, tt.wantResult)
+			}
+
+			statements := dsseStatements(t, dir)
+			provenance, ok := statements[predicate.ProvenanceType]
+			if !ok {
+				t.Fatalf("filesystem sink has statements %v, want the provenance", statements)
+			}
+			statement, ok := statements[predicate.VerificationSummaryType]
+			if !ok {
+				t.Fatalf("filesystem sink has statements %v, want the verification summary", statements)
+			}
+
+			if !reflect.DeepEqual(statement.Subject, provenance.Subject) {
+				t.Errorf("summary subjects = %v, want the subjects of the provenance %v", statement.Subject, provenance.Subject)
+			}
+
+			var summary predicate.VerificationSummary
+			if err := json.Unmarshal(statement.Predicate, &summary); err != nil {
+				t.Fatal(err)
+			}
+			if summary.Verifier.ID != tt.wantVerifier || summary.VerificationResult != tt.wantResult || !reflect.DeepEqual(summary.VerifiedLevels, tt.wantLevels) {
+				t.Errorf("summary verified by %s with result %s and levels %v, want %s, %s and %v",
+					summary.Verifier.ID, summary.VerificationResult, summary.VerifiedLevels, tt.wantVerifier, tt.wantResult, tt.wantLevels)
+			}
+			if summary.ResourceURI != "cli_linux_amd64" {
+				t.Errorf("summary resource URI = %s, want the file subject", summary.ResourceURI)
+			}
+
+			wantInput := []predicate.ResourceDescriptor{{URI: result.locations["filesystem:"+dir], Digest: map[string]string{"sha256": provenance.digest}}}
+			if !reflect.DeepEqual(summary.InputAttestations, wantInput) {
+				t.Errorf("summary input attestations = %v, want the provenance %v", summary.InputAttestations, wantInput)
+			}
+
+			wantPolicy := predicate.ResourceDescriptor{URI: tt.vsa.PolicyURI, Digest: map[string]string{"sha256": hex.EncodeToString(rulesSum[:])}}
+			if !reflect.DeepEqual(summary.Policy, wantPolicy) {
+				t.Errorf("summary policy = %v, want %v", summary.Policy, wantPolicy)
+			}
+		})
+	}
+}
+
+func TestResourceURI(t *testing.T) {
+	digest := subject.DigestSet{"sha256": strings.Repeat("a", 64)}
+
+	tests := []struct {
+		name     string
+		art      Artifact
+		subjects []subject.Subject
+
+		want string
+	}{
+		{
+			name: "no subjects",
+			art:  Artifact{Ref: "ghcr.io/example/app"},
+			want: "ghcr.io/example/app",
+		},
+		{
+			name:     "file",
+			subjects: []subject.Subject{{Name: "cli_linux_amd64", Digest: digest, Type: subject.TypeFile}},
+			want:     "cli_linux_amd64",
+		},
+		{
+			name:     "image of the artifact",
+			art:      Artifact{Ref: "ghcr.io/example/app:latest"},
+			subjects: []subject.Subject{{Digest: digest, Type: subject.TypeImage}},
+			want:     "ghcr.io/example/app@sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			name: "named image of the artifact",
+			art: Artifact{
+				Ref:      "ghcr.io/example/app",
+				Subjects: SubjectConfig{References: map[string]string{"CLI_IMAGE_DIGEST": "ghcr.io/example/cli"}},
+			},
+			subjects: []subject.Subject{{Name: "ghcr.io/example/cli:v1", Digest: digest, Type: subject.TypeImage}},
+			want:     "ghcr.io/example/cli@sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			name:     "named image outside of the artifact repositories",
+			art:      Artifact{Ref: "ghcr.io/example/app"},
+			subjects: []subject.Subject{{Name: "ghcr.io/example/cli:v1", Digest: digest, Type: subject.TypeImage}},
+			want:     "ghcr.io/example/app",
+		},
+		{
+			name: "image of a result reference",
+			art: Artifact{
+				Ref:      "ghcr.io/example/app",
+				Subjects: SubjectConfig{References: map[string]string{"CLI_IMAGE_DIGEST": "ghcr.io/example/cli"}},
+			},
+			subjects: []subject.Subject{{Digest: digest, Type: subject.TypeImage, Result: "CLI_IMAGE_DIGEST"}},
+			want:     "ghcr.io/example/cli@sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			name:     "first subject",
+			subjects: []subject.Subject{{Name: "cli_linux_amd64", Digest: digest, Type: subject.TypeFile}, {Name: "cli_darwin_arm64", Digest: digest, Type: subject.TypeFile}},
+			want:     "cli_linux_amd64",
+		},
+		{
+			name:     "image without a sha256 digest",
+			art:      Artifact{Ref: "ghcr.io/example/app"},
+			subjects: []subject.Subject{{Digest: subject.DigestSet{"sha512": strings.Repeat("a", 128)}, Type: subject.TypeImage}},
+			want:     "ghcr.io/example/app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resourceURI(&tt.art, tt.subjects); got != tt.want {
+				t.Errorf("resourceURI() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputURI(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations map[string]string
+
+		want string
+	}{
+		{
+			name: "not written",
+		},
+		{
+			name: "registry is preferred",
+			locations: map[string]string{
+				"archivista:https://archivista.example.com": "3f2c",
+				"registry:ghcr.io/example/cli@sha256:bbbb":  "ghcr.io/example/cli:sha256-bbbb.att",
+				"registry:ghcr.io/example/app@sha256:aaaa":  "ghcr.io/example/app:sha256-aaaa.att",
+				"filesystem:/attestations":                  "/attestations/a.json",
+			},
+			want: "ghcr.io/example/app:sha256-aaaa.att",
+		},
+		{
+			name: "first sink by key",
+			locations: map[string]string{
+				"http:https://example.com/attestations":     "https://example.com/attestations/1",
+				"filesystem:/attestations":                  "/attestations/a.json",
+				"archivista:https://archivista.example.com": "3f2c",
+			},
+			want: "3f2c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inputURI(&attestationResult{locations: tt.locations}); got != tt.want {
+				t.Errorf("inputURI() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVSAConfigValidate(t *testing.T) {
+	rules := &policy.Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}}
+
+	tests := []struct {
+		name  string
+		vsa   *VSAConfig
+		rules *policy.Rules
+
+		wantErr bool
+	}{
+		{
+			name: "no summary",
+		},
+		{
+			name: "disabled summary without rules",
+			vsa:  &VSAConfig{PolicyURI: "https://example.com/policy.yaml"},
+		},
+		{
+			name:  "enabled summary",
+			vsa:   &VSAConfig{Enabled: true, PolicyURI: "https://example.com/policy.yaml"},
+			rules: rules,
+		},
+		{
+			name:    "enabled summary without rules",
+			vsa:     &VSAConfig{Enabled: true, PolicyURI: "https://example.com/policy.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "enabled summary without policy URI",
+			vsa:     &VSAConfig{Enabled: true},
+			rules:   rules,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.vsa.validate(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
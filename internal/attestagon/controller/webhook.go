@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/policy"
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validatePodPath is the path the validating admission webhook for pods is served at.
+const validatePodPath = "/validate-pod"
+
+// VerificationConfig configures the validating admission webhook that verifies the attestations of pod images.
+type VerificationConfig struct {
+	Policies []VerificationPolicy `yaml:"policies"`
+}
+
+// VerificationPolicy requires the images it applies to to have a verified attestagon attestation that passes its
+// rules. An image that several policies apply to must pass all of them.
+type VerificationPolicy struct {
+	Name string `yaml:"name"`
+
+	// Images are the patterns of the image references the policy applies to, where * matches any characters.
+	Images []string `yaml:"images"`
+
+	// PublicKeys are the PEM encoded public keys attestations may be signed with.
+	PublicKeys []string `yaml:"publicKeys"`
+
+	// Identities are the keyless identities attestations may be signed with.
+	Identities []Identity `yaml:"identities"`
+
+	// RekorURL is the address of the Rekor instance attestations must be logged in. If empty, the transparency log
+	// is not checked, and keyless identities require TSACertificateChain.
+	RekorURL string `yaml:"rekorURL"`
+
+	// RekorPublicKeys are the PEM encoded public keys of the Rekor instance. Defaults to the keys of the public
+	// Sigstore Rekor instance.
+	RekorPublicKeys []string `yaml:"rekorPublicKeys"`
+
+	// FulcioCertificates are the PEM encoded root and intermediate certificates of the Fulcio instance keyless
+	// identities are issued by. Defaults to the certificates of the public Sigstore Fulcio instance.
+	FulcioCertificates string `yaml:"fulcioCertificates"`
+
+	// CTLogPublicKeys are the PEM encoded public keys of the certificate transparency log of the Fulcio instance. If
+	// empty with FulcioCertificates set, certificates are not required to have been logged.
+	CTLogPublicKeys []string `yaml:"ctLogPublicKeys"`
+
+	// TSACertificateChain is the PEM encoded certificate chain of the timestamp authority attestations are
+	// timestamped by, leaf first.
+	TSACertificateChain string `yaml:"tsaCertificateChain"`
+
+	// PredicateTypes are the predicate types of the attestations that are accepted. Defaults to the attestagon
+	// provenance and aggregate provenance predicate types.
+	PredicateTypes []string `yaml:"predicateTypes"`
+
+	// Rules are the checks the predicate of the attestation must pass.
+	Rules policy.Rules `yaml:"rules"`
+
+	// Summaries accepts a verified verification summary attestation with a passing result instead of evaluating
+	// Rules against the predicate.
+	Summaries *SummaryPolicy `yaml:"summaries"`
+}
+
+// SummaryPolicy configures the verification summaries a VerificationPolicy accepts.
+type SummaryPolicy struct {
+	// PolicyURI is the URI of the policy the summary must have been verified against.
+	PolicyURI string `yaml:"policyURI"`
+
+	// PolicyDigest is the hex encoded sha256 digest the policy of the summary must have. If empty, any digest is
+	// accepted.
+	PolicyDigest string `yaml:"policyDigest"`
+
+	// VerifierID is the verifier the summary must have been written by. Defaults to https://attestagon.io/verifier.
+	VerifierID string `yaml:"verifierID"`
+}
+
+// check returns an error unless the verification summary passed the configured policy.
+func (s *SummaryPolicy) check(raw json.RawMessage) error {
+	var summary predicate.VerificationSummary
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		return fmt.Errorf("decoding verification summary: %w", err)
+	}
+
+	verifierID := s.VerifierID
+	if verifierID == "" {
+		verifierID = defaultVerifierID
+	}
+
+	switch {
+	case summary.Verifier.ID != verifierID:
+		return fmt.Errorf("verification summary by unexpected verifier %s", summary.Verifier.ID)
+	case summary.Policy.URI != s.PolicyURI:
+		return fmt.Errorf("verification summary of unexpected policy %s", summary.Policy.URI)
+	case s.PolicyDigest != "" && summary.Policy.Digest["sha256"] != s.PolicyDigest:
+		return fmt.Errorf("verification summary of policy %s with unexpected digest", summary.Policy.URI)
+	case summary.VerificationResult != predicate.VerificationPassed:
+		return fmt.Errorf("verification summary of policy %s has result %s", summary.Policy.URI, summary.VerificationResult)
+	}
+
+	return nil
+}
+
+// Identity is a Fulcio certificate identity. Either the exact value or a regular expression is set for the issuer and
+// the subject.
+type Identity struct {
+	Issuer        string `yaml:"issuer"`
+	Subject       string `yaml:"subject"`
+	IssuerRegExp  string `yaml:"issuerRegExp"`
+	SubjectRegExp string `yaml:"subjectRegExp"`
+}
+
+// verificationPolicy is a VerificationPolicy with its images parsed, its trust material resolved and its rules
+// compiled.
+type verificationPolicy struct {
+	VerificationPolicy
+
+	images   []*regexp.Regexp
+	verifier *image.Verifier
+	engine   *policy.Engine
+}
+
+// loadVerificationPolicy parses and validates the verification policy. The trust material of the public Sigstore
+// instances the policy relies on is fetched once here rather than for every admission request.
+func loadVerificationPolicy(ctx context.Context, p VerificationPolicy) (verificationPolicy, error) {
+	vp := verificationPolicy{VerificationPolicy: p}
+	var verifyOpts image.VerifyOptions
+
+	if len(p.Images) == 0 {
+		return verificationPolicy{}, errors.New("no images configured")
+	}
+	for _, pattern := range p.Images {
+		vp.images = append(vp.images, imagePattern(pattern))
+	}
+
+	for _, key := range p.PublicKeys {
+		pub, err := cryptoutils.UnmarshalPEMToPublicKey([]byte(key))
+		if err != nil {
+			return verificationPolicy{}, fmt.Errorf("parsing public key: %w", err)
+		}
+		verifyOpts.PublicKeys = append(verifyOpts.PublicKeys, crypto.PublicKey(pub))
+	}
+
+	for _, id := range p.Identities {
+		verifyOpts.Identities = append(verifyOpts.Identities, cosign.Identity{
+			Issuer:        id.Issuer,
+			Subject:       id.Subject,
+			IssuerRegExp:  id.IssuerRegExp,
+			SubjectRegExp: id.SubjectRegExp,
+		})
+	}
+
+	if len(verifyOpts.PublicKeys) == 0 && len(verifyOpts.Identities) == 0 {
+		return verificationPolicy{}, errors.New("no public keys or identities configured")
+	}
+	verifyOpts.RekorURL = p.RekorURL
+	for _, key := range p.RekorPublicKeys {
+		verifyOpts.RekorPublicKeys = append(verifyOpts.RekorPublicKeys, []byte(key))
+	}
+	for _, key := range p.CTLogPublicKeys {
+		verifyOpts.CTLogPublicKeys = append(verifyOpts.CTLogPublicKeys, []byte(key))
+	}
+	if p.FulcioCertificates != "" {
+		verifyOpts.FulcioCertificates = []byte(p.FulcioCertificates)
+	}
+	if p.TSACertificateChain != "" {
+		verifyOpts.TSACertificateChain = []byte(p.TSACertificateChain)
+	}
+
+	verifier, err := image.NewVerifier(ctx, verifyOpts)
+	if err != nil {
+		return verificationPolicy{}, err
+	}
+	vp.verifier = verifier
+
+	if len(vp.PredicateTypes) == 0 {
+		vp.PredicateTypes = []string{predicate.ProvenanceType, predicate.AggregateType}
+	}
+
+	engine, err := policy.NewEngine(p.Rules)
+	if err != nil {
+		return verificationPolicy{}, err
+	}
+	vp.engine = engine
+
+	if p.Summaries != nil && p.Summaries.PolicyURI == "" {
+		return verificationPolicy{}, errors.New("no policy URI configured for summaries")
+	}
+
+	return vp, nil
+}
+
+// imagePattern returns the regular expression matching image references against the pattern.
+func imagePattern(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+}
+
+// matches returns true if the policy applies to the image.
+func (p *verificationPolicy) matches(img string) bool {
+	for _, re := range p.images {
+		if re.MatchString(img) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// podValidator is the admission handler denying pods whose images do not have attestations passing the verification
+// policies.
+type podValidator struct {
+	c       *Controller
+	decoder *admission.Decoder
+}
+
+// Handle implements admission.Handler.
+func (v *podValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := new(corev1.Pod)
+	if err := v.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+
+	if reasons := v.c.verifyPod(ctx, pod); len(reasons) > 0 {
+		return admission.Denied(strings.Join(reasons, "; "))
+	}
+
+	return admission.Allowed("")
+}
+
+// verifyPod verifies the images of every container of the pod against the verification policies that apply to them,
+// returning the reasons the pod is denied.
+func (c *Controller) verifyPod(ctx context.Context, pod *corev1.Pod) []string {
+	policies := c.config().verification
+	if len(policies) == 0 {
+		return nil
+	}
+
+	var images []string
+	for _, container := range pod.Spec.InitContainers {
+		images = append(images, container.Image)
+	}
+	for _, container := range pod.Spec.Containers {
+		images = append(images, container.Image)
+	}
+
+	var (
+		reasons  []string
+		verified = make(map[string]bool)
+	)
+	for _, img := range images {
+		if verified[img] {
+			continue
+		}
+		verified[img] = true
+
+		for i := range policies {
+			p := &policies[i]
+			if !p.matches(img) {
+				continue
+			}
+
+			if err := c.verifyImage(ctx, pod, img, p); err != nil {
+				c.log.Info("Denying pod", "pod_namespace", pod.Namespace, "pod_name", pod.Name, "image", img, "policy", p.Name, "reason", err.Error())
+				reasons = append(reasons, fmt.Sprintf("image %s does not satisfy policy %q: %v", img, p.Name, err))
+			}
+		}
+	}
+
+	return reasons
+}
+
+// verifyImage returns an error unless the image has a verified attestation of an accepted predicate type that passes
+// the rules of the policy, or a verified verification summary the policy accepts.
+func (c *Controller) verifyImage(ctx context.Context, pod *corev1.Pod, img string, p *verificationPolicy) error {
+	// A tag could be moved to another image between verification and the kubelet pulling it, so only the image of a
+	// digest reference is verified.
+	digest, err := name.NewDigest(img)
+	if err != nil {
+		return fmt.Errorf("image must be referenced by digest: %w", err)
+	}
+
+	source, err := c.podKeychain(ctx, pod)
+	if err != nil {
+		return err
+	}
+
+	ropts := image.RemoteOptions{
+		Keychain: image.NewKeychain(c.log.WithName("keychain").WithValues("image", img), source,
+			image.KeychainSource{Name: "docker config", Keychain: authn.DefaultKeychain}),
+	}
+
+	statements, err := p.verifier.VerifyAttestations(ctx, digest, ropts)
+	if err != nil {
+		return err
+	}
+
+	var violations []string
+	accepted := false
+	for _, statement := range statements {
+		if statement.PredicateType == predicate.VerificationSummaryType && p.Summaries != nil {
+			accepted = true
+			if err := p.Summaries.check(statement.Predicate); err != nil {
+				violations = append(violations, err.Error())
+				continue
+			}
+			return nil
+		}
+
+		if !slices.Contains(p.PredicateTypes, statement.PredicateType) {
+			continue
+		}
+		accepted = true
+
+		report, err := p.engine.EvaluateStatement(statement.PredicateType, statement.Predicate)
+		if err != nil {
+			violations = append(violations, err.Error())
+			continue
+		}
+		if report.Passed() {
+			return nil
+		}
+		violations = append(violations, report.String())
+	}
+
+	if !accepted {
+		return fmt.Errorf("no verified attestation with predicate type %s", strings.Join(p.PredicateTypes, " or "))
+	}
+
+	return errors.New(strings.Join(violations, ", "))
+}
@@ -0,0 +1,136 @@
+package image
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// KeyLoader loads the private key used for signing attestations. The key is
+// reloaded whenever the key or password file changes on disk, which is the
+// case when a mounted Secret is rotated.
+//
+// Supported formats are encrypted cosign/sigstore keys (as generated by
+// `cosign generate-key-pair`) and unencrypted PKCS#8, PKCS#1 and SEC 1 PEM
+// keys (as generated by hack/gen_key.go). Encrypted PKCS#8 keys and keys
+// encrypted with legacy PEM encryption are rejected.
+type KeyLoader struct {
+	// keyPath is the path to the PEM encoded private key.
+	keyPath string
+
+	// passwordPath is the path to a file containing the key password.
+	passwordPath string
+
+	// passwordEnv is the name of the environment variable containing the key password.
+	passwordEnv string
+
+	mu sync.Mutex
+	// keyBytes and passBytes are the contents the current signer was loaded from.
+	keyBytes  []byte
+	passBytes []byte
+	signer    signature.SignerVerifier
+}
+
+// NewKeyLoader constructs a new KeyLoader and loads the key, returning an
+// error if the key cannot be read, decrypted or parsed.
+func NewKeyLoader(keyPath, passwordPath, passwordEnv string) (*KeyLoader, error) {
+	k := &KeyLoader{
+		keyPath:      keyPath,
+		passwordPath: passwordPath,
+		passwordEnv:  passwordEnv,
+	}
+
+	if _, err := k.Signer(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Signer returns the signer for the current key, reloading it if the key or
+// password has changed since it was last loaded.
+func (k *KeyLoader) Signer() (signature.SignerVerifier, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keyBytes, err := os.ReadFile(k.keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key %q: %w", k.keyPath, err)
+	}
+
+	passBytes, err := k.password()
+	if err != nil {
+		return nil, err
+	}
+
+	if k.signer != nil && bytes.Equal(keyBytes, k.keyBytes) && bytes.Equal(passBytes, k.passBytes) {
+		return k.signer, nil
+	}
+
+	sv, err := LoadSigner(keyBytes, passBytes)
+	if err != nil {
+		return nil, fmt.Errorf("loading private key %q: %w", k.keyPath, err)
+	}
+
+	k.keyBytes, k.passBytes, k.signer = keyBytes, passBytes, sv
+
+	return sv, nil
+}
+
+// supportedKeyFormats names the private key formats LoadSigner accepts, for
+// errors about keys in other formats.
+const supportedKeyFormats = "an encrypted cosign key or an unencrypted PKCS#8, PKCS#1 or SEC 1 key"
+
+// LoadSigner loads a signer from a PEM encoded private key, decrypting it
+// with password if it is encrypted.
+func LoadSigner(key, password []byte) (signature.SignerVerifier, error) {
+	// Encrypted keys that cosign can't decrypt would otherwise fail with an
+	// unknown PEM type or an ASN.1 error.
+	if block, _ := pem.Decode(key); block != nil {
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, fmt.Errorf("encrypted PKCS#8 keys are not supported, the key must be %s: decrypt it with `openssl pkcs8` and encrypt it with `cosign import-key-pair`", supportedKeyFormats)
+		}
+		if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+			return nil, fmt.Errorf("keys with legacy PEM encryption are not supported, the key must be %s: decrypt it with `openssl pkey` and encrypt it with `cosign import-key-pair`", supportedKeyFormats)
+		}
+	}
+
+	priv, err := cryptoutils.UnmarshalPEMToPrivateKey(key, cryptoutils.StaticPasswordFunc(password))
+	if err != nil {
+		return nil, err
+	}
+
+	sv, err := signature.LoadSignerVerifier(priv, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("loading signer: %w", err)
+	}
+
+	return sv, nil
+}
+
+// password returns the key password, preferring the password file over the
+// environment variable.
+func (k *KeyLoader) password() ([]byte, error) {
+	if k.passwordPath != "" {
+		pass, err := os.ReadFile(k.passwordPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key password %q: %w", k.passwordPath, err)
+		}
+		return []byte(strings.TrimRight(string(pass), "\r\n")), nil
+	}
+
+	if k.passwordEnv != "" {
+		if pass, ok := os.LookupEnv(k.passwordEnv); ok {
+			return []byte(pass), nil
+		}
+	}
+
+	return []byte{}, nil
+}
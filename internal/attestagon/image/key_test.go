@@ -0,0 +1,159 @@
+package image
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+)
+
+func TestLoadSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cosignKey, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte("secret"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		key      []byte
+		password string
+
+		wantErr string
+	}{
+		{
+			name:     "encrypted cosign key",
+			key:      cosignKey.PrivateBytes,
+			password: "secret",
+		},
+		{
+			name:     "encrypted cosign key with the wrong password",
+			key:      cosignKey.PrivateBytes,
+			password: "wrong",
+			wantErr:  "decrypt",
+		},
+		{
+			name: "PKCS#8",
+			key:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		{
+			name: "PKCS#1",
+			key:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		},
+		{
+			name: "SEC 1",
+			key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		},
+		{
+			name:     "encrypted PKCS#8",
+			key:      pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: pkcs8}),
+			password: "secret",
+			wantErr:  "encrypted PKCS#8 keys are not supported, the key must be an encrypted cosign key or an unencrypted PKCS#8, PKCS#1 or SEC 1 key",
+		},
+		{
+			name: "legacy PEM encryption",
+			key: pem.EncodeToMemory(&pem.Block{
+				Type:    "EC PRIVATE KEY",
+				Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-256-CBC,00000000000000000000000000000000"},
+				Bytes:   sec1,
+			}),
+			password: "secret",
+			wantErr:  "legacy PEM encryption are not supported",
+		},
+		{
+			name:    "not PEM",
+			key:     []byte("not a key"),
+			wantErr: "PEM decoding failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sv, err := LoadSigner(tt.key, []byte(tt.password))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadSigner() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSigner() error = %v", err)
+			}
+
+			sig, err := sv.SignMessage(strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sv.VerifySignature(strings.NewReader(string(sig)), strings.NewReader("payload")); err != nil {
+				t.Errorf("signature of the loaded signer does not verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyLoaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	keyPath, passwordPath := filepath.Join(dir, "cosign.key"), filepath.Join(dir, "cosign.password")
+
+	writeKey := func(password string) {
+		t.Helper()
+		keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte(password), nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, keys.PrivateBytes, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(passwordPath, []byte(password+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeKey("first")
+	k, err := NewKeyLoader(keyPath, passwordPath, "")
+	if err != nil {
+		t.Fatalf("NewKeyLoader() error = %v", err)
+	}
+	first, err := k.Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, err := k.Signer(); err != nil || again != first {
+		t.Errorf("Signer() = %v, %v, want the cached signer while the key is unchanged", again, err)
+	}
+
+	writeKey("second")
+	rotated, err := k.Signer()
+	if err != nil {
+		t.Fatalf("Signer() error = %v after the key was rotated", err)
+	}
+	if rotated == first {
+		t.Error("Signer() returned the old signer after the key was rotated")
+	}
+}
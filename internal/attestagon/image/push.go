@@ -0,0 +1,87 @@
+package image
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	cbundle "github.com/sigstore/cosign/v2/pkg/cosign/bundle"
+	cremote "github.com/sigstore/cosign/v2/pkg/cosign/remote"
+	"github.com/sigstore/cosign/v2/pkg/oci/mutate"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// ResolveDigest resolves imageRef to a digest reference in the registry.
+func ResolveDigest(ctx context.Context, imageRef string, ropts RemoteOptions) (name.Digest, error) {
+	ref, err := name.ParseReference(imageRef, ropts.NameOptions()...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("parsing reference: %w", err)
+	}
+
+	ociremoteOpts, err := ropts.ociremoteOpts(ctx)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	return ociremote.ResolveDigest(ref, ociremoteOpts...)
+}
+
+// Push attaches the signed attestation to the image at digest and pushes it
+// to the registry.
+func Push(ctx context.Context, att *Attestation, digest name.Digest, ropts RemoteOptions) error {
+	ociremoteOpts, err := ropts.ociremoteOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
+	if att.Cert != nil {
+		opts = append(opts, static.WithCertChain(att.Cert, att.Chain))
+	}
+
+	if att.RFC3161Timestamp != nil {
+		opts = append(opts, static.WithRFC3161Timestamp(cbundle.TimestampToRFC3161Timestamp(att.RFC3161Timestamp)))
+	}
+
+	if att.RekorEntry != nil {
+		opts = append(opts, static.WithBundle(cbundle.EntryToBundle(att.RekorEntry)))
+	}
+
+	sig, err := static.NewAttestation(att.Envelope, opts...)
+	if err != nil {
+		return err
+	}
+
+	se, err := ociremote.SignedEntity(digest, ociremoteOpts...)
+	if err != nil {
+		return err
+	}
+
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(att.PublicKey)
+	if err != nil {
+		return fmt.Errorf("unmarshalling public key: %w", err)
+	}
+
+	verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("loading verifier: %w", err)
+	}
+
+	signOpts := []mutate.SignOption{
+		mutate.WithDupeDetector(cremote.NewDupeDetector(verifier)),
+	}
+
+	// Attach the attestation to the entity.
+	newSE, err := mutate.AttachAttestationToEntity(se, sig, signOpts...)
+	if err != nil {
+		return err
+	}
+
+	// Publish the attestations associated with this entity
+	return ociremote.WriteAttestations(digest.Repository, newSE, ociremoteOpts...)
+}
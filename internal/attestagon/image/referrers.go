@@ -0,0 +1,333 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/v2/pkg/cosign/bundle"
+	"github.com/sigstore/cosign/v2/pkg/oci"
+	cosignstatic "github.com/sigstore/cosign/v2/pkg/oci/static"
+	cosigntypes "github.com/sigstore/cosign/v2/pkg/types"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// emptyConfig is the OCI 1.1 empty descriptor content used as the config of artifact manifests.
+var emptyConfig = []byte("{}")
+
+const emptyConfigMediaType types.MediaType = "application/vnd.oci.empty.v1+json"
+
+// artifactManifest is an OCI 1.1 image manifest carrying an artifactType, which
+// the go-containerregistry manifest type does not yet support.
+type artifactManifest struct {
+	SchemaVersion int64              `json:"schemaVersion"`
+	MediaType     types.MediaType    `json:"mediaType"`
+	ArtifactType  string             `json:"artifactType"`
+	Config        gcrv1.Descriptor   `json:"config"`
+	Layers        []gcrv1.Descriptor `json:"layers"`
+	Subject       *gcrv1.Descriptor  `json:"subject,omitempty"`
+	Annotations   map[string]string  `json:"annotations,omitempty"`
+}
+
+// rawManifest implements remote.Taggable for a pre-serialised manifest.
+type rawManifest struct {
+	raw       []byte
+	mediaType types.MediaType
+}
+
+func (r rawManifest) RawManifest() ([]byte, error) {
+	return r.raw, nil
+}
+
+func (r rawManifest) MediaType() (types.MediaType, error) {
+	return r.mediaType, nil
+}
+
+// ReferrersSupported returns true if the registry hosting repo supports the
+// OCI 1.1 referrers API for subject.
+func ReferrersSupported(ctx context.Context, subject name.Digest, ropts RemoteOptions) (bool, error) {
+	repo := subject.Context()
+
+	auth, err := ropts.keychain().Resolve(repo)
+	if err != nil {
+		return false, err
+	}
+
+	rt, err := transport.NewWithContext(ctx, repo.Registry, auth, ropts.transport(), []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return false, err
+	}
+
+	u := fmt.Sprintf("%s://%s/v2/%s/referrers/%s", repo.Registry.Scheme(), repo.RegistryStr(), repo.RepositoryStr(), subject.DigestStr())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusNotFound, http.StatusBadRequest); err != nil {
+		return false, err
+	}
+
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// PushReferrer pushes content as an OCI 1.1 artifact of artifactType that
+// refers to subject, returning the digest of the artifact manifest. The
+// referrers tag schema index is not updated, so the registry must support the
+// referrers API for the artifact to be discovered; callers should check with
+// ReferrersSupported first.
+func PushReferrer(ctx context.Context, subject name.Digest, artifactType string, content []byte, annotations map[string]string, ropts RemoteOptions) (name.Digest, error) {
+	repo := subject.Context()
+	opts := ropts.remoteOpts(ctx)
+
+	subjectDesc, err := remote.Head(subject, opts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("getting subject descriptor: %w", err)
+	}
+
+	config := static.NewLayer(emptyConfig, emptyConfigMediaType)
+	layer := static.NewLayer(content, types.MediaType(artifactType))
+
+	var descs []gcrv1.Descriptor
+	for _, l := range []gcrv1.Layer{config, layer} {
+		if err := remote.WriteLayer(repo, l, opts...); err != nil {
+			return name.Digest{}, fmt.Errorf("writing blob: %w", err)
+		}
+
+		d, err := l.Digest()
+		if err != nil {
+			return name.Digest{}, err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return name.Digest{}, err
+		}
+		mt, err := l.MediaType()
+		if err != nil {
+			return name.Digest{}, err
+		}
+		descs = append(descs, gcrv1.Descriptor{MediaType: mt, Digest: d, Size: size})
+	}
+
+	manifest := artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		ArtifactType:  artifactType,
+		Config:        descs[0],
+		Layers:        descs[1:],
+		Subject: &gcrv1.Descriptor{
+			MediaType: subjectDesc.MediaType,
+			Digest:    subjectDesc.Digest,
+			Size:      subjectDesc.Size,
+		},
+		Annotations: annotations,
+	}
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	h, _, err := gcrv1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	ref := repo.Digest(h.String())
+	if err := remote.Put(ref, rawManifest{raw: raw, mediaType: types.OCIManifestSchema1}, opts...); err != nil {
+		return name.Digest{}, fmt.Errorf("writing manifest: %w", err)
+	}
+
+	return ref, nil
+}
+
+// bundleArtifactTypePrefix is the prefix of the artifact types of sigstore bundles, which carry the bundle version as
+// a media type parameter.
+const bundleArtifactTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+// dsseEnvelope is the JSON encoding of a DSSE envelope, as cosign stores it in the attestation layers of the tag
+// scheme.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     []byte          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// referrerAttestations returns the DSSE attestations of the sigstore bundles referring to subject, falling back to the
+// referrers tag schema if the registry does not support the referrers API. The bundles are not verified.
+func referrerAttestations(ctx context.Context, subject name.Digest, ropts RemoteOptions) ([]oci.Signature, error) {
+	opts := ropts.remoteOpts(ctx)
+
+	index, err := remote.Referrers(subject, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers: %w", err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var atts []oci.Signature
+	for _, desc := range manifest.Manifests {
+		// Registries implementing an earlier draft of the referrers API report the config media type instead of the
+		// artifact type, so artifacts with an empty config are checked by the media type of their layer.
+		switch {
+		case strings.HasPrefix(desc.ArtifactType, bundleArtifactTypePrefix):
+		case desc.ArtifactType == "" || desc.ArtifactType == string(emptyConfigMediaType):
+		default:
+			continue
+		}
+
+		ref := subject.Context().Digest(desc.Digest.String())
+		img, err := remote.Image(ref, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("getting referrer %s: %w", ref, err)
+		}
+
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("getting layers of referrer %s: %w", ref, err)
+		}
+		if len(layers) != 1 {
+			continue
+		}
+		mt, err := layers[0].MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(string(mt), bundleArtifactTypePrefix) {
+			continue
+		}
+
+		rc, err := layers[0].Compressed()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading bundle of referrer %s: %w", ref, err)
+		}
+
+		att, err := bundleAttestation(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decoding bundle of referrer %s: %w", ref, err)
+		}
+		atts = append(atts, att)
+	}
+
+	return atts, nil
+}
+
+// bundleAttestation converts the JSON sigstore bundle of a DSSE envelope to the form cosign verifies attestations of
+// the tag scheme in, with the certificate chain, transparency log entry and timestamp of the bundle.
+func bundleAttestation(raw []byte) (oci.Signature, error) {
+	b := new(protobundle.Bundle)
+	if err := protojson.Unmarshal(raw, b); err != nil {
+		return nil, err
+	}
+
+	envelope := b.GetDsseEnvelope()
+	if envelope == nil {
+		return nil, errors.New("bundle has no DSSE envelope")
+	}
+
+	payload, err := json.Marshal(dsseEnvelope{
+		PayloadType: envelope.PayloadType,
+		Payload:     envelope.Payload,
+		Signatures:  dsseSignatures(envelope.Signatures),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vm := b.GetVerificationMaterial()
+	if vm == nil {
+		return nil, errors.New("bundle has no verification material")
+	}
+
+	opts := []cosignstatic.Option{cosignstatic.WithLayerMediaType(cosigntypes.DssePayloadType)}
+	if chain := vm.GetX509CertificateChain(); chain != nil && len(chain.Certificates) > 0 {
+		var certs []*x509.Certificate
+		for _, c := range chain.Certificates {
+			cert, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+
+		leaf, err := cryptoutils.MarshalCertificateToPEM(certs[0])
+		if err != nil {
+			return nil, err
+		}
+		rest, err := cryptoutils.MarshalCertificatesToPEM(certs[1:])
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cosignstatic.WithCertChain(leaf, rest))
+	}
+
+	for _, entry := range vm.TlogEntries {
+		if entry.InclusionPromise == nil || entry.LogId == nil {
+			continue
+		}
+
+		opts = append(opts, cosignstatic.WithBundle(&bundle.RekorBundle{
+			SignedEntryTimestamp: entry.InclusionPromise.SignedEntryTimestamp,
+			Payload: bundle.RekorPayload{
+				Body:           base64.StdEncoding.EncodeToString(entry.CanonicalizedBody),
+				IntegratedTime: entry.IntegratedTime,
+				LogIndex:       entry.LogIndex,
+				LogID:          hex.EncodeToString(entry.LogId.KeyId),
+			},
+		}))
+		break
+	}
+
+	if tsv := vm.GetTimestampVerificationData(); tsv != nil && len(tsv.Rfc3161Timestamps) > 0 {
+		opts = append(opts, cosignstatic.WithRFC3161Timestamp(&bundle.RFC3161Timestamp{
+			SignedRFC3161Timestamp: tsv.Rfc3161Timestamps[0].SignedTimestamp,
+		}))
+	}
+
+	return cosignstatic.NewAttestation(payload, opts...)
+}
+
+func dsseSignatures(sigs []*protodsse.Signature) []dsseSignature {
+	out := make([]dsseSignature, 0, len(sigs))
+	for _, s := range sigs {
+		out = append(out, dsseSignature{KeyID: s.Keyid, Sig: s.Sig})
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package image
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// testRegistry starts an in-process registry with or without the referrers API and pushes a random image to it,
+// returning the digest reference of the image.
+func testRegistry(t *testing.T, referrers bool) name.Digest {
+	t.Helper()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0)), registry.WithReferrersSupport(referrers)))
+	t.Cleanup(srv.Close)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/test/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref.Context().Digest(h.String())
+}
+
+func TestReferrersSupported(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		digest := testRegistry(t, want)
+
+		got, err := ReferrersSupported(context.Background(), digest, RemoteOptions{})
+		if err != nil {
+			t.Fatalf("ReferrersSupported() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("ReferrersSupported() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPushReferrer(t *testing.T) {
+	ctx := context.Background()
+	digest := testRegistry(t, true)
+
+	const artifactType = "application/vnd.dev.sigstore.bundle+json;version=0.1"
+	content := []byte(`{"mediaType":"application/vnd.dev.sigstore.bundle+json;version=0.1"}`)
+
+	ref, err := PushReferrer(ctx, digest, artifactType, content, map[string]string{"test": "value"}, RemoteOptions{})
+	if err != nil {
+		t.Fatalf("PushReferrer() error = %v", err)
+	}
+
+	index, err := remote.Referrers(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Manifests) != 1 || manifest.Manifests[0].Digest.String() != ref.DigestStr() {
+		t.Fatalf("referrers of %s = %+v, want %s", digest, manifest.Manifests, ref)
+	}
+
+	img, err := remote.Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject == nil || m.Subject.Digest.String() != digest.DigestStr() {
+		t.Errorf("referrer subject = %+v, want %s", m.Subject, digest.DigestStr())
+	}
+	if m.Annotations["test"] != "value" {
+		t.Errorf("referrer annotations = %v, want test=value", m.Annotations)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("referrer has %d layers, want 1", len(layers))
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("referrer content = %s, want %s", got, content)
+	}
+}
@@ -0,0 +1,103 @@
+package image
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+)
+
+// RemoteOptions configures how registries are accessed.
+type RemoteOptions struct {
+	// Keychain resolves the credentials for a registry. If nil, the default
+	// keychain (the docker config at $DOCKER_CONFIG) is used.
+	Keychain authn.Keychain
+
+	// Transport is the transport used to contact registries. If nil,
+	// remote.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Insecure allows registries to be contacted over plain HTTP.
+	Insecure bool
+}
+
+// NameOptions returns the options for parsing references to registries.
+func (o RemoteOptions) NameOptions() []name.Option {
+	if o.Insecure {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+func (o RemoteOptions) transport() http.RoundTripper {
+	if o.Transport == nil {
+		return remote.DefaultTransport
+	}
+	return o.Transport
+}
+
+func (o RemoteOptions) keychain() authn.Keychain {
+	if o.Keychain == nil {
+		return authn.DefaultKeychain
+	}
+	return o.Keychain
+}
+
+// remoteOpts returns the go-containerregistry options for accessing registries.
+func (o RemoteOptions) remoteOpts(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(o.keychain()),
+		remote.WithTransport(o.transport()),
+	}
+}
+
+// ociremoteOpts returns the cosign options for accessing registries.
+func (o RemoteOptions) ociremoteOpts(ctx context.Context) ([]ociremote.Option, error) {
+	regOpts := options.RegistryOptions{RegistryClientOpts: o.remoteOpts(ctx)}
+	return regOpts.ClientOpts(ctx)
+}
+
+// KeychainSource is a named keychain used when resolving registry credentials.
+type KeychainSource struct {
+	// Name is the name of the source, used for logging.
+	Name string
+
+	// Keychain is the keychain for the source.
+	Keychain authn.Keychain
+}
+
+// sourcesKeychain tries each source in order, using the first that has
+// credentials for the registry.
+type sourcesKeychain struct {
+	log     logr.Logger
+	sources []KeychainSource
+}
+
+// NewKeychain returns a keychain that resolves credentials from the sources in
+// order, logging which source the credentials were found in.
+func NewKeychain(log logr.Logger, sources ...KeychainSource) authn.Keychain {
+	return &sourcesKeychain{log: log, sources: sources}
+}
+
+func (k *sourcesKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	for _, s := range k.sources {
+		auth, err := s.Keychain.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+
+		if auth != authn.Anonymous {
+			k.log.Info("Using registry credentials", "registry", target.RegistryStr(), "source", s.Name)
+			return auth, nil
+		}
+	}
+
+	k.log.Info("No registry credentials found, using anonymous access", "registry", target.RegistryStr())
+	return authn.Anonymous, nil
+}
@@ -3,107 +3,182 @@ package image
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/google/go-containerregistry/pkg/name"
-	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/in-toto/in-toto-golang/in_toto"
-	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/rekor"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
-	cremote "github.com/sigstore/cosign/v2/pkg/cosign/remote"
-	"github.com/sigstore/cosign/v2/pkg/oci/mutate"
-	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
-	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
 	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
 	"github.com/sigstore/sigstore/pkg/signature/dsse"
 	signatureoptions "github.com/sigstore/sigstore/pkg/signature/options"
 )
 
-// The implementation of signing the attestation is not secure, and is for testing purposes only
-var keyPass = []byte("")
+// SignerOptions configures how the attestation is signed.
+type SignerOptions struct {
+	// Key is the signer loaded from the private key. If nil, an ephemeral key
+	// is generated and a short-lived certificate is requested from Fulcio.
+	Key signature.SignerVerifier
 
-var passFunc = func(_ bool) ([]byte, error) {
-	return keyPass, nil
+	// FulcioURL is the address of the Fulcio instance used for keyless signing.
+	FulcioURL string
+
+	// RekorURL is the address of the Rekor instance the signed attestation is
+	// uploaded to.
+	RekorURL string
+
+	// IDToken is the OIDC identity token exchanged for a Fulcio certificate.
+	IDToken string
+
+	// TlogUpload controls whether the signed attestation is uploaded to Rekor.
+	// It is always enabled for keyless signing.
+	TlogUpload bool
+
+	// Timestamper, if set, is used to countersign the DSSE envelope with an
+	// RFC 3161 timestamp that is attached to the attestation.
+	Timestamper *TimestampClient
 }
 
-func SignAndPush(ctx context.Context, statement in_toto.Statement, imageRef string, keyPath string) error {
-	ref, err := name.ParseReference(imageRef)
-	if err != nil {
-		return fmt.Errorf("parsing reference: %w", err)
-	}
+// Keyless returns true if the attestation should be signed with a Fulcio certificate.
+func (o SignerOptions) Keyless() bool {
+	return o.Key == nil
+}
 
-	regOpts := options.RegistryOptions{}
+// Attestation is a signed in-toto statement along with the material needed to
+// verify it.
+type Attestation struct {
+	// Statement is the in-toto statement that was signed.
+	Statement in_toto.Statement
 
-	ociremoteOpts, err := regOpts.ClientOpts(ctx)
-	if err != nil {
-		return err
-	}
-	digest, err := ociremote.ResolveDigest(ref, ociremoteOpts...)
-	if err != nil {
-		return err
-	}
+	// Envelope is the JSON encoded DSSE envelope containing the signed statement.
+	Envelope []byte
+
+	// Cert and Chain are the PEM encoded signing certificate and chain when
+	// signed keyless.
+	Cert  []byte
+	Chain []byte
 
-	// TODO - Assess whether it gives any more validation that the hash and reference matches up from adding it to the subject here.
-	h, _ := gcrv1.NewHash(digest.Identifier())
+	// PublicKey is the PEM encoded public key of the signer.
+	PublicKey []byte
 
-	statement.StatementHeader.Subject[0].Digest = common.DigestSet{"sha256": h.Hex}
+	// RekorEntry is the transparency log entry for the envelope, if it was
+	// uploaded to Rekor.
+	RekorEntry *models.LogEntryAnon
 
-	// Overwrite "ref" with a digest to avoid a race where we use a tag
-	// multiple times, and it potentially points to different things at
-	// each access.
-	ref = digest // nolint
+	// RFC3161Timestamp is the DER encoded timestamp response over the envelope,
+	// if it was timestamped.
+	RFC3161Timestamp []byte
 
-	ko := options.KeyOpts{KeyRef: keyPath, PassFunc: passFunc}
+	// Images are the subjects of the statement that are stored in an OCI
+	// registry, which the attestation is attached to.
+	Images []name.Digest
+}
+
+// StatementDigest returns the hex encoded sha256 digest of the JSON encoded statement.
+func (a *Attestation) StatementDigest() (string, error) {
+	return StatementDigest(a.Statement)
+}
 
-	sv, err := sign.SignerFromKeyOpts(ctx, "", "", ko)
+// StatementDigest returns the hex encoded sha256 digest of the JSON encoded statement.
+func StatementDigest(statement in_toto.Statement) (string, error) {
+	b, err := json.Marshal(statement)
 	if err != nil {
-		return fmt.Errorf("getting signer: %w", err)
+		return "", err
+	}
+
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Sign signs the statement, uploading it to the transparency log and
+// timestamping it as configured.
+func Sign(ctx context.Context, statement in_toto.Statement, signerOpts SignerOptions) (*Attestation, error) {
+	var err error
+	sv := &sign.SignerVerifier{SignerVerifier: signerOpts.Key}
+	if signerOpts.Keyless() {
+		ko := options.KeyOpts{
+			FulcioURL:            signerOpts.FulcioURL,
+			RekorURL:             signerOpts.RekorURL,
+			IDToken:              signerOpts.IDToken,
+			OIDCDisableProviders: true,
+			SkipConfirmation:     true,
+		}
+
+		sv, err = sign.SignerFromKeyOpts(ctx, "", "", ko)
+		if err != nil {
+			return nil, fmt.Errorf("getting signer: %w", err)
+		}
 	}
 	defer sv.Close()
 
 	wrapped := dsse.WrapSigner(sv, types.IntotoPayloadType)
-	dd := cremote.NewDupeDetector(sv)
 
 	payload, err := json.Marshal(statement)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	signedPayload, err := wrapped.SignMessage(bytes.NewReader(payload), signatureoptions.WithContext(ctx))
 	if err != nil {
-		return fmt.Errorf("signing: %w", err)
+		return nil, fmt.Errorf("signing: %w", err)
 	}
 
-	opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
-
-	sig, err := static.NewAttestation(signedPayload, opts...)
+	pub, err := sv.PublicKey()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("getting public key: %w", err)
 	}
-
-	se, err := ociremote.SignedEntity(digest, ociremoteOpts...)
+	pubPEM, err := cryptoutils.MarshalPublicKeyToPEM(pub)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("marshalling public key: %w", err)
 	}
 
-	signOpts := []mutate.SignOption{
-		mutate.WithDupeDetector(dd),
+	att := &Attestation{
+		Statement: statement,
+		Envelope:  signedPayload,
+		Cert:      sv.Cert,
+		Chain:     sv.Chain,
+		PublicKey: pubPEM,
 	}
 
-	// Attach the attestation to the entity.
-	newSE, err := mutate.AttachAttestationToEntity(se, sig, signOpts...)
+	if signerOpts.Timestamper != nil {
+		// The timestamp is over the signed DSSE envelope, which is what cosign
+		// verifies RFC 3161 timestamps on attestations against.
+		att.RFC3161Timestamp, err = signerOpts.Timestamper.Timestamp(ctx, signedPayload)
+		if err != nil {
+			return nil, fmt.Errorf("timestamping: %w", err)
+		}
+	}
+
+	if signerOpts.TlogUpload || signerOpts.Keyless() {
+		att.RekorEntry, err = uploadToTlog(ctx, sv, signerOpts.RekorURL, signedPayload)
+		if err != nil {
+			return nil, fmt.Errorf("uploading to transparency log: %w", err)
+		}
+	}
+
+	return att, nil
+}
+
+// uploadToTlog uploads the DSSE envelope to Rekor and returns the created entry.
+func uploadToTlog(ctx context.Context, sv *sign.SignerVerifier, rekorURL string, signedPayload []byte) (*models.LogEntryAnon, error) {
+	rekorBytes, err := sv.Bytes(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Publish the attestations associated with this entity
-	err = ociremote.WriteAttestations(digest.Repository, newSE, ociremoteOpts...)
+	rekorClient, err := rekor.NewClient(rekorURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return cosign.TLogUploadDSSEEnvelope(ctx, rekorClient, signedPayload, rekorBytes)
 }
 
 func contains(s []int, e int) bool {
@@ -0,0 +1,93 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+
+	"github.com/digitorus/timestamp"
+)
+
+const timestampQueryContentType = "application/timestamp-query"
+
+// TimestampClient requests RFC 3161 timestamps from a timestamp authority.
+type TimestampClient struct {
+	// URL is the address of the timestamp authority.
+	URL string
+
+	// HTTPClient is the client used to contact the timestamp authority. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// NewTimestampClient constructs a new TimestampClient for the timestamp authority at url.
+func NewTimestampClient(url string) *TimestampClient {
+	return &TimestampClient{URL: url}
+}
+
+// Timestamp requests a timestamp over data and returns the DER encoded
+// timestamp response. The response is checked to be a timestamp over data
+// before it is returned.
+func (t *TimestampClient) Timestamp(ctx context.Context, data []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, big.NewInt(0).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	tsq, err := timestamp.CreateRequest(bytes.NewReader(data), &timestamp.RequestOptions{
+		Hash:         crypto.SHA256,
+		Certificates: true,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating timestamp request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(tsq))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", timestampQueryContentType)
+
+	client := t.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting timestamp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading timestamp response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp authority returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing timestamp response: %w", err)
+	}
+
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("timestamp response nonce does not match request")
+	}
+
+	h := crypto.SHA256.New()
+	h.Write(data)
+	if !bytes.Equal(ts.HashedMessage, h.Sum(nil)) {
+		return nil, fmt.Errorf("timestamp response is not over the requested data")
+	}
+
+	return body, nil
+}
@@ -0,0 +1,193 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+// testTSA is a stand-in timestamp authority, whose responses can be tampered with.
+type testTSA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	// tamper changes the timestamp before it is signed.
+	tamper func(*timestamp.Timestamp)
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test tsa"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	// Timestamping certificates must mark their extended key usage as critical.
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Critical: true, Value: eku}}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testTSA{cert: cert, key: key}
+}
+
+func (s *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != timestampQueryContentType {
+		http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := timestamp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ts := &timestamp.Timestamp{
+		HashAlgorithm:     req.HashAlgorithm,
+		HashedMessage:     req.HashedMessage,
+		Time:              time.Now(),
+		Nonce:             req.Nonce,
+		Policy:            asn1.ObjectIdentifier{1, 2, 3, 4},
+		AddTSACertificate: req.Certificates,
+	}
+	if s.tamper != nil {
+		s.tamper(ts)
+	}
+
+	resp, err := ts.CreateResponseWithOpts(s.cert, s.key, crypto.SHA256)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+func TestTimestamp(t *testing.T) {
+	data := []byte(`{"payloadType":"application/vnd.in-toto+json"}`)
+
+	tests := []struct {
+		name    string
+		tamper  func(*timestamp.Timestamp)
+		handler http.HandlerFunc
+
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:    "nonce mismatch",
+			tamper:  func(ts *timestamp.Timestamp) { ts.Nonce = new(big.Int).Add(ts.Nonce, big.NewInt(1)) },
+			wantErr: "nonce does not match",
+		},
+		{
+			name:    "missing nonce",
+			tamper:  func(ts *timestamp.Timestamp) { ts.Nonce = nil },
+			wantErr: "nonce does not match",
+		},
+		{
+			name: "hash mismatch",
+			tamper: func(ts *timestamp.Timestamp) {
+				h := sha256.Sum256([]byte("other data"))
+				ts.HashedMessage = h[:]
+			},
+			wantErr: "not over the requested data",
+		},
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			},
+			wantErr: "status 503",
+		},
+		{
+			name: "malformed response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not a timestamp"))
+			},
+			wantErr: "parsing timestamp response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tsa := newTestTSA(t)
+			tsa.tamper = tt.tamper
+
+			var handler http.Handler = tsa
+			if tt.handler != nil {
+				handler = tt.handler
+			}
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			resp, err := NewTimestampClient(srv.URL).Timestamp(context.Background(), data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Timestamp() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Timestamp() error = %v", err)
+			}
+
+			ts, err := timestamp.ParseResponse(resp)
+			if err != nil {
+				t.Fatalf("parsing response: %v", err)
+			}
+			h := sha256.Sum256(data)
+			if !bytes.Equal(ts.HashedMessage, h[:]) {
+				t.Error("Timestamp() response is not over the data")
+			}
+			if len(ts.Certificates) == 0 || !ts.Certificates[0].Equal(tsa.cert) {
+				t.Error("Timestamp() response does not include the TSA certificate")
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/in-toto/go-witness/signer/kms"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/fulcio"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/rekor"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/oci"
+	"github.com/sigstore/cosign/v2/pkg/oci/empty"
+	"github.com/sigstore/cosign/v2/pkg/oci/mutate"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/tuf"
+)
+
+// VerifyOptions configures how the attestations of an image are verified. An attestation is accepted if it was signed
+// by one of the public keys or by one of the keyless identities.
+type VerifyOptions struct {
+	// PublicKeys are the public keys attestations may be signed with.
+	PublicKeys []crypto.PublicKey
+
+	// Identities are the Fulcio certificate identities attestations may be signed with.
+	Identities []cosign.Identity
+
+	// RekorURL is the address of the Rekor instance attestations must be logged in. If empty, the transparency log
+	// is not checked, which requires keyless attestations to be timestamped.
+	RekorURL string
+
+	// RekorPublicKeys are the PEM encoded public keys of the Rekor instance. Defaults to the keys of the public
+	// Sigstore Rekor instance.
+	RekorPublicKeys [][]byte
+
+	// FulcioCertificates are the PEM encoded root and intermediate certificates the certificates of keyless
+	// attestations must chain to. Defaults to the certificates of the public Sigstore Fulcio instance.
+	FulcioCertificates []byte
+
+	// CTLogPublicKeys are the PEM encoded public keys of the certificate transparency log the certificates of keyless
+	// attestations must have been logged in. Defaults to the keys of the public Sigstore log, unless
+	// FulcioCertificates is set, in which case certificates are not required to have been logged.
+	CTLogPublicKeys [][]byte
+
+	// TSACertificateChain is the PEM encoded certificate chain of the timestamp authority, leaf first, which the
+	// RFC 3161 timestamps of attestations are verified with.
+	TSACertificateChain []byte
+}
+
+// Validate returns an error if the trust material is malformed, or if keyless attestations could not be verified
+// because neither the transparency log nor timestamps are checked.
+func (o VerifyOptions) Validate() error {
+	if len(o.Identities) > 0 && o.RekorURL == "" && len(o.TSACertificateChain) == 0 {
+		return errors.New("keyless identities require a Rekor URL or a TSA certificate chain")
+	}
+
+	_, err := o.checkOpts(context.Background(), false)
+	return err
+}
+
+// LoadPublicKey loads the public key attestations are verified with from a PEM encoded file, or from a KMS key if the
+// reference is a KMS URI such as awskms:///alias/attestagon or gcpkms://projects/.../cryptoKeyVersions/1. KMS
+// providers must be registered by importing them.
+func LoadPublicKey(ctx context.Context, ref string) (crypto.PublicKey, error) {
+	var (
+		raw []byte
+		err error
+	)
+	if strings.Contains(ref, "://") {
+		verifier, err := kms.New(kms.WithRef(ref), kms.WithHash("SHA256")).Verifier(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading KMS key %s: %w", ref, err)
+		}
+		raw, err = verifier.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("reading public key of KMS key %s: %w", ref, err)
+		}
+	} else {
+		raw, err = os.ReadFile(ref)
+		if err != nil {
+			return nil, fmt.Errorf("reading public key: %w", err)
+		}
+	}
+
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key %s: %w", ref, err)
+	}
+
+	return pub, nil
+}
+
+// VerifiedStatement is an in-toto statement whose signature was verified.
+type VerifiedStatement struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Verifier verifies the attestations of images with the trust material it was created with. It is safe for concurrent
+// use.
+type Verifier struct {
+	checks []*cosign.CheckOpts
+}
+
+// NewVerifier validates the options and resolves their trust material once, fetching the trust material of the public
+// Sigstore instances that is not configured from the Sigstore TUF repository.
+func NewVerifier(ctx context.Context, opts VerifyOptions) (*Verifier, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	checks, err := opts.checkOpts(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{checks: checks}, nil
+}
+
+// VerifyAttestations verifies the attestations of the image with a verifier created from the options. Callers
+// verifying several images with the same options should create a Verifier instead, so that the trust material is only
+// resolved once.
+func VerifyAttestations(ctx context.Context, digest name.Digest, opts VerifyOptions, ropts RemoteOptions) ([]VerifiedStatement, error) {
+	v, err := NewVerifier(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.VerifyAttestations(ctx, digest, ropts)
+}
+
+// VerifyAttestations returns the statements of the attestations attached to the image, with the cosign tag scheme or
+// as sigstore bundles referring to it, whose signature could be verified and whose subject is the image. It returns an
+// error if no attestation could be verified.
+func (v *Verifier) VerifyAttestations(ctx context.Context, digest name.Digest, ropts RemoteOptions) ([]VerifiedStatement, error) {
+	ociremoteOpts, err := ropts.ociremoteOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := gcrv1.NewHash(digest.DigestStr())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		statements []VerifiedStatement
+		errs       []error
+	)
+
+	// A registry failing to list referrers must not prevent attestations of the tag scheme from being verified.
+	var referrers oci.Signatures
+	atts, err := referrerAttestations(ctx, digest, ropts)
+	if err != nil {
+		errs = append(errs, err)
+	} else if len(atts) > 0 {
+		if referrers, err = mutate.AppendSignatures(empty.Signatures(), atts...); err != nil {
+			return nil, err
+		}
+	}
+	for _, check := range v.checks {
+		// The registry options hold the credentials of this call, so they are set on a copy.
+		co := *check
+		co.RegistryClientOpts = ociremoteOpts
+
+		var verified []oci.Signature
+
+		sigs, _, err := cosign.VerifyImageAttestations(ctx, digest, &co)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tag scheme: %w", err))
+		}
+		verified = append(verified, sigs...)
+
+		if referrers != nil {
+			sigs, _, err := cosign.VerifyImageAttestation(ctx, referrers, hash, &co)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("referrers: %w", err))
+			}
+			verified = append(verified, sigs...)
+		}
+
+		for _, sig := range verified {
+			statement, err := verifiedStatement(sig.Payload)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			statements = append(statements, statement)
+		}
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no verified attestations for %s: %w", digest, errors.Join(errs...))
+	}
+
+	return statements, nil
+}
+
+// checkOpts returns the cosign options an attestation is verified with, one for each public key and one for the
+// keyless identities, without registry options. Trust material that is not configured is fetched from the public
+// Sigstore instance if fetch is true, otherwise only the configured trust material is checked.
+func (o VerifyOptions) checkOpts(ctx context.Context, fetch bool) ([]*cosign.CheckOpts, error) {
+	base := cosign.CheckOpts{
+		ClaimVerifier: cosign.IntotoSubjectClaimVerifier,
+		IgnoreTlog:    o.RekorURL == "",
+	}
+
+	var err error
+	if o.RekorURL != "" {
+		if base.RekorClient, err = rekor.NewClient(o.RekorURL); err != nil {
+			return nil, fmt.Errorf("creating rekor client: %w", err)
+		}
+	}
+
+	switch {
+	case len(o.RekorPublicKeys) > 0:
+		if base.RekorPubKeys, err = transparencyLogKeys(o.RekorPublicKeys); err != nil {
+			return nil, fmt.Errorf("parsing rekor public keys: %w", err)
+		}
+	case o.RekorURL != "" && fetch:
+		if base.RekorPubKeys, err = cosign.GetRekorPubs(ctx); err != nil {
+			return nil, fmt.Errorf("getting rekor public keys: %w", err)
+		}
+	}
+
+	if len(o.TSACertificateChain) > 0 {
+		certs, err := cryptoutils.UnmarshalCertificatesFromPEM(o.TSACertificateChain)
+		if err != nil {
+			return nil, fmt.Errorf("parsing TSA certificate chain: %w", err)
+		}
+		if len(certs) == 0 {
+			return nil, errors.New("TSA certificate chain has no certificates")
+		}
+		base.TSACertificate = certs[0]
+		base.TSARootCertificates = certs[len(certs)-1:]
+		if len(certs) > 2 {
+			base.TSAIntermediateCertificates = certs[1 : len(certs)-1]
+		}
+	}
+
+	var checks []*cosign.CheckOpts
+	for _, pub := range o.PublicKeys {
+		verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("loading verifier: %w", err)
+		}
+
+		co := base
+		co.SigVerifier = verifier
+		checks = append(checks, &co)
+	}
+
+	if len(o.Identities) > 0 {
+		co := base
+		co.Identities = o.Identities
+
+		switch {
+		case len(o.FulcioCertificates) > 0:
+			if co.RootCerts, co.IntermediateCerts, err = certificatePools(o.FulcioCertificates); err != nil {
+				return nil, fmt.Errorf("parsing fulcio certificates: %w", err)
+			}
+		case fetch:
+			if co.RootCerts, err = fulcio.GetRoots(); err != nil {
+				return nil, fmt.Errorf("getting fulcio roots: %w", err)
+			}
+			if co.IntermediateCerts, err = fulcio.GetIntermediates(); err != nil {
+				return nil, fmt.Errorf("getting fulcio intermediates: %w", err)
+			}
+		}
+
+		switch {
+		case len(o.CTLogPublicKeys) > 0:
+			if co.CTLogPubKeys, err = transparencyLogKeys(o.CTLogPublicKeys); err != nil {
+				return nil, fmt.Errorf("parsing ct log public keys: %w", err)
+			}
+		case len(o.FulcioCertificates) > 0:
+			co.IgnoreSCT = true
+		case fetch:
+			if co.CTLogPubKeys, err = cosign.GetCTLogPubs(ctx); err != nil {
+				return nil, fmt.Errorf("getting ct log public keys: %w", err)
+			}
+		}
+
+		checks = append(checks, &co)
+	}
+
+	if len(checks) == 0 {
+		return nil, errors.New("no public keys or identities to verify attestations with")
+	}
+
+	return checks, nil
+}
+
+// transparencyLogKeys parses the PEM encoded public keys of a transparency log.
+func transparencyLogKeys(keys [][]byte) (*cosign.TrustedTransparencyLogPubKeys, error) {
+	pubs := cosign.NewTrustedTransparencyLogPubKeys()
+	for _, key := range keys {
+		if err := pubs.AddTransparencyLogPubKey(key, tuf.Active); err != nil {
+			return nil, err
+		}
+	}
+
+	return &pubs, nil
+}
+
+// certificatePools splits the PEM encoded certificates into self-signed roots and intermediates.
+func certificatePools(raw []byte) (*x509.CertPool, *x509.CertPool, error) {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	if roots.Equal(x509.NewCertPool()) {
+		return nil, nil, errors.New("no root certificate")
+	}
+
+	return roots, intermediates, nil
+}
+
+// verifiedStatement decodes the in-toto statement from the DSSE envelope returned by payload.
+func verifiedStatement(payload func() ([]byte, error)) (VerifiedStatement, error) {
+	raw, err := payload()
+	if err != nil {
+		return VerifiedStatement{}, fmt.Errorf("reading attestation payload: %w", err)
+	}
+
+	var envelope struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return VerifiedStatement{}, fmt.Errorf("decoding attestation envelope: %w", err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return VerifiedStatement{}, fmt.Errorf("decoding attestation payload: %w", err)
+	}
+
+	var statement VerifiedStatement
+	if err := json.Unmarshal(decoded, &statement); err != nil {
+		return VerifiedStatement{}, fmt.Errorf("decoding in-toto statement: %w", err)
+	}
+
+	return statement, nil
+}
@@ -0,0 +1,184 @@
+package image
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// testRoot returns a PEM encoded self-signed CA certificate.
+func testRoot(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestVerifyOptionsValidate(t *testing.T) {
+	tsa := newTestTSA(t)
+	tsaChain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tsa.cert.Raw})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fulcioRoot := testRoot(t, key)
+	rekorKey, err := cryptoutils.MarshalPublicKeyToPEM(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identities := []cosign.Identity{{Issuer: "https://token.actions.githubusercontent.com", SubjectRegExp: ".*"}}
+
+	tests := []struct {
+		name string
+		opts VerifyOptions
+
+		wantErr string
+	}{
+		{
+			name: "public key without transparency log",
+			opts: VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+		},
+		{
+			name:    "identities without transparency log or timestamps",
+			opts:    VerifyOptions{Identities: identities},
+			wantErr: "require a Rekor URL or a TSA certificate chain",
+		},
+		{
+			name: "identities with transparency log",
+			opts: VerifyOptions{Identities: identities, RekorURL: "https://rekor.example.com", RekorPublicKeys: [][]byte{rekorKey}},
+		},
+		{
+			name: "identities with timestamps",
+			opts: VerifyOptions{Identities: identities, TSACertificateChain: tsaChain, FulcioCertificates: fulcioRoot},
+		},
+		{
+			name:    "malformed Rekor public key",
+			opts:    VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}, RekorURL: "https://rekor.example.com", RekorPublicKeys: [][]byte{[]byte("not a key")}},
+			wantErr: "parsing rekor public keys",
+		},
+		{
+			name:    "malformed TSA certificate chain",
+			opts:    VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}, TSACertificateChain: []byte("not a certificate")},
+			wantErr: "TSA certificate chain",
+		},
+		{
+			name:    "malformed Fulcio certificates",
+			opts:    VerifyOptions{Identities: identities, TSACertificateChain: tsaChain, FulcioCertificates: []byte("not a certificate")},
+			wantErr: "parsing fulcio certificates",
+		},
+		{
+			name:    "Fulcio certificates without root",
+			opts:    VerifyOptions{Identities: identities, TSACertificateChain: tsaChain, FulcioCertificates: tsaChain},
+			wantErr: "no root certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+// testStatement returns a statement about the image.
+func testStatement(digest name.Digest) in_toto.Statement {
+	return in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v0.1",
+			PredicateType: "https://example.com/test",
+			Subject: []in_toto.Subject{{
+				Name:   digest.Context().Name(),
+				Digest: common.DigestSet{"sha256": strings.TrimPrefix(digest.DigestStr(), "sha256:")},
+			}},
+		},
+		Predicate: map[string]string{},
+	}
+}
+
+func TestVerifyAttestationsTimestamp(t *testing.T) {
+	ctx := context.Background()
+	digest := testRegistry(t, false)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := signature.LoadECDSASignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsa := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+
+	att, err := Sign(ctx, testStatement(digest), SignerOptions{Key: sv, Timestamper: NewTimestampClient(srv.URL)})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if len(att.RFC3161Timestamp) == 0 {
+		t.Fatal("Sign() did not timestamp the attestation")
+	}
+	if err := Push(ctx, att, digest, RemoteOptions{}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	opts := VerifyOptions{
+		PublicKeys:          []crypto.PublicKey{key.Public()},
+		TSACertificateChain: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tsa.cert.Raw}),
+	}
+	statements, err := VerifyAttestations(ctx, digest, opts, RemoteOptions{})
+	if err != nil {
+		t.Fatalf("VerifyAttestations() error = %v", err)
+	}
+	if len(statements) != 1 || statements[0].PredicateType != "https://example.com/test" {
+		t.Errorf("VerifyAttestations() = %+v, want the timestamped statement", statements)
+	}
+
+	// Timestamps of another authority are not trusted.
+	opts.TSACertificateChain = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newTestTSA(t).cert.Raw})
+	if _, err := VerifyAttestations(ctx, digest, opts, RemoteOptions{}); err == nil {
+		t.Error("VerifyAttestations() accepted a timestamp of an untrusted authority")
+	}
+}
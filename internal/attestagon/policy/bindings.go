@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+)
+
+// Process is a process executed during the build, as exposed to expressions by the processes variable.
+type Process struct {
+	Binary     string
+	Executions int
+	Arguments  []string
+}
+
+// ProcessEdge is a parent process executing a child process, as exposed to expressions by the processTree variable.
+type ProcessEdge struct {
+	Parent     string
+	Child      string
+	Executions int
+}
+
+// Connection is a TCP connection of the build, as exposed to expressions by the connections variable.
+type Connection struct {
+	SourceAddress      string
+	SourcePort         int
+	DestinationAddress string
+	DestinationPort    int
+}
+
+// File is a file accessed during the build, as exposed to expressions by the files variable.
+type File struct {
+	Path   string
+	Reads  int
+	Writes int
+	Opens  int
+}
+
+// Mount is a filesystem mounted during the build, as exposed to expressions by the mounts variable.
+type Mount struct {
+	Source      string
+	Destination string
+}
+
+// PrivilegeChange is a user ID processes of the build ran as, as exposed to expressions by the privilegeChanges
+// variable.
+type PrivilegeChange struct {
+	UID   int
+	Count int
+}
+
+// Pod is the pod that ran the build, as exposed to expressions by the pod variable.
+type Pod struct {
+	Name      string
+	Namespace string
+	Phase     string
+}
+
+// bindings returns the values of the expression variables for the predicate, in a stable order.
+func bindings(p *predicate.Predicate) map[string]any {
+	processes := make([]Process, 0, len(p.ProcessesExecuted))
+	for _, binary := range sortedKeys(p.ProcessesExecuted) {
+		process := Process{Binary: binary, Executions: p.ProcessesExecuted[binary]}
+		for args := range p.CommandsExecuted[binary].Arguments {
+			process.Arguments = append(process.Arguments, args)
+		}
+		sort.Strings(process.Arguments)
+		processes = append(processes, process)
+	}
+
+	parents := make([]string, 0, len(p.ProcessTree))
+	for parent := range p.ProcessTree {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+
+	tree := []ProcessEdge{}
+	for _, parent := range parents {
+		for _, child := range sortedKeys(p.ProcessTree[parent]) {
+			tree = append(tree, ProcessEdge{Parent: parent, Child: child, Executions: p.ProcessTree[parent][child]})
+		}
+	}
+
+	connections := make([]Connection, 0, len(p.TCPConnections))
+	for _, conn := range p.TCPConnections {
+		connections = append(connections, Connection{
+			SourceAddress:      conn.SocketAddress,
+			SourcePort:         conn.SocketPort,
+			DestinationAddress: conn.DestinationAddress,
+			DestinationPort:    conn.DestinationPort,
+		})
+	}
+
+	paths := make(map[string]int)
+	for _, m := range []map[string]int{p.FilesRead, p.FilesWritten, p.FilesOpened} {
+		for path := range m {
+			paths[path]++
+		}
+	}
+	files := make([]File, 0, len(paths))
+	for _, path := range sortedKeys(paths) {
+		files = append(files, File{
+			Path:   path,
+			Reads:  p.FilesRead[path],
+			Writes: p.FilesWritten[path],
+			Opens:  p.FilesOpened[path],
+		})
+	}
+
+	mounts := make([]Mount, 0, len(p.FilesystemsMounted))
+	for _, m := range p.FilesystemsMounted {
+		mounts = append(mounts, Mount{Source: m.Source, Destination: m.Destination})
+	}
+
+	uids := make([]int, 0, len(p.UIDSet))
+	for uid := range p.UIDSet {
+		uids = append(uids, uid)
+	}
+	sort.Ints(uids)
+
+	privilegeChanges := make([]PrivilegeChange, 0, len(uids))
+	for _, uid := range uids {
+		privilegeChanges = append(privilegeChanges, PrivilegeChange{UID: uid, Count: p.UIDSet[uid]})
+	}
+
+	pod := Pod{Name: p.Pod.Name, Namespace: p.Pod.Namespace}
+	if p.Outcome != nil {
+		pod.Phase = string(p.Outcome.Phase)
+	}
+
+	return map[string]any{
+		"processes":        processes,
+		"processTree":      tree,
+		"connections":      connections,
+		"files":            files,
+		"mounts":           mounts,
+		"privilegeChanges": privilegeChanges,
+		"pod":              pod,
+	}
+}
+
+// podName returns the namespaced name of the pod of the predicate for violation reports.
+func podName(p *predicate.Predicate) string {
+	if p.Pod.Name == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(p.Pod.Namespace+"/"+p.Pod.Name, "/")
+}
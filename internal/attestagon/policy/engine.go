@@ -0,0 +1,230 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"gopkg.in/yaml.v2"
+)
+
+// Expression is a CEL expression that must evaluate to true for the predicate to pass.
+type Expression struct {
+	// Name identifies the expression in violation reports.
+	Name string `yaml:"name"`
+
+	// Expression is the CEL expression. It has the processes, processTree, connections, files, mounts,
+	// privilegeChanges and pod variables and the globMatch, cidrMatch and domainMatch functions.
+	Expression string `yaml:"expression"`
+
+	// Message describes the violation when the expression is false. Defaults to the expression.
+	Message string `yaml:"message"`
+}
+
+// Engine evaluates rules against the predicates of attestagon attestations.
+type Engine struct {
+	rules       Rules
+	digest      string
+	expressions []compiledExpression
+}
+
+type compiledExpression struct {
+	Expression
+	program cel.Program
+}
+
+// NewEngine validates the rules and compiles their expressions.
+func NewEngine(rules Rules) (*Engine, error) {
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+
+	raw := rules.raw
+	if raw == nil {
+		var err error
+		if raw, err = yaml.Marshal(rules); err != nil {
+			return nil, fmt.Errorf("encoding rules: %w", err)
+		}
+	}
+	sum := sha256.Sum256(raw)
+
+	e := &Engine{rules: rules, digest: hex.EncodeToString(sum[:])}
+	if len(rules.Expressions) == 0 {
+		return e, nil
+	}
+
+	env, err := newEnv()
+	if err != nil {
+		return nil, fmt.Errorf("creating CEL environment: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, expr := range rules.Expressions {
+		if expr.Name == "" {
+			return nil, fmt.Errorf("expression %q has no name", expr.Expression)
+		}
+		if names[expr.Name] {
+			return nil, fmt.Errorf("duplicate expression %q", expr.Name)
+		}
+		names[expr.Name] = true
+
+		ast, issues := env.Compile(expr.Expression)
+		if issues.Err() != nil {
+			return nil, fmt.Errorf("compiling expression %q: %w", expr.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("expression %q returns %s instead of bool", expr.Name, ast.OutputType())
+		}
+
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("creating program of expression %q: %w", expr.Name, err)
+		}
+
+		if expr.Message == "" {
+			expr.Message = expr.Expression
+		}
+		e.expressions = append(e.expressions, compiledExpression{Expression: expr, program: program})
+	}
+
+	return e, nil
+}
+
+// Digest returns the hex encoded sha256 digest of the YAML document the rules were parsed from, identifying them in
+// verification summaries. Rules that were not parsed are encoded as YAML to compute the digest.
+func (e *Engine) Digest() string {
+	return e.digest
+}
+
+// newEnv returns the CEL environment expressions are compiled in.
+func newEnv() (*cel.Env, error) {
+	stringPredicate := func(name string, fn func(string, string) bool) cel.EnvOption {
+		return cel.Function(name,
+			cel.Overload(name+"_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					a, ok := lhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					b, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return types.Bool(fn(string(a), string(b)))
+				}),
+			),
+		)
+	}
+
+	return cel.NewEnv(
+		ext.Strings(),
+		ext.NativeTypes(
+			reflect.TypeOf(Process{}),
+			reflect.TypeOf(ProcessEdge{}),
+			reflect.TypeOf(Connection{}),
+			reflect.TypeOf(File{}),
+			reflect.TypeOf(Mount{}),
+			reflect.TypeOf(PrivilegeChange{}),
+			reflect.TypeOf(Pod{}),
+		),
+		cel.Variable("processes", cel.ListType(cel.ObjectType("policy.Process"))),
+		cel.Variable("processTree", cel.ListType(cel.ObjectType("policy.ProcessEdge"))),
+		cel.Variable("connections", cel.ListType(cel.ObjectType("policy.Connection"))),
+		cel.Variable("files", cel.ListType(cel.ObjectType("policy.File"))),
+		cel.Variable("mounts", cel.ListType(cel.ObjectType("policy.Mount"))),
+		cel.Variable("privilegeChanges", cel.ListType(cel.ObjectType("policy.PrivilegeChange"))),
+		cel.Variable("pod", cel.ObjectType("policy.Pod")),
+		stringPredicate("globMatch", globMatch),
+		stringPredicate("cidrMatch", cidrMatch),
+		stringPredicate("domainMatch", domainMatch),
+	)
+}
+
+// Evaluate returns the report of the rules against the predicate of a single pod.
+func (e *Engine) Evaluate(p *predicate.Predicate) Report {
+	report := Report{PredicateType: predicate.ProvenanceType}
+	report.Violations = e.evaluate(p)
+
+	return report
+}
+
+// evaluate returns the violations of the rules and the expressions by the predicate. An expression that fails to
+// evaluate is a violation, so that policies fail closed.
+func (e *Engine) evaluate(p *predicate.Predicate) []Violation {
+	violations := e.rules.evaluate(p)
+	if len(e.expressions) == 0 {
+		return violations
+	}
+
+	vars := bindings(p)
+	for _, expr := range e.expressions {
+		out, _, err := expr.program.Eval(vars)
+		if err != nil {
+			violations = append(violations, Violation{Rule: expr.Name, Message: fmt.Sprintf("evaluating expression: %v", err)})
+			continue
+		}
+
+		if ok, isBool := out.Value().(bool); !isBool || !ok {
+			violations = append(violations, Violation{Rule: expr.Name, Message: expr.Message})
+		}
+	}
+
+	return violations
+}
+
+// EvaluateAggregate returns the report of the rules against every pod of the aggregate predicate. A failed aggregate
+// always violates the rules.
+func (e *Engine) EvaluateAggregate(a *predicate.Aggregate) Report {
+	report := Report{PredicateType: predicate.AggregateType}
+
+	if a.Failed {
+		report.Violations = append(report.Violations, Violation{Rule: "failedBuild", Message: fmt.Sprintf("%s %s/%s failed", a.Owner.Kind, a.Owner.Namespace, a.Owner.Name)})
+	}
+	for i := range a.Pods {
+		for _, v := range e.evaluate(&a.Pods[i]) {
+			v.Pod = podName(&a.Pods[i])
+			report.Violations = append(report.Violations, v)
+		}
+	}
+
+	return report
+}
+
+// EvaluateStatement decodes the predicate of an attestagon statement and returns the report of the rules against it.
+// The rules are evaluated against every pod of an aggregate predicate. Failed build predicates always violate the
+// rules.
+func (e *Engine) EvaluateStatement(predicateType string, raw json.RawMessage) (Report, error) {
+	report := Report{PredicateType: predicateType}
+
+	switch predicateType {
+	case predicate.ProvenanceType:
+		var p predicate.Predicate
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return Report{}, fmt.Errorf("decoding predicate: %w", err)
+		}
+		report.Violations = e.evaluate(&p)
+
+	case predicate.AggregateType:
+		var a predicate.Aggregate
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return Report{}, fmt.Errorf("decoding aggregate predicate: %w", err)
+		}
+		report = e.EvaluateAggregate(&a)
+
+	case predicate.FailedBuildType:
+		report.Violations = append(report.Violations, Violation{Rule: "failedBuild", Message: "the attestation is of a failed build"})
+
+	default:
+		return Report{}, errors.New("unsupported predicate type " + predicateType)
+	}
+
+	return report, nil
+}
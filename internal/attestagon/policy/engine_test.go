@@ -0,0 +1,267 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"gopkg.in/yaml.v2"
+)
+
+func TestEvaluateExpressions(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression Expression
+
+		want []Violation
+	}{
+		{
+			name:       "processes",
+			expression: Expression{Name: "no-curl", Expression: `!processes.exists(p, p.Binary == "/usr/bin/curl")`, Message: "curl was executed"},
+			want:       []Violation{{Rule: "no-curl", Message: "curl was executed"}},
+		},
+		{
+			name:       "process arguments",
+			expression: Expression{Name: "curl-https", Expression: `processes.all(p, p.Arguments.all(a, a.contains("https://")))`},
+		},
+		{
+			name:       "process tree",
+			expression: Expression{Name: "shell-children", Expression: `processTree.filter(e, e.Parent == "/bin/sh").map(e, e.Executions).exists(n, n > 1)`},
+		},
+		{
+			name:       "connections",
+			expression: Expression{Name: "cluster-only", Expression: `connections.all(c, cidrMatch(c.DestinationAddress, "10.0.0.0/8"))`},
+			want:       []Violation{{Rule: "cluster-only", Message: `connections.all(c, cidrMatch(c.DestinationAddress, "10.0.0.0/8"))`}},
+		},
+		{
+			name:       "files",
+			expression: Expression{Name: "no-ssh-keys", Expression: `!files.exists(f, f.Writes > 0 && globMatch(f.Path, "/root/.ssh/**"))`},
+			want:       []Violation{{Rule: "no-ssh-keys", Message: `!files.exists(f, f.Writes > 0 && globMatch(f.Path, "/root/.ssh/**"))`}},
+		},
+		{
+			name:       "files read and opened",
+			expression: Expression{Name: "go-mod", Expression: `files.exists(f, f.Path == "/workspace/go.mod" && f.Reads == 2 && f.Opens == 2 && f.Writes == 0)`},
+		},
+		{
+			name:       "mounts",
+			expression: Expression{Name: "workspace", Expression: `mounts.exists(m, m.Destination == "/workspace")`},
+		},
+		{
+			name:       "privilege changes",
+			expression: Expression{Name: "no-root", Expression: `privilegeChanges.all(p, p.UID != 0)`},
+			want:       []Violation{{Rule: "no-root", Message: `privilegeChanges.all(p, p.UID != 0)`}},
+		},
+		{
+			name:       "pod",
+			expression: Expression{Name: "builds", Expression: `pod.Namespace == "builds" && pod.Phase == "Succeeded"`},
+		},
+		{
+			name:       "domains",
+			expression: Expression{Name: "registry", Expression: `domainMatch("pkg.ghcr.io", "*.ghcr.io")`},
+		},
+		{
+			name:       "evaluation error fails closed",
+			expression: Expression{Name: "index", Expression: `processes[10].Executions == 1`},
+			want:       []Violation{{Rule: "index", Message: "evaluating expression: index out of bounds: 10"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEngine(Rules{Expressions: []Expression{tt.expression}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report := e.Evaluate(testPredicate())
+			if report.PredicateType != predicate.ProvenanceType {
+				t.Errorf("Evaluate() predicate type = %s, want %s", report.PredicateType, predicate.ProvenanceType)
+			}
+			if !reflect.DeepEqual(report.Violations, tt.want) {
+				t.Errorf("Evaluate() violations = %v, want %v", report.Violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatement(t *testing.T) {
+	e, err := NewEngine(Rules{
+		ForbiddenProcesses: []string{"/usr/bin/curl"},
+		Expressions:        []Expression{{Name: "builds", Expression: `pod.Namespace == "builds"`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustMarshal := func(v any) json.RawMessage {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	clean := predicate.Predicate{Pod: predicate.Pod{Name: "test", Namespace: "builds"}}
+	owner := predicate.Owner{Kind: "PipelineRun", Namespace: "builds", Name: "release"}
+
+	tests := []struct {
+		name          string
+		predicateType string
+		predicate     json.RawMessage
+
+		want    []Violation
+		wantErr bool
+	}{
+		{
+			name:          "passing provenance",
+			predicateType: predicate.ProvenanceType,
+			predicate:     mustMarshal(clean),
+		},
+		{
+			name:          "violating provenance",
+			predicateType: predicate.ProvenanceType,
+			predicate:     mustMarshal(testPredicate()),
+			want:          []Violation{{Rule: "forbiddenProcesses", Message: "forbidden process /usr/bin/curl was executed 2 times"}},
+		},
+		{
+			name:          "aggregate reports the violating pods",
+			predicateType: predicate.AggregateType,
+			predicate: mustMarshal(predicate.Aggregate{Owner: owner, Pods: []predicate.Predicate{
+				clean,
+				*testPredicate(),
+				{Pod: predicate.Pod{Name: "deploy", Namespace: "releases"}},
+			}}),
+			want: []Violation{
+				{Rule: "forbiddenProcesses", Message: "forbidden process /usr/bin/curl was executed 2 times", Pod: "builds/build"},
+				{Rule: "builds", Message: `pod.Namespace == "builds"`, Pod: "releases/deploy"},
+			},
+		},
+		{
+			name:          "failed aggregate",
+			predicateType: predicate.AggregateType,
+			predicate:     mustMarshal(predicate.Aggregate{Owner: owner, Failed: true, Pods: []predicate.Predicate{clean}}),
+			want:          []Violation{{Rule: "failedBuild", Message: "PipelineRun builds/release failed"}},
+		},
+		{
+			name:          "failed build",
+			predicateType: predicate.FailedBuildType,
+			predicate:     mustMarshal(clean),
+			want:          []Violation{{Rule: "failedBuild", Message: "the attestation is of a failed build"}},
+		},
+		{
+			name:          "unsupported predicate type",
+			predicateType: "https://slsa.dev/provenance/v1",
+			predicate:     mustMarshal(clean),
+			wantErr:       true,
+		},
+		{
+			name:          "invalid provenance",
+			predicateType: predicate.ProvenanceType,
+			predicate:     json.RawMessage(`{"processesExecuted": []}`),
+			wantErr:       true,
+		},
+		{
+			name:          "invalid aggregate",
+			predicateType: predicate.AggregateType,
+			predicate:     json.RawMessage(`{"pods": {}}`),
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := e.EvaluateStatement(tt.predicateType, tt.predicate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvaluateStatement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if report.PredicateType != tt.predicateType {
+				t.Errorf("EvaluateStatement() predicate type = %s, want %s", report.PredicateType, tt.predicateType)
+			}
+			if !reflect.DeepEqual(report.Violations, tt.want) {
+				t.Errorf("EvaluateStatement() violations = %v, want %v", report.Violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateAggregate(t *testing.T) {
+	e, err := NewEngine(Rules{ForbiddenPorts: []int{22}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ssh := predicate.Predicate{
+		Pod:            predicate.Pod{Name: "fetch", Namespace: "builds"},
+		TCPConnections: []predicate.TCPConnection{{DestinationAddress: "10.0.0.1", DestinationPort: 22}},
+	}
+	aggregate := &predicate.Aggregate{
+		Owner:  predicate.Owner{Kind: "Job", Namespace: "builds", Name: "nightly"},
+		Failed: true,
+		Pods:   []predicate.Predicate{{Pod: predicate.Pod{Name: "build", Namespace: "builds"}}, ssh},
+	}
+
+	report := e.EvaluateAggregate(aggregate)
+
+	want := Report{
+		PredicateType: predicate.AggregateType,
+		Violations: []Violation{
+			{Rule: "failedBuild", Message: "Job builds/nightly failed"},
+			{Rule: "forbiddenPorts", Message: "TCP connection to forbidden port 10.0.0.1:22", Pod: "builds/fetch"},
+		},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("EvaluateAggregate() = %v, want %v", report, want)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	digest := func(rules Rules) string {
+		e, err := NewEngine(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.Digest()
+	}
+
+	rules := Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}}
+	if digest(rules) != digest(Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}}) {
+		t.Error("Digest() differs for the same rules")
+	}
+	if digest(rules) == digest(Rules{ForbiddenProcesses: []string{"/usr/bin/wget"}}) {
+		t.Error("Digest() is the same for different rules")
+	}
+
+	// Parsed rules are identified by the exact document they were parsed from.
+	for _, doc := range []string{
+		"forbiddenProcesses: [/usr/bin/curl]\n",
+		"# No curl.\nforbiddenProcesses:\n- /usr/bin/curl\n",
+	} {
+		parsed, err := ParseRules([]byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(doc))
+		if got, want := digest(parsed), hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("Digest() of %q = %s, want the sha256 digest of the document %s", doc, got, want)
+		}
+	}
+
+	// Rules embedded in another document are identified by their section encoded as YAML on its own.
+	var config struct {
+		Rules Rules `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal([]byte("name: release\nrules:\n  forbiddenPorts: [22]\n"), &config); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("forbiddenPorts:\n- 22\n"))
+	if got, want := digest(config.Rules), hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("Digest() of embedded rules = %s, want the sha256 digest of their section %s", got, want)
+	}
+}
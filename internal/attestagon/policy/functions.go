@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// globMatch returns true if the path matches the glob pattern, where * and ? match within a path segment and **
+// matches across segments.
+func globMatch(path, pattern string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	ok, err := regexp.MatchString(b.String(), path)
+	return err == nil && ok
+}
+
+// cidrMatch returns true if the address is in the CIDR network. It is false if either cannot be parsed.
+func cidrMatch(address, network string) bool {
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(address)
+	return ip != nil && n.Contains(ip)
+}
+
+// domainMatch returns true if the host is the domain, or a subdomain of it if the pattern starts with "*.". Hosts are
+// compared case-insensitively and without a trailing dot.
+func domainMatch(host, pattern string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+
+	return host == pattern
+}
@@ -0,0 +1,92 @@
+package policy
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		path    string
+		pattern string
+
+		want bool
+	}{
+		{path: "/etc/passwd", pattern: "/etc/passwd", want: true},
+		{path: "/etc/passwd", pattern: "/etc/*", want: true},
+		{path: "/etc/ssh/sshd_config", pattern: "/etc/*", want: false},
+		{path: "/etc/ssh/sshd_config", pattern: "/etc/**", want: true},
+		{path: "/root/.ssh/id_rsa", pattern: "/root/**/id_*", want: true},
+		{path: "/tmp/a", pattern: "/tmp/?", want: true},
+		{path: "/tmp/ab", pattern: "/tmp/?", want: false},
+		{path: "/tmp/a/b", pattern: "/tmp/?/b", want: true},
+		{path: "/tmp//b", pattern: "/tmp/?/b", want: false},
+		{path: "/workspace/app.go", pattern: "*.go", want: false},
+		{path: "/workspace/app.go", pattern: "**.go", want: true},
+		{path: "/workspace/app+go", pattern: "/workspace/app.go", want: false},
+		{path: "/workspace/a(b)[c]", pattern: "/workspace/a(b)[c]", want: true},
+		{path: "", pattern: "", want: true},
+		{path: "/etc/passwd", pattern: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.pattern, func(t *testing.T) {
+			if got := globMatch(tt.path, tt.pattern); got != tt.want {
+				t.Errorf("globMatch(%q, %q) = %t, want %t", tt.path, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCIDRMatch(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+
+		want bool
+	}{
+		{address: "10.96.0.10", network: "10.96.0.0/12", want: true},
+		{address: "10.112.0.1", network: "10.96.0.0/12", want: false},
+		{address: "10.0.0.1", network: "10.0.0.1/32", want: true},
+		{address: "93.184.216.34", network: "0.0.0.0/0", want: true},
+		{address: "2001:db8::1", network: "2001:db8::/32", want: true},
+		{address: "2001:db9::1", network: "2001:db8::/32", want: false},
+		{address: "10.0.0.1", network: "2001:db8::/32", want: false},
+		{address: "10.0.0.1", network: "10.0.0.0", want: false},
+		{address: "localhost", network: "127.0.0.0/8", want: false},
+		{address: "", network: "0.0.0.0/0", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address+" "+tt.network, func(t *testing.T) {
+			if got := cidrMatch(tt.address, tt.network); got != tt.want {
+				t.Errorf("cidrMatch(%q, %q) = %t, want %t", tt.address, tt.network, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainMatch(t *testing.T) {
+	tests := []struct {
+		host    string
+		pattern string
+
+		want bool
+	}{
+		{host: "ghcr.io", pattern: "ghcr.io", want: true},
+		{host: "GHCR.io.", pattern: "ghcr.IO", want: true},
+		{host: "pkg.ghcr.io", pattern: "ghcr.io", want: false},
+		{host: "pkg.ghcr.io", pattern: "*.ghcr.io", want: true},
+		{host: "a.b.ghcr.io", pattern: "*.ghcr.io", want: true},
+		{host: "ghcr.io", pattern: "*.ghcr.io", want: false},
+		{host: "evilghcr.io", pattern: "*.ghcr.io", want: false},
+		{host: "ghcr.io.evil.com", pattern: "*.ghcr.io", want: false},
+		{host: "ghcr.io", pattern: "*ghcr.io", want: false},
+		{host: "", pattern: "", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+" "+tt.pattern, func(t *testing.T) {
+			if got := domainMatch(tt.host, tt.pattern); got != tt.want {
+				t.Errorf("domainMatch(%q, %q) = %t, want %t", tt.host, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
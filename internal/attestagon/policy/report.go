@@ -0,0 +1,48 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Violation is a rule the predicate of an attestation did not pass.
+type Violation struct {
+	// Rule is the name of the rule, or of the expression, that was violated.
+	Rule string `json:"rule"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+
+	// Pod is the pod of an aggregate attestation the violation is about.
+	Pod string `json:"pod,omitempty"`
+}
+
+// String returns the violation as a single line.
+func (v Violation) String() string {
+	if v.Pod != "" {
+		return fmt.Sprintf("%s: %s (pod %s)", v.Rule, v.Message, v.Pod)
+	}
+
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// Report is the result of evaluating rules against the predicate of an attestation.
+type Report struct {
+	PredicateType string      `json:"predicateType"`
+	Violations    []Violation `json:"violations"`
+}
+
+// Passed returns true if the report has no violations.
+func (r Report) Passed() bool {
+	return len(r.Violations) == 0
+}
+
+// String returns the violations of the report separated by commas.
+func (r Report) String() string {
+	violations := make([]string, 0, len(r.Violations))
+	for _, v := range r.Violations {
+		violations = append(violations, v.String())
+	}
+
+	return strings.Join(violations, ", ")
+}
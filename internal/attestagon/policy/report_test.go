@@ -0,0 +1,43 @@
+package policy
+
+import "testing"
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		violations []Violation
+
+		wantPassed bool
+		wantString string
+	}{
+		{
+			name:       "no violations",
+			wantPassed: true,
+		},
+		{
+			name:       "single violation",
+			violations: []Violation{{Rule: "forbiddenPorts", Message: "TCP connection to forbidden port 10.0.0.1:22"}},
+			wantString: "forbiddenPorts: TCP connection to forbidden port 10.0.0.1:22",
+		},
+		{
+			name: "violations of aggregated pods",
+			violations: []Violation{
+				{Rule: "failedBuild", Message: "Job builds/nightly failed"},
+				{Rule: "no-curl", Message: "curl was executed", Pod: "builds/nightly-1"},
+			},
+			wantString: "failedBuild: Job builds/nightly failed, no-curl: curl was executed (pod builds/nightly-1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Report{Violations: tt.violations}
+			if got := report.Passed(); got != tt.wantPassed {
+				t.Errorf("Passed() = %t, want %t", got, tt.wantPassed)
+			}
+			if got := report.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
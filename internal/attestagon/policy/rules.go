@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"gopkg.in/yaml.v2"
+)
+
+// Rules are checks on the predicate of an attestagon attestation. Every rule that is set must pass.
+type Rules struct {
+	// ForbiddenProcesses are processes that must not have been executed during the build.
+	ForbiddenProcesses []string `yaml:"forbiddenProcesses"`
+
+	// MaxProcessExecutions limits how many times a process may have been executed during the build.
+	MaxProcessExecutions map[string]int `yaml:"maxProcessExecutions"`
+
+	// ForbidSetuidRoot rejects builds that called setuid(0). Processes that were started as root without changing
+	// their uid are not detected.
+	ForbidSetuidRoot bool `yaml:"forbidSetuidRoot"`
+
+	// AllowedNetworks are the CIDRs TCP connections of the build may go to. If empty, connections may go anywhere.
+	AllowedNetworks []string `yaml:"allowedNetworks"`
+
+	// ForbiddenPorts are the destination ports TCP connections of the build must not go to.
+	ForbiddenPorts []int `yaml:"forbiddenPorts"`
+
+	// ForbiddenFilesWritten are glob patterns of files that must not have been written during the build, where *
+	// matches within a path segment and ** matches across segments.
+	ForbiddenFilesWritten []string `yaml:"forbiddenFilesWritten"`
+
+	// Expressions are CEL expressions the predicate must satisfy.
+	Expressions []Expression `yaml:"expressions"`
+
+	// raw is the YAML document the rules were parsed from.
+	raw []byte
+}
+
+// ParseRules parses the rules from the YAML document, which identifies them in verification summaries. Unknown and
+// duplicate keys are rejected, so that a misspelled rule fails instead of being skipped.
+func ParseRules(raw []byte) (Rules, error) {
+	// The alias has no UnmarshalYAML method, so that decoding it does not recurse.
+	type plain Rules
+
+	var rules plain
+	if err := yaml.UnmarshalStrict(raw, &rules); err != nil {
+		return Rules{}, err
+	}
+	rules.raw = raw
+
+	return Rules(rules), nil
+}
+
+// UnmarshalYAML decodes rules embedded in another YAML document, such as the configuration file. The rules are
+// identified by their section of the document encoded as YAML on its own.
+func (r *Rules) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var section yaml.MapSlice
+	if err := unmarshal(&section); err != nil {
+		return err
+	}
+
+	raw, err := yaml.Marshal(section)
+	if err != nil {
+		return err
+	}
+
+	rules, err := ParseRules(raw)
+	if err != nil {
+		return err
+	}
+	*r = rules
+
+	return nil
+}
+
+// validate returns an error if a network of the rules is invalid.
+func (r *Rules) validate() error {
+	for _, network := range r.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			return fmt.Errorf("invalid allowed network %q: %w", network, err)
+		}
+	}
+
+	return nil
+}
+
+// evaluate returns the violations of the rules other than the expressions by the predicate.
+func (r *Rules) evaluate(p *predicate.Predicate) []Violation {
+	var violations []Violation
+
+	for _, process := range r.ForbiddenProcesses {
+		if n := p.ProcessesExecuted[process]; n > 0 {
+			violations = append(violations, Violation{Rule: "forbiddenProcesses", Message: fmt.Sprintf("forbidden process %s was executed %d times", process, n)})
+		}
+	}
+
+	for _, process := range sortedKeys(r.MaxProcessExecutions) {
+		if n, max := p.ProcessesExecuted[process], r.MaxProcessExecutions[process]; n > max {
+			violations = append(violations, Violation{Rule: "maxProcessExecutions", Message: fmt.Sprintf("process %s was executed %d times, at most %d allowed", process, n, max)})
+		}
+	}
+
+	if r.ForbidSetuidRoot {
+		if n := p.UIDSet[0]; n > 0 {
+			violations = append(violations, Violation{Rule: "forbidSetuidRoot", Message: fmt.Sprintf("setuid(0) was called %d times", n)})
+		}
+	}
+
+	var networks []*net.IPNet
+	for _, network := range r.AllowedNetworks {
+		if _, n, err := net.ParseCIDR(network); err == nil {
+			networks = append(networks, n)
+		}
+	}
+
+	for _, conn := range p.TCPConnections {
+		for _, port := range r.ForbiddenPorts {
+			if conn.DestinationPort == port {
+				violations = append(violations, Violation{Rule: "forbiddenPorts", Message: fmt.Sprintf("TCP connection to forbidden port %s:%d", conn.DestinationAddress, port)})
+			}
+		}
+
+		if len(networks) > 0 && !inNetworks(conn.DestinationAddress, networks) {
+			violations = append(violations, Violation{Rule: "allowedNetworks", Message: fmt.Sprintf("TCP connection to %s:%d outside of the allowed networks", conn.DestinationAddress, conn.DestinationPort)})
+		}
+	}
+
+	for _, file := range sortedKeys(p.FilesWritten) {
+		for _, pattern := range r.ForbiddenFilesWritten {
+			if globMatch(file, pattern) {
+				violations = append(violations, Violation{Rule: "forbiddenFilesWritten", Message: fmt.Sprintf("forbidden file %s was written", file)})
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+// inNetworks returns true if the address is in one of the networks.
+func inNetworks(address string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortedKeys returns the keys of the map in order, so that violations are reported in a stable order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,213 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/predicate"
+	"gopkg.in/yaml.v2"
+)
+
+// testPredicate returns the predicate of a build that ran curl twice, called setuid(0), connected to a registry and
+// wrote an SSH key.
+func testPredicate() *predicate.Predicate {
+	return &predicate.Predicate{
+		Pod: predicate.Pod{Name: "build", Namespace: "builds"},
+		CommandsExecuted: map[string]predicate.CommandExecuted{
+			"/usr/bin/curl": {Arguments: map[string]int{"-sSL https://example.com/install.sh": 1, "-O https://example.com/app.tar.gz": 1}},
+		},
+		ProcessesExecuted: map[string]int{"/bin/sh": 1, "/usr/bin/curl": 2, "/usr/bin/go": 1},
+		ProcessTree:       map[string]map[string]int{"/bin/sh": {"/usr/bin/curl": 2, "/usr/bin/go": 1}},
+		FilesystemsMounted: []predicate.FilesystemMounted{
+			{Source: "/var/lib/kubelet/pods/build/volumes/workspace", Destination: "/workspace"},
+		},
+		TCPConnections: []predicate.TCPConnection{
+			{SocketAddress: "10.0.0.5", SocketPort: 40000, DestinationAddress: "10.96.0.10", DestinationPort: 443},
+			{SocketAddress: "10.0.0.5", SocketPort: 40001, DestinationAddress: "93.184.216.34", DestinationPort: 22},
+		},
+		UIDSet:       map[int]int{0: 3, 1000: 5},
+		FilesWritten: map[string]int{"/root/.ssh/id_rsa": 1, "/workspace/bin/app": 1},
+		FilesRead:    map[string]int{"/workspace/go.mod": 2},
+		FilesOpened:  map[string]int{"/workspace/go.mod": 2, "/etc/passwd": 1},
+		Outcome:      &predicate.Outcome{Phase: "Succeeded"},
+	}
+}
+
+func TestRulesEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+
+		want []Violation
+	}{
+		{
+			name: "no rules",
+		},
+		{
+			name:  "forbidden process executed",
+			rules: Rules{ForbiddenProcesses: []string{"/usr/bin/curl", "/usr/bin/wget"}},
+			want:  []Violation{{Rule: "forbiddenProcesses", Message: "forbidden process /usr/bin/curl was executed 2 times"}},
+		},
+		{
+			name:  "process executed too often",
+			rules: Rules{MaxProcessExecutions: map[string]int{"/usr/bin/go": 1, "/usr/bin/curl": 1}},
+			want:  []Violation{{Rule: "maxProcessExecutions", Message: "process /usr/bin/curl was executed 2 times, at most 1 allowed"}},
+		},
+		{
+			name:  "setuid root",
+			rules: Rules{ForbidSetuidRoot: true},
+			want:  []Violation{{Rule: "forbidSetuidRoot", Message: "setuid(0) was called 3 times"}},
+		},
+		{
+			name:  "connection outside of the allowed networks",
+			rules: Rules{AllowedNetworks: []string{"10.96.0.0/12", "192.168.0.0/16"}},
+			want:  []Violation{{Rule: "allowedNetworks", Message: "TCP connection to 93.184.216.34:22 outside of the allowed networks"}},
+		},
+		{
+			name:  "connection to a forbidden port",
+			rules: Rules{ForbiddenPorts: []int{22, 23}},
+			want:  []Violation{{Rule: "forbiddenPorts", Message: "TCP connection to forbidden port 93.184.216.34:22"}},
+		},
+		{
+			name:  "forbidden file written",
+			rules: Rules{ForbiddenFilesWritten: []string{"/root/.ssh/*", "/root/**"}},
+			want:  []Violation{{Rule: "forbiddenFilesWritten", Message: "forbidden file /root/.ssh/id_rsa was written"}},
+		},
+		{
+			name: "passing rules",
+			rules: Rules{
+				ForbiddenProcesses:    []string{"/usr/bin/wget"},
+				MaxProcessExecutions:  map[string]int{"/usr/bin/curl": 2},
+				AllowedNetworks:       []string{"0.0.0.0/0"},
+				ForbiddenPorts:        []int{25},
+				ForbiddenFilesWritten: []string{"/etc/**"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.evaluate(testPredicate()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+
+		want    Rules
+		wantErr bool
+	}{
+		{
+			name: "rules",
+			raw:  "forbiddenProcesses: [/usr/bin/curl]\nforbidSetuidRoot: true\nexpressions:\n- name: a\n  expression: \"true\"\n",
+			want: Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}, ForbidSetuidRoot: true, Expressions: []Expression{{Name: "a", Expression: "true"}}},
+		},
+		{
+			name:    "unknown rule",
+			raw:     "forbiddenProcess: [/usr/bin/curl]\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown expression key",
+			raw:     "expressions:\n- name: a\n  expr: \"true\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate rule",
+			raw:     "forbiddenPorts: [22]\nforbiddenPorts: [23]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got.raw = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesUnmarshalYAML(t *testing.T) {
+	var config struct {
+		Rules Rules `yaml:"rules"`
+	}
+
+	if err := yaml.Unmarshal([]byte("rules:\n  forbiddenPorts: [22]\n"), &config); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Rules.ForbiddenPorts, []int{22}) {
+		t.Errorf("Unmarshal() forbidden ports = %v, want [22]", config.Rules.ForbiddenPorts)
+	}
+
+	// Embedded rules are strict even if the document around them is not.
+	if err := yaml.Unmarshal([]byte("rules:\n  forbiddenPort: [22]\n"), &config); err == nil {
+		t.Error("Unmarshal() accepted an unknown rule")
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+
+		wantErr bool
+	}{
+		{
+			name:  "rules without expressions",
+			rules: Rules{ForbiddenProcesses: []string{"/usr/bin/curl"}, AllowedNetworks: []string{"10.0.0.0/8"}},
+		},
+		{
+			name:  "expressions",
+			rules: Rules{Expressions: []Expression{{Name: "no-curl", Expression: `!processes.exists(p, p.Binary == "/usr/bin/curl")`}}},
+		},
+		{
+			name:    "invalid allowed network",
+			rules:   Rules{AllowedNetworks: []string{"10.0.0.0"}},
+			wantErr: true,
+		},
+		{
+			name:    "expression without name",
+			rules:   Rules{Expressions: []Expression{{Expression: "true"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate expression",
+			rules:   Rules{Expressions: []Expression{{Name: "a", Expression: "true"}, {Name: "a", Expression: "false"}}},
+			wantErr: true,
+		},
+		{
+			name:    "undeclared variable",
+			rules:   Rules{Expressions: []Expression{{Name: "a", Expression: "size(containers) == 0"}}},
+			wantErr: true,
+		},
+		{
+			name:    "expression not returning bool",
+			rules:   Rules{Expressions: []Expression{{Name: "a", Expression: "size(processes)"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEngine(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewEngine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package predicate
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AggregateType is the predicate type of attestations combining the pods owned by a TaskRun, PipelineRun, Job or
+// Workflow.
+const AggregateType = "https://attestagon.io/aggregate-provenance/v0.1"
+
+// Aggregate is the predicate combining the predicates of every pod owned by a TaskRun, PipelineRun, Job or Workflow.
+type Aggregate struct {
+	CreatedAt time.Time   `json:"createdAt"`
+	Owner     Owner       `json:"owner"`
+	Failed    bool        `json:"failed,omitempty"`
+	Pods      []Predicate `json:"pods"`
+}
+
+// Owner is the object owning the pods of an Aggregate.
+type Owner struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
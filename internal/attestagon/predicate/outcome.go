@@ -0,0 +1,79 @@
+package predicate
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ProvenanceType is the predicate type of attestations of successful builds.
+	ProvenanceType = "https://attestagon.io/provenance/v0.1"
+
+	// FailedBuildType is the predicate type of attestations of failed builds. It differs from ProvenanceType so that
+	// policies accepting provenance never accept the attestation of a failed build.
+	FailedBuildType = "https://attestagon.io/failed-build/v0.1"
+)
+
+// Outcome is the outcome of the pod that ran the build.
+type Outcome struct {
+	Phase      corev1.PodPhase    `json:"phase"`
+	Reason     string             `json:"reason,omitempty"`
+	Message    string             `json:"message,omitempty"`
+	StartedAt  *time.Time         `json:"startedAt,omitempty"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+	Containers []ContainerOutcome `json:"containers"`
+}
+
+// ContainerOutcome is the outcome of a container of the pod that ran the build.
+type ContainerOutcome struct {
+	Name       string    `json:"name"`
+	Init       bool      `json:"init,omitempty"`
+	ExitCode   int32     `json:"exitCode"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// OutcomeFromPod returns the outcome of the pod from its status. Only terminated containers are included.
+func OutcomeFromPod(pod *corev1.Pod) Outcome {
+	o := Outcome{
+		Phase:   pod.Status.Phase,
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+
+	if pod.Status.StartTime != nil {
+		t := pod.Status.StartTime.Time
+		o.StartedAt = &t
+	}
+
+	add := func(statuses []corev1.ContainerStatus, init bool) {
+		for _, status := range statuses {
+			t := status.State.Terminated
+			if t == nil {
+				continue
+			}
+
+			o.Containers = append(o.Containers, ContainerOutcome{
+				Name:       status.Name,
+				Init:       init,
+				ExitCode:   t.ExitCode,
+				Reason:     t.Reason,
+				Message:    t.Message,
+				StartedAt:  t.StartedAt.Time,
+				FinishedAt: t.FinishedAt.Time,
+			})
+
+			if o.FinishedAt == nil || t.FinishedAt.Time.After(*o.FinishedAt) {
+				finishedAt := t.FinishedAt.Time
+				o.FinishedAt = &finishedAt
+			}
+		}
+	}
+	add(pod.Status.InitContainerStatuses, true)
+	add(pod.Status.ContainerStatuses, false)
+
+	return o
+}
@@ -7,12 +7,14 @@ type Predicate struct {
 	Pod                Pod                        `json:"pod"`
 	CommandsExecuted   map[string]CommandExecuted `json:"commandsExecuted"`
 	ProcessesExecuted  map[string]int             `json:"processesExecuted"`
+	ProcessTree        map[string]map[string]int  `json:"processTree,omitempty"`
 	FilesystemsMounted []FilesystemMounted        `json:"fileSystemsMounted"`
 	TCPConnections     []TCPConnection            `json:"tcpConnections"`
 	UIDSet             map[int]int                `json:"uidSet"`
 	FilesWritten       map[string]int             `json:"filesWritten"`
 	FilesRead          map[string]int             `json:"filesRead"`
 	FilesOpened        map[string]int             `json:"filesOpened"`
+	Outcome            *Outcome                   `json:"outcome,omitempty"`
 }
 
 type Pod struct {
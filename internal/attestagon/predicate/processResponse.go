@@ -21,6 +21,18 @@ func (p *Predicate) ProcessEvent(response *tetragon.GetEventsResponse, log logr.
 
 		p.ProcessesExecuted[exec.Process.Binary] = p.ProcessesExecuted[exec.Process.Binary] + 1
 
+		// Recording the process in the process tree under its parent
+		if exec.Parent != nil {
+			if p.ProcessTree == nil {
+				p.ProcessTree = make(map[string]map[string]int)
+			}
+			if p.ProcessTree[exec.Parent.Binary] == nil {
+				p.ProcessTree[exec.Parent.Binary] = make(map[string]int)
+			}
+
+			p.ProcessTree[exec.Parent.Binary][exec.Process.Binary] += 1
+		}
+
 		// Adding command execution to the "CommandsExecuted"
 		if p.CommandsExecuted == nil {
 			p.CommandsExecuted = make(map[string]CommandExecuted, 0)
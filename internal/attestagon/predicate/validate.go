@@ -0,0 +1,62 @@
+package predicate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Validate decodes the predicate of the predicate type and returns an error if it does not match the schema of the
+// type or is missing required fields.
+func Validate(predicateType string, raw json.RawMessage) error {
+	switch predicateType {
+	case ProvenanceType, FailedBuildType:
+		var p Predicate
+		if err := decodeStrict(raw, &p); err != nil {
+			return err
+		}
+		if predicateType == FailedBuildType && p.Outcome == nil {
+			return errors.New("failed build must have an outcome")
+		}
+		return nil
+
+	case AggregateType:
+		var a Aggregate
+		if err := decodeStrict(raw, &a); err != nil {
+			return err
+		}
+		if a.Owner.Kind == "" || a.Owner.Name == "" || a.Owner.UID == "" {
+			return errors.New("owner must have a kind, name and uid")
+		}
+		return nil
+
+	case VerificationSummaryType:
+		var s VerificationSummary
+		if err := decodeStrict(raw, &s); err != nil {
+			return err
+		}
+		switch {
+		case s.Verifier.ID == "":
+			return errors.New("verifier must have an id")
+		case s.Policy.URI == "":
+			return errors.New("policy must have a uri")
+		case s.VerificationResult != VerificationPassed && s.VerificationResult != VerificationFailed:
+			return fmt.Errorf("unknown verification result %q", s.VerificationResult)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown predicate type %s", predicateType)
+}
+
+// decodeStrict decodes the predicate, rejecting fields that are not part of its schema.
+func decodeStrict(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decoding predicate: %w", err)
+	}
+
+	return nil
+}
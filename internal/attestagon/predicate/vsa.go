@@ -0,0 +1,38 @@
+package predicate
+
+import "time"
+
+// VerificationSummaryType is the predicate type of SLSA verification summary attestations.
+const VerificationSummaryType = "https://slsa.dev/verification_summary/v1"
+
+const (
+	// VerificationPassed is the verification result of a summary whose policy passed.
+	VerificationPassed = "PASSED"
+
+	// VerificationFailed is the verification result of a summary whose policy failed.
+	VerificationFailed = "FAILED"
+)
+
+// VerificationSummary is the predicate of a SLSA verification summary attestation, recording the result of
+// evaluating a policy against the attestations of an artifact.
+type VerificationSummary struct {
+	Verifier           Verifier             `json:"verifier"`
+	TimeVerified       time.Time            `json:"timeVerified"`
+	ResourceURI        string               `json:"resourceUri"`
+	Policy             ResourceDescriptor   `json:"policy"`
+	InputAttestations  []ResourceDescriptor `json:"inputAttestations"`
+	VerificationResult string               `json:"verificationResult"`
+	VerifiedLevels     []string             `json:"verifiedLevels"`
+	SLSAVersion        string               `json:"slsaVersion"`
+}
+
+// Verifier identifies the verifier of a VerificationSummary.
+type Verifier struct {
+	ID string `json:"id"`
+}
+
+// ResourceDescriptor identifies a resource, such as a policy or an attestation, by URI and digest.
+type ResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
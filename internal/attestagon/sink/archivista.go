@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+)
+
+// HeaderFunc returns the headers to add to requests, e.g. for authentication.
+type HeaderFunc func(ctx context.Context) (http.Header, error)
+
+// Archivista uploads signed DSSE envelopes to an Archivista compatible attestation store.
+type Archivista struct {
+	log        logr.Logger
+	uploadURL  string
+	headers    HeaderFunc
+	maxRetries int
+
+	// client is the client used to contact Archivista.
+	client *http.Client
+}
+
+// NewArchivista constructs a new Archivista sink uploading to the Archivista instance at address. Failed uploads are
+// retried up to maxRetries times with exponential backoff.
+func NewArchivista(log logr.Logger, address string, headers HeaderFunc, maxRetries int) (*Archivista, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing archivista url %q: %w", address, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("archivista url %q must be http or https", address)
+	}
+
+	if maxRetries < 0 {
+		return nil, fmt.Errorf("archivista max retries must not be negative")
+	}
+
+	return &Archivista{
+		log:        log,
+		uploadURL:  u.JoinPath("upload").String(),
+		headers:    headers,
+		maxRetries: maxRetries,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (a *Archivista) Name() string {
+	return "archivista"
+}
+
+// Write uploads the DSSE envelope and returns the gitoid Archivista stored it under.
+func (a *Archivista) Write(ctx context.Context, att *image.Attestation) (string, error) {
+	return withRetries(ctx, a.log, a.maxRetries, func() (string, bool, error) {
+		return a.upload(ctx, att.Envelope)
+	})
+}
+
+// upload makes a single upload request, returning whether a failed request should be retried.
+func (a *Archivista) upload(ctx context.Context, envelope []byte) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.uploadURL, bytes.NewReader(envelope))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if a.headers != nil {
+		headers, err := a.headers(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("getting archivista request headers: %w", err)
+		}
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", true, fmt.Errorf("uploading to archivista: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", true, fmt.Errorf("reading archivista response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return "", retry, fmt.Errorf("archivista returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var uploadResp struct {
+		Gitoid string `json:"gitoid"`
+	}
+	if err := json.Unmarshal(body, &uploadResp); err != nil {
+		return "", false, fmt.Errorf("unmarshalling archivista response: %w", err)
+	}
+
+	if uploadResp.Gitoid == "" {
+		return "", false, fmt.Errorf("archivista response did not contain a gitoid")
+	}
+
+	return uploadResp.Gitoid, false, nil
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// testDigest is the image the attestations of the HTTP sink tests are about, which is never pulled.
+var testDigest = name.MustParseReference("registry.example.com/test/image@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa").(name.Digest)
+
+// testHeaders returns a HeaderFunc authenticating with the token.
+func testHeaders(token string) HeaderFunc {
+	return func(context.Context) (http.Header, error) {
+		return http.Header{"Authorization": []string{"Bearer " + token}}, nil
+	}
+}
+
+func TestArchivistaWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+
+		// statuses are the statuses of the responses to the requests, after which uploads succeed.
+		statuses []int
+		response string
+
+		wantErr      string
+		wantRequests int32
+	}{
+		{
+			name:         "upload",
+			response:     `{"gitoid":"abc123"}`,
+			wantRequests: 1,
+		},
+		{
+			name:         "server errors are retried",
+			maxRetries:   1,
+			statuses:     []int{http.StatusServiceUnavailable},
+			response:     `{"gitoid":"abc123"}`,
+			wantRequests: 2,
+		},
+		{
+			name:         "retries are limited",
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantErr:      "status 503",
+			wantRequests: 1,
+		},
+		{
+			name:         "client errors are not retried",
+			maxRetries:   3,
+			statuses:     []int{http.StatusBadRequest},
+			wantErr:      "status 400",
+			wantRequests: 1,
+		},
+		{
+			name:         "missing gitoid",
+			response:     `{}`,
+			wantErr:      "did not contain a gitoid",
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att, _ := testAttestation(t, testDigest)
+
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+
+				if r.Method != http.MethodPost || r.URL.Path != "/upload" {
+					t.Errorf("request %s %s, want POST /upload", r.Method, r.URL.Path)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization = %q, want the configured header", got)
+				}
+				body, _ := io.ReadAll(r.Body)
+				if !bytes.Equal(body, att.Envelope) {
+					t.Errorf("uploaded %s, want the DSSE envelope", body)
+				}
+
+				if int(n) <= len(tt.statuses) {
+					http.Error(w, "failed", tt.statuses[n-1])
+					return
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			a, err := NewArchivista(logr.Discard(), srv.URL, testHeaders("secret"), tt.maxRetries)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gitoid, err := a.Write(context.Background(), att)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("Write() error = %v", err)
+			} else if gitoid != "abc123" {
+				t.Errorf("Write() = %s, want abc123", gitoid)
+			}
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNewArchivista(t *testing.T) {
+	for _, address := range []string{"ftp://archivista.example.com", "://"} {
+		if _, err := NewArchivista(logr.Discard(), address, nil, 0); err == nil {
+			t.Errorf("NewArchivista(%q) succeeded, want an error", address)
+		}
+	}
+
+	if _, err := NewArchivista(logr.Discard(), "https://archivista.example.com", nil, -1); err == nil {
+		t.Error("NewArchivista() with negative retries succeeded, want an error")
+	}
+}
@@ -0,0 +1,184 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	bundleMediaTypeV01 = "application/vnd.dev.sigstore.bundle+json;version=0.1"
+	bundleMediaTypeV02 = "application/vnd.dev.sigstore.bundle+json;version=0.2"
+)
+
+// Bundle encodes the signed attestation as a JSON sigstore bundle.
+func Bundle(att *image.Attestation) ([]byte, error) {
+	b, _, err := bundle(att)
+	return b, err
+}
+
+// bundle encodes the signed attestation as a JSON sigstore bundle, returning it along with the bundle media type.
+func bundle(att *image.Attestation) ([]byte, string, error) {
+	envelope := new(protodsse.Envelope)
+	if err := protojson.Unmarshal(att.Envelope, envelope); err != nil {
+		return nil, "", fmt.Errorf("unmarshalling dsse envelope: %w", err)
+	}
+
+	vm, err := verificationMaterial(att)
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := &protobundle.Bundle{
+		MediaType:            bundleMediaTypeV01,
+		VerificationMaterial: vm,
+		Content:              &protobundle.Bundle_DsseEnvelope{DsseEnvelope: envelope},
+	}
+
+	// Inclusion proofs are required from version 0.2 of the bundle.
+	if len(vm.TlogEntries) > 0 && vm.TlogEntries[0].InclusionProof != nil {
+		b.MediaType = bundleMediaTypeV02
+	}
+
+	raw, err := protojson.Marshal(b)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return raw, b.MediaType, nil
+}
+
+func verificationMaterial(att *image.Attestation) (*protobundle.VerificationMaterial, error) {
+	vm := new(protobundle.VerificationMaterial)
+
+	if att.Cert != nil {
+		certs, err := cryptoutils.UnmarshalCertificatesFromPEM(append(append([]byte{}, att.Cert...), att.Chain...))
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling certificate chain: %w", err)
+		}
+
+		chain := new(protocommon.X509CertificateChain)
+		for _, cert := range certs {
+			chain.Certificates = append(chain.Certificates, &protocommon.X509Certificate{RawBytes: cert.Raw})
+		}
+		vm.Content = &protobundle.VerificationMaterial_X509CertificateChain{X509CertificateChain: chain}
+	} else {
+		hint, err := publicKeyHint(att.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		vm.Content = &protobundle.VerificationMaterial_PublicKey{PublicKey: &protocommon.PublicKeyIdentifier{Hint: hint}}
+	}
+
+	if att.RekorEntry != nil {
+		entry, err := tlogEntry(att.RekorEntry)
+		if err != nil {
+			return nil, err
+		}
+		vm.TlogEntries = []*protorekor.TransparencyLogEntry{entry}
+	}
+
+	if att.RFC3161Timestamp != nil {
+		vm.TimestampVerificationData = &protobundle.TimestampVerificationData{
+			Rfc3161Timestamps: []*protocommon.RFC3161SignedTimestamp{{SignedTimestamp: att.RFC3161Timestamp}},
+		}
+	}
+
+	return vm, nil
+}
+
+// publicKeyHint returns the hex encoded sha256 digest of the DER encoded public key.
+func publicKeyHint(pubPEM []byte) (string, error) {
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(pubPEM)
+	if err != nil {
+		return "", fmt.Errorf("unmarshalling public key: %w", err)
+	}
+
+	der, err := cryptoutils.MarshalPublicKeyToDER(pub)
+	if err != nil {
+		return "", fmt.Errorf("marshalling public key: %w", err)
+	}
+
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:]), nil
+}
+
+func tlogEntry(e *models.LogEntryAnon) (*protorekor.TransparencyLogEntry, error) {
+	if e.LogIndex == nil || e.IntegratedTime == nil || e.LogID == nil {
+		return nil, fmt.Errorf("transparency log entry is missing required fields")
+	}
+
+	bodyB64, ok := e.Body.(string)
+	if !ok {
+		return nil, fmt.Errorf("transparency log entry body is not a string")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(bodyB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding transparency log entry body: %w", err)
+	}
+
+	var kind struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(body, &kind); err != nil {
+		return nil, fmt.Errorf("unmarshalling transparency log entry body: %w", err)
+	}
+
+	logID, err := hex.DecodeString(*e.LogID)
+	if err != nil {
+		return nil, fmt.Errorf("decoding log id: %w", err)
+	}
+
+	entry := &protorekor.TransparencyLogEntry{
+		LogIndex:          *e.LogIndex,
+		LogId:             &protocommon.LogId{KeyId: logID},
+		KindVersion:       &protorekor.KindVersion{Kind: kind.Kind, Version: kind.APIVersion},
+		IntegratedTime:    *e.IntegratedTime,
+		CanonicalizedBody: body,
+	}
+
+	if e.Verification == nil {
+		return entry, nil
+	}
+
+	entry.InclusionPromise = &protorekor.InclusionPromise{SignedEntryTimestamp: e.Verification.SignedEntryTimestamp}
+
+	if p := e.Verification.InclusionProof; p != nil && p.LogIndex != nil && p.TreeSize != nil && p.RootHash != nil && p.Checkpoint != nil {
+		rootHash, err := hex.DecodeString(*p.RootHash)
+		if err != nil {
+			return nil, fmt.Errorf("decoding inclusion proof root hash: %w", err)
+		}
+
+		proof := &protorekor.InclusionProof{
+			LogIndex:   *p.LogIndex,
+			RootHash:   rootHash,
+			TreeSize:   *p.TreeSize,
+			Checkpoint: &protorekor.Checkpoint{Envelope: *p.Checkpoint},
+		}
+
+		for _, h := range p.Hashes {
+			b, err := hex.DecodeString(h)
+			if err != nil {
+				return nil, fmt.Errorf("decoding inclusion proof hash: %w", err)
+			}
+			proof.Hashes = append(proof.Hashes, b)
+		}
+
+		entry.InclusionProof = proof
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+// testLogEntry returns a transparency log entry of a DSSE envelope, with an inclusion proof if proof is true.
+func testLogEntry(proof bool) *models.LogEntryAnon {
+	logIndex, integratedTime := int64(42), int64(1700000000)
+	logID := strings.Repeat("ab", 32)
+	entry := &models.LogEntryAnon{
+		Body:           base64.StdEncoding.EncodeToString([]byte(`{"kind":"dsse","apiVersion":"0.0.1","spec":{}}`)),
+		IntegratedTime: &integratedTime,
+		LogID:          &logID,
+		LogIndex:       &logIndex,
+		Verification:   &models.LogEntryAnonVerification{SignedEntryTimestamp: []byte("signed entry timestamp")},
+	}
+
+	if proof {
+		treeSize := int64(100)
+		rootHash := strings.Repeat("cd", 32)
+		checkpoint := "rekor.sigstore.dev - 1234\n100\n...\n"
+		entry.Verification.InclusionProof = &models.InclusionProof{
+			Checkpoint: &checkpoint,
+			Hashes:     []string{strings.Repeat("ef", 32)},
+			LogIndex:   &logIndex,
+			RootHash:   &rootHash,
+			TreeSize:   &treeSize,
+		}
+	}
+
+	return entry
+}
+
+// jsonPath returns the value at the dot separated path of keys and array indexes in the decoded JSON document, or nil.
+func jsonPath(doc any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			doc = v[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i >= len(v) {
+				return nil
+			}
+			doc = v[i]
+		default:
+			return nil
+		}
+	}
+
+	return doc
+}
+
+func TestBundle(t *testing.T) {
+	att, pub := testAttestation(t, testDigest)
+
+	der, err := cryptoutils.MarshalPublicKeyToDER(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	hint := hex.EncodeToString(sum[:])
+
+	var envelope map[string]any
+	if err := json.Unmarshal(att.Envelope, &envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		rekor     *models.LogEntryAnon
+		timestamp []byte
+
+		// want are the values expected at paths of the bundle.
+		want map[string]any
+		// absent are paths that must not be set.
+		absent []string
+	}{
+		{
+			name: "public key",
+			want: map[string]any{
+				"mediaType":                           bundleMediaTypeV01,
+				"verificationMaterial.publicKey.hint": hint,
+				"dsseEnvelope.payload":                envelope["payload"],
+				"dsseEnvelope.payloadType":            envelope["payloadType"],
+			},
+			absent: []string{"verificationMaterial.tlogEntries", "verificationMaterial.timestampVerificationData"},
+		},
+		{
+			name:  "transparency log entry with inclusion promise",
+			rekor: testLogEntry(false),
+			want: map[string]any{
+				"mediaType": bundleMediaTypeV01,
+				"verificationMaterial.tlogEntries.0.logIndex":                              "42",
+				"verificationMaterial.tlogEntries.0.integratedTime":                        "1700000000",
+				"verificationMaterial.tlogEntries.0.kindVersion.kind":                      "dsse",
+				"verificationMaterial.tlogEntries.0.kindVersion.version":                   "0.0.1",
+				"verificationMaterial.tlogEntries.0.inclusionPromise.signedEntryTimestamp": base64.StdEncoding.EncodeToString([]byte("signed entry timestamp")),
+			},
+			absent: []string{"verificationMaterial.tlogEntries.0.inclusionProof"},
+		},
+		{
+			name:  "transparency log entry with inclusion proof",
+			rekor: testLogEntry(true),
+			want: map[string]any{
+				"mediaType": bundleMediaTypeV02,
+				"verificationMaterial.tlogEntries.0.inclusionProof.treeSize":            "100",
+				"verificationMaterial.tlogEntries.0.inclusionProof.checkpoint.envelope": "rekor.sigstore.dev - 1234\n100\n...\n",
+			},
+		},
+		{
+			name:      "timestamp",
+			timestamp: []byte("timestamp response"),
+			want: map[string]any{
+				"verificationMaterial.timestampVerificationData.rfc3161Timestamps.0.signedTimestamp": base64.StdEncoding.EncodeToString([]byte("timestamp response")),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att := *att
+			att.RekorEntry = tt.rekor
+			att.RFC3161Timestamp = tt.timestamp
+
+			raw, err := Bundle(&att)
+			if err != nil {
+				t.Fatalf("Bundle() error = %v", err)
+			}
+
+			var doc any
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				t.Fatalf("Bundle() = %s, not JSON: %v", raw, err)
+			}
+
+			for key, want := range tt.want {
+				if got := jsonPath(doc, key); !reflect.DeepEqual(got, want) {
+					t.Errorf("Bundle() %s = %v, want %v", key, got, want)
+				}
+			}
+			for _, key := range tt.absent {
+				if got := jsonPath(doc, key); got != nil {
+					t.Errorf("Bundle() %s = %v, want it unset", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBundleCertificateChain(t *testing.T) {
+	att, _ := testAttestation(t, testDigest)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := cryptoutils.MarshalCertificateToPEM(&x509.Certificate{Raw: der})
+	if err != nil {
+		t.Fatal(err)
+	}
+	att.Cert = cert
+
+	raw, err := Bundle(att)
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := jsonPath(doc, "verificationMaterial.x509CertificateChain.certificates.0.rawBytes"); got != base64.StdEncoding.EncodeToString(der) {
+		t.Errorf("Bundle() certificate = %v, want the signing certificate", got)
+	}
+	if got := jsonPath(doc, "verificationMaterial.publicKey"); got != nil {
+		t.Errorf("Bundle() public key = %v, want only the certificate chain", got)
+	}
+}
+
+func TestBundleInvalidLogEntry(t *testing.T) {
+	att, _ := testAttestation(t, testDigest)
+
+	entry := testLogEntry(false)
+	entry.LogIndex = nil
+	att.RekorEntry = entry
+
+	if _, err := Bundle(att); err == nil {
+		t.Error("Bundle() accepted a log entry without a log index")
+	}
+}
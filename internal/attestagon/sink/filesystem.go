@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+)
+
+const (
+	// FormatBundle writes attestations as sigstore bundles.
+	FormatBundle = "bundle"
+
+	// FormatDSSE writes attestations as bare DSSE envelopes.
+	FormatDSSE = "dsse"
+)
+
+// Filesystem writes signed attestations to a directory, e.g. a mounted PVC.
+type Filesystem struct {
+	dir    string
+	format string
+}
+
+// NewFilesystem constructs a new Filesystem sink writing to dir in the given format.
+func NewFilesystem(dir, format string) (*Filesystem, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("filesystem sink path must not be empty")
+	}
+
+	switch format {
+	case "":
+		format = FormatBundle
+	case FormatBundle, FormatDSSE:
+	default:
+		return nil, fmt.Errorf("unknown filesystem sink format %q", format)
+	}
+
+	return &Filesystem{dir: dir, format: format}, nil
+}
+
+func (f *Filesystem) Name() string {
+	return "filesystem"
+}
+
+// Write writes the attestation to a file in the directory of the sink, creating the directory if it does not exist.
+func (f *Filesystem) Write(_ context.Context, att *image.Attestation) (string, error) {
+	var (
+		data []byte
+		ext  string
+		err  error
+	)
+
+	switch f.format {
+	case FormatDSSE:
+		data, ext = att.Envelope, "dsse.json"
+	default:
+		ext = "sigstore.json"
+		data, err = Bundle(att)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	alg, subject, err := subjectDigest(att)
+	if err != nil {
+		return "", err
+	}
+
+	statement, err := att.StatementDigest()
+	if err != nil {
+		return "", err
+	}
+
+	// The filename is derived from the subject and the statement so that
+	// writing the same attestation twice replaces the earlier file.
+	path := filepath.Join(f.dir, fmt.Sprintf("%s-%s.%s.%s", alg, subject, statement, ext))
+
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return "", fmt.Errorf("creating filesystem sink directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(f.dir, ".attestagon-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
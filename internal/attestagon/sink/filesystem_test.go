@@ -0,0 +1,128 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestNewFilesystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    string
+		format string
+
+		wantFormat string
+		wantErr    bool
+	}{
+		{name: "default format", dir: "/attestations", wantFormat: FormatBundle},
+		{name: "dsse", dir: "/attestations", format: FormatDSSE, wantFormat: FormatDSSE},
+		{name: "no path", format: FormatBundle, wantErr: true},
+		{name: "unknown format", dir: "/attestations", format: "jsonl", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilesystem(tt.dir, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFilesystem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && f.format != tt.wantFormat {
+				t.Errorf("NewFilesystem() format = %s, want %s", f.format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestFilesystemWrite(t *testing.T) {
+	att, _ := testAttestation(t, testDigest)
+	statement, err := att.StatementDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := strings.TrimPrefix(testDigest.DigestStr(), "sha256:")
+
+	tests := []struct {
+		name   string
+		format string
+
+		wantName string
+	}{
+		{name: "bundle", format: FormatBundle, wantName: "sha256-" + subject + "." + statement + ".sigstore.json"},
+		{name: "dsse", format: FormatDSSE, wantName: "sha256-" + subject + "." + statement + ".dsse.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The directory does not exist yet and is created by the first write.
+			dir := filepath.Join(t.TempDir(), "attestations")
+			f, err := NewFilesystem(dir, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := f.Write(context.Background(), att)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if want := filepath.Join(dir, tt.wantName); path != want {
+				t.Errorf("Write() = %s, want %s", path, want)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.format == FormatDSSE {
+				if !bytes.Equal(data, att.Envelope) {
+					t.Errorf("written %s, want the DSSE envelope", data)
+				}
+			} else {
+				b := new(protobundle.Bundle)
+				if err := protojson.Unmarshal(data, b); err != nil || b.GetDsseEnvelope() == nil {
+					t.Errorf("written %s, want a sigstore bundle of the DSSE envelope: %v", data, err)
+				}
+			}
+
+			// Writing the same attestation again replaces the file, leaving no temporary files behind.
+			again, err := f.Write(context.Background(), att)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if again != path {
+				t.Errorf("Write() = %s the second time, want %s", again, path)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != tt.wantName {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("directory has %v, want only %s", names, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestFilesystemWriteWithoutSubject(t *testing.T) {
+	att, _ := testAttestation(t, testDigest)
+	att.Statement.Subject = nil
+
+	f, err := NewFilesystem(t.TempDir(), FormatDSSE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(context.Background(), att); err == nil {
+		t.Error("Write() wrote an attestation without a subject")
+	}
+}
@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+)
+
+// HTTP posts signed attestations to an HTTP endpoint, e.g. an artifact
+// repository that stores attestations next to release files.
+type HTTP struct {
+	log        logr.Logger
+	url        string
+	format     string
+	headers    HeaderFunc
+	maxRetries int
+
+	// client is the client used to contact the endpoint.
+	client *http.Client
+}
+
+// NewHTTP constructs a new HTTP sink posting to address in the given format. Failed requests are retried up to
+// maxRetries times with exponential backoff.
+func NewHTTP(log logr.Logger, address, format string, headers HeaderFunc, maxRetries int) (*HTTP, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing http sink url %q: %w", address, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("http sink url %q must be http or https", address)
+	}
+
+	switch format {
+	case "":
+		format = FormatBundle
+	case FormatBundle, FormatDSSE:
+	default:
+		return nil, fmt.Errorf("unknown http sink format %q", format)
+	}
+
+	if maxRetries < 0 {
+		return nil, fmt.Errorf("http sink max retries must not be negative")
+	}
+
+	return &HTTP{
+		log:        log,
+		url:        u.String(),
+		format:     format,
+		headers:    headers,
+		maxRetries: maxRetries,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (h *HTTP) Name() string {
+	return "http"
+}
+
+// Write posts the attestation and returns the Location of the created resource, or the sink URL if the response has
+// no Location header.
+func (h *HTTP) Write(ctx context.Context, att *image.Attestation) (string, error) {
+	data, contentType := att.Envelope, "application/json"
+	if h.format == FormatBundle {
+		var err error
+		data, contentType, err = bundle(att)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return withRetries(ctx, h.log, h.maxRetries, func() (string, bool, error) {
+		return h.post(ctx, data, contentType)
+	})
+}
+
+// post makes a single request, returning whether a failed request should be retried.
+func (h *HTTP) post(ctx context.Context, data []byte, contentType string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	if h.headers != nil {
+		headers, err := h.headers(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("getting http sink request headers: %w", err)
+		}
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", true, fmt.Errorf("posting attestation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return "", retry, fmt.Errorf("http sink returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if location, err := resp.Location(); err == nil {
+		return location.String(), false, nil
+	}
+
+	return h.url, false, nil
+}
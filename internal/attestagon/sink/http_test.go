@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestHTTPWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		location string
+
+		wantContentType string
+		wantLocation    string
+	}{
+		{
+			name:            "bundle",
+			format:          FormatBundle,
+			wantContentType: bundleMediaTypeV01,
+		},
+		{
+			name:            "dsse with location",
+			format:          FormatDSSE,
+			location:        "/attestations/1",
+			wantContentType: "application/json",
+			wantLocation:    "/attestations/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att, _ := testAttestation(t, testDigest)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Type"); got != tt.wantContentType {
+					t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+				}
+
+				body, _ := io.ReadAll(r.Body)
+				if tt.format == FormatBundle {
+					b := new(protobundle.Bundle)
+					if err := protojson.Unmarshal(body, b); err != nil {
+						t.Errorf("posted bundle does not decode: %v", err)
+					} else if b.GetDsseEnvelope() == nil || b.GetVerificationMaterial().GetPublicKey() == nil {
+						t.Errorf("posted bundle = %s, want a DSSE envelope with a public key hint", body)
+					}
+				} else if !json.Valid(body) || !bytes.Equal(body, att.Envelope) {
+					t.Errorf("posted %s, want the DSSE envelope", body)
+				}
+
+				if tt.location != "" {
+					w.Header().Set("Location", tt.location)
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			h, err := NewHTTP(logr.Discard(), srv.URL+"/attestations", tt.format, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			location, err := h.Write(context.Background(), att)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			want := srv.URL + "/attestations"
+			if tt.wantLocation != "" {
+				want = srv.URL + tt.wantLocation
+			}
+			if location != want {
+				t.Errorf("Write() = %s, want %s", location, want)
+			}
+		})
+	}
+}
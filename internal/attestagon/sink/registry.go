@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	// StorageTag stores attestations using the cosign tag scheme (sha256-<digest>.att).
+	StorageTag = "tag"
+
+	// StorageReferrers stores attestations as OCI 1.1 referrers of the subject,
+	// falling back to the cosign tag scheme if the registry does not support
+	// the referrers API.
+	StorageReferrers = "referrers"
+)
+
+// Registry attaches attestations to each image subject in an OCI registry.
+type Registry struct {
+	log        logr.Logger
+	storage    string
+	remoteOpts image.RemoteOptions
+}
+
+// NewRegistry constructs a new Registry sink that pushes attestations next to the image subjects using the storage
+// mode.
+func NewRegistry(log logr.Logger, storage string, remoteOpts image.RemoteOptions) (*Registry, error) {
+	switch storage {
+	case "":
+		storage = StorageTag
+	case StorageTag, StorageReferrers:
+	default:
+		return nil, fmt.Errorf("unknown registry storage mode %q", storage)
+	}
+
+	return &Registry{log: log, storage: storage, remoteOpts: remoteOpts}, nil
+}
+
+func (r *Registry) Name() string {
+	return "registry"
+}
+
+// Write attaches the attestation to every image of the attestation, returning the comma separated locations. An
+// attestation without image subjects, e.g. of a build producing only files, is not written anywhere.
+func (r *Registry) Write(ctx context.Context, att *image.Attestation) (string, error) {
+	var locations []string
+	for _, digest := range att.Images {
+		location, err := r.write(ctx, att, digest)
+		if err != nil {
+			return strings.Join(locations, ","), fmt.Errorf("attaching attestation to %s: %w", digest, err)
+		}
+		locations = append(locations, location)
+	}
+
+	return strings.Join(locations, ","), nil
+}
+
+// write attaches the attestation to a single image.
+func (r *Registry) write(ctx context.Context, att *image.Attestation, digest name.Digest) (string, error) {
+	if r.storage == StorageReferrers {
+		supported, err := image.ReferrersSupported(ctx, digest, r.remoteOpts)
+		if err != nil {
+			return "", fmt.Errorf("checking referrers API support: %w", err)
+		}
+
+		if supported {
+			return r.writeReferrer(ctx, att, digest)
+		}
+
+		r.log.Info("Registry does not support the referrers API, falling back to the tag scheme", "repository", digest.Context().String())
+	}
+
+	if err := image.Push(ctx, att, digest, r.remoteOpts); err != nil {
+		return "", err
+	}
+
+	return digest.String(), nil
+}
+
+// writeReferrer pushes the attestation as a sigstore bundle referring to the subject digest.
+func (r *Registry) writeReferrer(ctx context.Context, att *image.Attestation, digest name.Digest) (string, error) {
+	bundle, mediaType, err := bundle(att)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := image.PushReferrer(ctx, digest, mediaType, bundle, map[string]string{
+		"dev.sigstore.bundle.content":       "dsse-envelope",
+		"dev.sigstore.bundle.predicateType": att.Statement.PredicateType,
+	}, r.remoteOpts)
+	if err != nil {
+		return "", err
+	}
+
+	return ref.String(), nil
+}
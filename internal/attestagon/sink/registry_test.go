@@ -0,0 +1,169 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+const testPredicateType = "https://attestagon.io/provenance/v0.1"
+
+// testImage pushes a random image to the registry, returning its digest reference.
+func testImage(t *testing.T, host string) name.Digest {
+	t.Helper()
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(host + "/test/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref.Context().Digest(h.String())
+}
+
+// testAttestation signs a statement about the image with a new key, returning the attestation and the key.
+func testAttestation(t *testing.T, digest name.Digest) (*image.Attestation, crypto.PublicKey) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement := in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v0.1",
+			PredicateType: testPredicateType,
+			Subject: []in_toto.Subject{{
+				Name:   digest.Context().String(),
+				Digest: map[string]string{"sha256": strings.TrimPrefix(digest.DigestStr(), "sha256:")},
+			}},
+		},
+		Predicate: map[string]string{"test": "value"},
+	}
+
+	att, err := image.Sign(context.Background(), statement, image.SignerOptions{Key: sv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	att.Images = []name.Digest{digest}
+
+	return att, priv.Public()
+}
+
+func TestRegistryWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		storage   string
+		referrers bool
+
+		wantReferrer bool
+	}{
+		{name: "tag scheme", storage: StorageTag, referrers: true},
+		{name: "referrers", storage: StorageReferrers, referrers: true, wantReferrer: true},
+		{name: "referrers fall back to the tag scheme", storage: StorageReferrers, referrers: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0)), registry.WithReferrersSupport(tt.referrers)))
+			defer srv.Close()
+			host := strings.TrimPrefix(srv.URL, "http://")
+
+			digest := testImage(t, host)
+			att, pub := testAttestation(t, digest)
+
+			r, err := NewRegistry(logr.Discard(), tt.storage, image.RemoteOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			location, err := r.Write(ctx, att)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if tt.wantReferrer {
+				if location == digest.String() {
+					t.Errorf("Write() location = %s, want the referrer manifest", location)
+				}
+			} else if location != digest.String() {
+				t.Errorf("Write() location = %s, want %s", location, digest)
+			}
+
+			// The cosign tag only exists with the tag scheme.
+			attTag := digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + ".att")
+			_, err = remote.Head(attTag)
+			if tt.wantReferrer && err == nil {
+				t.Errorf("attestation tag %s exists with referrers storage", attTag)
+			} else if !tt.wantReferrer && err != nil {
+				t.Errorf("attestation tag %s: %v", attTag, err)
+			}
+
+			statements, err := image.VerifyAttestations(ctx, digest, image.VerifyOptions{PublicKeys: []crypto.PublicKey{pub}}, image.RemoteOptions{})
+			if err != nil {
+				t.Fatalf("VerifyAttestations() error = %v", err)
+			}
+			if len(statements) != 1 || statements[0].PredicateType != testPredicateType {
+				t.Errorf("VerifyAttestations() = %+v, want a single %s statement", statements, testPredicateType)
+			}
+		})
+	}
+}
+
+func TestRegistryWriteRejectsOtherKeys(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0)), registry.WithReferrersSupport(true)))
+	defer srv.Close()
+
+	digest := testImage(t, strings.TrimPrefix(srv.URL, "http://"))
+	att, _ := testAttestation(t, digest)
+	_, other := testAttestation(t, digest)
+
+	r, err := NewRegistry(logr.Discard(), StorageReferrers, image.RemoteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write(ctx, att); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := image.VerifyAttestations(ctx, digest, image.VerifyOptions{PublicKeys: []crypto.PublicKey{other}}, image.RemoteOptions{}); err == nil {
+		t.Error("VerifyAttestations() verified an attestation signed with another key")
+	}
+}
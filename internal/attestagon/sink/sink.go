@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/go-logr/logr"
+)
+
+// Sink is a destination that signed attestations are written to.
+type Sink interface {
+	// Name returns the name of the sink, used for logging.
+	Name() string
+
+	// Write stores the signed attestation and returns the location it was written to.
+	Write(ctx context.Context, att *image.Attestation) (string, error)
+}
+
+// subjectDigest returns the algorithm and digest of the first subject of the attestation, preferring sha256.
+func subjectDigest(att *image.Attestation) (string, string, error) {
+	if len(att.Statement.Subject) == 0 {
+		return "", "", fmt.Errorf("attestation has no subject")
+	}
+
+	subject := att.Statement.Subject[0]
+	for _, alg := range []string{"sha256", "sha512", "sha384"} {
+		if digest, ok := subject.Digest[alg]; ok {
+			return alg, digest, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("attestation subject %q has no supported digest", subject.Name)
+}
+
+// withRetries calls fn until it succeeds, fails with an error that should not be retried, or has been retried
+// maxRetries times, waiting with exponential backoff between attempts.
+func withRetries(ctx context.Context, log logr.Logger, maxRetries int, fn func() (string, bool, error)) (string, error) {
+	backoff := 500 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		location, retry, err := fn()
+		if err == nil {
+			return location, nil
+		}
+
+		if !retry || attempt >= maxRetries {
+			return "", err
+		}
+
+		log.Info("Failed to write attestation, retrying", "attempt", attempt+1, "backoff", backoff, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,38 @@
+package subject
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DigestAnnotation is the pod annotation holding the digest of the built
+// artifact, either as <digest> or <image>@<digest>.
+const DigestAnnotation = "attestagon.io/subject-digest"
+
+// Annotation resolves the subject from the attestagon.io/subject-digest pod annotation.
+type Annotation struct{}
+
+func (Annotation) Name() string {
+	return "annotation"
+}
+
+func (Annotation) Resolve(_ context.Context, pod *corev1.Pod) ([]Subject, error) {
+	value, ok := pod.Annotations[DigestAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	name, digest, ok := strings.Cut(value, "@")
+	if !ok {
+		name, digest = "", value
+	}
+
+	d, err := parseDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Subject{{Name: imageName(name), Digest: d, Type: TypeImage}}, nil
+}
@@ -0,0 +1,87 @@
+package subject
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BuildKitMetadataFile is the name of the buildctl --metadata-file read from the shared volume.
+const BuildKitMetadataFile = "metadata.json"
+
+// buildKitMetadata is the metadata written by buildctl --metadata-file and docker buildx --metadata-file.
+type buildKitMetadata struct {
+	Digest    string `json:"containerimage.digest"`
+	ImageName string `json:"image.name"`
+}
+
+// BuildKit resolves the subjects from the BuildKit metadata file. The file is
+// either written to the termination log of the container
+// (--metadata-file=/dev/termination-log) or to a volume shared with the
+// controller at <SharedVolumePath>/<namespace>/<pod>/metadata.json.
+type BuildKit struct {
+	// SharedVolumePath is the path the volume shared with build pods is
+	// mounted at in the controller. If empty, only termination messages are read.
+	SharedVolumePath string
+}
+
+func (BuildKit) Name() string {
+	return "buildkit"
+}
+
+func (b BuildKit) Resolve(_ context.Context, pod *corev1.Pod) ([]Subject, error) {
+	for _, message := range terminationMessages(pod) {
+		if subjects, err := buildKitSubjects([]byte(message)); err == nil && len(subjects) > 0 {
+			return subjects, nil
+		}
+	}
+
+	if b.SharedVolumePath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.SharedVolumePath, pod.Namespace, pod.Name, BuildKitMetadataFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buildKitSubjects(data)
+}
+
+// buildKitSubjects returns a subject for each image name in the metadata.
+func buildKitSubjects(data []byte) ([]Subject, error) {
+	var md buildKitMetadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, err
+	}
+
+	if md.Digest == "" {
+		return nil, nil
+	}
+
+	digest, err := parseDigest(md.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []Subject
+	for _, name := range strings.Split(md.ImageName, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			subjects = append(subjects, Subject{Name: imageName(name), Digest: digest, Type: TypeImage})
+		}
+	}
+
+	if len(subjects) == 0 {
+		subjects = append(subjects, Subject{Digest: digest, Type: TypeImage})
+	}
+
+	return subjects, nil
+}
@@ -0,0 +1,55 @@
+package subject
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KanikoDigestFile is the name of the kaniko --digest-file read from the shared volume.
+const KanikoDigestFile = "digest"
+
+// Kaniko resolves the subject from the file written by kaniko's --digest-file
+// flag. The file is either written to the termination log of the container
+// (--digest-file=/dev/termination-log) or to a volume shared with the
+// controller at <SharedVolumePath>/<namespace>/<pod>/digest.
+type Kaniko struct {
+	// SharedVolumePath is the path the volume shared with build pods is
+	// mounted at in the controller. If empty, only termination messages are read.
+	SharedVolumePath string
+}
+
+func (Kaniko) Name() string {
+	return "kaniko"
+}
+
+func (k Kaniko) Resolve(_ context.Context, pod *corev1.Pod) ([]Subject, error) {
+	for _, message := range terminationMessages(pod) {
+		if digest, err := parseDigest(strings.TrimSpace(message)); err == nil {
+			return []Subject{{Digest: digest, Type: TypeImage}}, nil
+		}
+	}
+
+	if k.SharedVolumePath == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(k.SharedVolumePath, pod.Namespace, pod.Name, KanikoDigestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := parseDigest(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	return []Subject{{Digest: digest, Type: TypeImage}}, nil
+}
@@ -0,0 +1,84 @@
+package subject
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ManifestFile is the name of the subject manifest read from the shared volume.
+const ManifestFile = "subjects.json"
+
+// manifest lists the files produced by a build, e.g.
+//
+//	{"subjects": [{"name": "app_linux_amd64.tar.gz", "digest": {"sha256": "...", "sha512": "..."}}]}
+type manifest struct {
+	Subjects []struct {
+		Name   string    `json:"name"`
+		Digest DigestSet `json:"digest"`
+	} `json:"subjects"`
+}
+
+// Manifest resolves file subjects, such as release tarballs, binaries or Helm
+// charts, from a manifest written by the build. The manifest is either written
+// to the termination log of the container or to a volume shared with the
+// controller at <SharedVolumePath>/<namespace>/<pod>/subjects.json.
+type Manifest struct {
+	// SharedVolumePath is the path the volume shared with build pods is
+	// mounted at in the controller. If empty, only termination messages are read.
+	SharedVolumePath string
+}
+
+func (Manifest) Name() string {
+	return "manifest"
+}
+
+func (m Manifest) Resolve(_ context.Context, pod *corev1.Pod) ([]Subject, error) {
+	for _, message := range terminationMessages(pod) {
+		if subjects, err := manifestSubjects([]byte(message)); err == nil && len(subjects) > 0 {
+			return subjects, nil
+		}
+	}
+
+	if m.SharedVolumePath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.SharedVolumePath, pod.Namespace, pod.Name, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return manifestSubjects(data)
+}
+
+// manifestSubjects returns a file subject for each entry in the manifest.
+func manifestSubjects(data []byte) ([]Subject, error) {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	var subjects []Subject
+	for _, s := range m.Subjects {
+		if s.Name == "" {
+			return nil, errors.New("manifest subject has no name")
+		}
+
+		if err := s.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("manifest subject %q: %w", s.Name, err)
+		}
+
+		subjects = append(subjects, Subject{Name: s.Name, Digest: s.Digest, Type: TypeFile})
+	}
+
+	return subjects, nil
+}
@@ -0,0 +1,37 @@
+package subject
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Registry resolves the subject by looking up the digest of a tag that the
+// build pushed to the registry.
+type Registry struct {
+	// Ref is the tagged image reference pushed by the build.
+	Ref string
+
+	// RemoteOptions configures how the registry is accessed.
+	RemoteOptions image.RemoteOptions
+}
+
+func (Registry) Name() string {
+	return "registry"
+}
+
+func (r Registry) Resolve(ctx context.Context, _ *corev1.Pod) ([]Subject, error) {
+	digest, err := image.ResolveDigest(ctx, r.Ref, r.RemoteOptions)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", r.Ref, err)
+	}
+
+	d, err := parseDigest(digest.DigestStr())
+	if err != nil {
+		return nil, err
+	}
+
+	return []Subject{{Name: digest.Context().Name(), Digest: d, Type: TypeImage}}, nil
+}
@@ -0,0 +1,145 @@
+package subject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// digestLengths are the lengths of the hex encoded digests of the supported algorithms.
+var digestLengths = map[string]int{
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// hexRegex matches a lowercase hex encoded string.
+var hexRegex = regexp.MustCompile(`^[a-f0-9]+$`)
+
+// Type is the kind of artifact a subject is.
+type Type string
+
+const (
+	// TypeImage is an OCI image or index stored in a registry.
+	TypeImage Type = "image"
+
+	// TypeFile is a file, e.g. a release tarball, binary or Helm chart, stored
+	// outside of a registry.
+	TypeFile Type = "file"
+)
+
+// DigestSet maps digest algorithms, e.g. sha256, to hex encoded digests.
+type DigestSet map[string]string
+
+// OCI returns the digest in the form sha256:<hex> used by OCI registries.
+func (d DigestSet) OCI() (string, bool) {
+	hex, ok := d["sha256"]
+	if !ok {
+		return "", false
+	}
+	return "sha256:" + hex, true
+}
+
+// Validate returns an error if the set is empty or contains a digest of an
+// unsupported algorithm or of the wrong length.
+func (d DigestSet) Validate() error {
+	if len(d) == 0 {
+		return errors.New("no digests")
+	}
+
+	for alg, hex := range d {
+		length, ok := digestLengths[alg]
+		if !ok {
+			return fmt.Errorf("unsupported digest algorithm %q", alg)
+		}
+		if len(hex) != length || !hexRegex.MatchString(hex) {
+			return fmt.Errorf("invalid %s digest %q", alg, hex)
+		}
+	}
+
+	return nil
+}
+
+// Subject is an artifact produced by a build pod.
+type Subject struct {
+	// Name is the name of the artifact, e.g. the image repository or file
+	// name. It may be empty for images if the resolver does not know the name.
+	Name string
+
+	// Digest are the digests of the artifact.
+	Digest DigestSet
+
+	// Type is the kind of artifact.
+	Type Type
+
+	// Result is the name of the build result the subject was read from, if
+	// any, e.g. the Tekton result name.
+	Result string
+}
+
+// Resolver discovers the subjects produced by a pod.
+type Resolver interface {
+	// Name returns the name of the resolver, used for logging.
+	Name() string
+
+	// Resolve returns the subjects produced by the pod, or no subjects if the
+	// resolver found none.
+	Resolve(ctx context.Context, pod *corev1.Pod) ([]Subject, error)
+}
+
+// Chain is a list of resolvers that are tried in order.
+type Chain []Resolver
+
+// ErrNotFound is returned when no resolver in the chain found a subject.
+var ErrNotFound = errors.New("could not find any subjects for pod")
+
+// Resolve returns the subjects found by the first resolver that finds any,
+// along with the name of that resolver. Errors from resolvers are collected
+// and returned if no resolver finds a subject.
+func (c Chain) Resolve(ctx context.Context, pod *corev1.Pod) ([]Subject, string, error) {
+	var errs []error
+	for _, r := range c {
+		subjects, err := r.Resolve(ctx, pod)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name(), err))
+			continue
+		}
+
+		if len(subjects) > 0 {
+			return subjects, r.Name(), nil
+		}
+	}
+
+	return nil, "", errors.Join(append([]error{ErrNotFound}, errs...)...)
+}
+
+// parseDigest parses a digest in the form <algorithm>:<hex>.
+func parseDigest(digest string) (DigestSet, error) {
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+
+	d := DigestSet{alg: hex}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// terminationMessages returns the termination messages of the terminated containers of the pod.
+func terminationMessages(pod *corev1.Pod) []string {
+	var messages []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated == nil || status.State.Terminated.Message == "" {
+			continue
+		}
+		messages = append(messages, status.State.Terminated.Message)
+	}
+	return messages
+}
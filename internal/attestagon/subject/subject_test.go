@@ -0,0 +1,215 @@
+package subject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chaosinthecrd/attestagon/internal/attestagon/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// buildPod returns a pod with the annotations whose containers terminated with the termination messages.
+func buildPod(annotations map[string]string, messages ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "builds", Annotations: annotations}}
+	for _, message := range messages {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  "build",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+		})
+	}
+	return pod
+}
+
+// sharedVolume returns a shared volume with the files written by the build pod.
+func sharedVolume(t *testing.T, pod *corev1.Pod, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	podDir := filepath.Join(dir, pod.Namespace, pod.Name)
+	if err := os.MkdirAll(podDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(podDir, file), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestFileResolvers(t *testing.T) {
+	pod := buildPod(nil)
+	imageSubject := Subject{Digest: DigestSet{"sha256": digestA}, Type: TypeImage}
+
+	tests := []struct {
+		name     string
+		resolver func(volume string) Resolver
+		pod      *corev1.Pod
+		files    map[string]string
+
+		want    []Subject
+		wantErr bool
+	}{
+		{
+			name:     "annotation digest",
+			resolver: func(string) Resolver { return Annotation{} },
+			pod:      buildPod(map[string]string{DigestAnnotation: "sha256:" + digestA}),
+			want:     []Subject{imageSubject},
+		},
+		{
+			name:     "annotation reference",
+			resolver: func(string) Resolver { return Annotation{} },
+			pod:      buildPod(map[string]string{DigestAnnotation: "ghcr.io/example/app:v1@sha256:" + digestA}),
+			want:     []Subject{{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage}},
+		},
+		{
+			name:     "invalid annotation",
+			resolver: func(string) Resolver { return Annotation{} },
+			pod:      buildPod(map[string]string{DigestAnnotation: "md5:" + digestA}),
+			wantErr:  true,
+		},
+		{
+			name:     "kaniko termination log",
+			resolver: func(string) Resolver { return Kaniko{} },
+			pod:      buildPod(nil, "sha256:"+digestA+"\n"),
+			want:     []Subject{imageSubject},
+		},
+		{
+			name:     "kaniko digest file",
+			resolver: func(volume string) Resolver { return Kaniko{SharedVolumePath: volume} },
+			pod:      pod,
+			files:    map[string]string{KanikoDigestFile: "sha256:" + digestA},
+			want:     []Subject{imageSubject},
+		},
+		{
+			name:     "no kaniko digest file",
+			resolver: func(volume string) Resolver { return Kaniko{SharedVolumePath: volume} },
+			pod:      pod,
+		},
+		{
+			name:     "buildkit termination log",
+			resolver: func(string) Resolver { return BuildKit{} },
+			pod:      buildPod(nil, `{"containerimage.digest":"sha256:`+digestA+`","image.name":"ghcr.io/example/app:v1,ghcr.io/example/app:latest"}`),
+			want: []Subject{
+				{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage},
+				{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage},
+			},
+		},
+		{
+			name:     "buildkit metadata file without image name",
+			resolver: func(volume string) Resolver { return BuildKit{SharedVolumePath: volume} },
+			pod:      pod,
+			files:    map[string]string{BuildKitMetadataFile: `{"buildx.build.ref":"builder/builder0/abc","containerimage.digest":"sha256:` + digestA + `"}`},
+			want:     []Subject{imageSubject},
+		},
+		{
+			name:     "malformed buildkit metadata file",
+			resolver: func(volume string) Resolver { return BuildKit{SharedVolumePath: volume} },
+			pod:      pod,
+			files:    map[string]string{BuildKitMetadataFile: `{`},
+			wantErr:  true,
+		},
+		{
+			name:     "manifest file",
+			resolver: func(volume string) Resolver { return Manifest{SharedVolumePath: volume} },
+			pod:      pod,
+			files:    map[string]string{ManifestFile: `{"subjects":[{"name":"app_linux_amd64.tar.gz","digest":{"sha256":"` + digestA + `","sha512":"` + strings.Repeat("c", 128) + `"}}]}`},
+			want:     []Subject{{Name: "app_linux_amd64.tar.gz", Digest: DigestSet{"sha256": digestA, "sha512": strings.Repeat("c", 128)}, Type: TypeFile}},
+		},
+		{
+			name:     "manifest subject without name",
+			resolver: func(volume string) Resolver { return Manifest{SharedVolumePath: volume} },
+			pod:      pod,
+			files:    map[string]string{ManifestFile: `{"subjects":[{"digest":{"sha256":"` + digestA + `"}}]}`},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := sharedVolume(t, tt.pod, tt.files)
+
+			got, err := tt.resolver(volume).Resolve(context.Background(), tt.pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/example/app:build-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Registry{Ref: ref.String(), RemoteOptions: image.RemoteOptions{}}.Resolve(context.Background(), buildPod(nil))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := []Subject{{Name: ref.Context().Name(), Digest: DigestSet{"sha256": h.Hex}, Type: TypeImage}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %+v, want %+v", got, want)
+	}
+
+	if _, err := (Registry{Ref: ref.Context().Tag("missing").String()}).Resolve(context.Background(), buildPod(nil)); err == nil {
+		t.Error("Resolve() of a missing tag succeeded")
+	}
+}
+
+// failingResolver is a resolver that always fails.
+type failingResolver struct{}
+
+func (failingResolver) Name() string { return "failing" }
+
+func (failingResolver) Resolve(context.Context, *corev1.Pod) ([]Subject, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestChainResolve(t *testing.T) {
+	pod := buildPod(map[string]string{DigestAnnotation: "sha256:" + digestA}, `[{"key":"COMMIT","value":"abc"}]`)
+
+	subjects, resolver, err := Chain{failingResolver{}, Tekton{}, Annotation{}, Kaniko{}}.Resolve(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resolver != "annotation" || len(subjects) != 1 {
+		t.Errorf("Resolve() = %+v from %s, want the annotation subject", subjects, resolver)
+	}
+
+	_, _, err = Chain{failingResolver{}, Tekton{}}.Resolve(context.Background(), buildPod(nil))
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "failing: unavailable") {
+		t.Errorf("Resolve() error = %v, want ErrNotFound with the resolver errors", err)
+	}
+}
@@ -0,0 +1,140 @@
+package subject
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	tektonImageDigestSuffix = "IMAGE_DIGEST"
+	tektonImageURLSuffix    = "IMAGE_URL"
+	tektonImagesResult      = "IMAGES"
+
+	tektonArtifactDigestSuffix = "ARTIFACT_DIGEST"
+	tektonArtifactURISuffix    = "ARTIFACT_URI"
+
+	// legacyDigestResult is the result name attestagon originally looked for.
+	legacyDigestResult = "digest"
+)
+
+// tektonResult is a result written by a Tekton step to the termination message.
+type tektonResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Tekton resolves subjects from Tekton task results, following the Tekton
+// Chains type hinting conventions:
+//   - IMAGE_DIGEST and IMAGE_URL results,
+//   - <prefix>_IMAGE_DIGEST and <prefix>_IMAGE_URL result pairs,
+//   - an IMAGES result listing <url>@<digest> references,
+//   - ARTIFACT_URI and ARTIFACT_DIGEST results, and <prefix>_ARTIFACT_URI
+//     and <prefix>_ARTIFACT_DIGEST result pairs, for file subjects.
+//
+// A result named "digest" is also supported.
+type Tekton struct{}
+
+func (Tekton) Name() string {
+	return "tekton"
+}
+
+func (Tekton) Resolve(_ context.Context, pod *corev1.Pod) ([]Subject, error) {
+	results := make(map[string]string)
+	for _, message := range terminationMessages(pod) {
+		var rs []tektonResult
+		if err := json.Unmarshal([]byte(message), &rs); err != nil {
+			// Not every container writes Tekton results to its termination message.
+			continue
+		}
+
+		for _, r := range rs {
+			results[r.Key] = strings.TrimSpace(r.Value)
+		}
+	}
+
+	return TektonSubjects(results)
+}
+
+// TektonSubjects returns the subjects described by the Tekton results.
+func TektonSubjects(results map[string]string) ([]Subject, error) {
+	var subjects []Subject
+
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var (
+			prefix string
+			typ    Type
+			ok     bool
+		)
+		if prefix, ok = strings.CutSuffix(key, tektonImageDigestSuffix); ok {
+			typ = TypeImage
+		} else if prefix, ok = strings.CutSuffix(key, tektonArtifactDigestSuffix); ok {
+			typ = TypeFile
+		} else {
+			continue
+		}
+
+		digest, err := parseDigest(results[key])
+		if err != nil {
+			return nil, fmt.Errorf("result %s: %w", key, err)
+		}
+
+		s := Subject{Digest: digest, Type: typ, Result: key}
+		if typ == TypeImage {
+			s.Name = imageName(results[prefix+tektonImageURLSuffix])
+		} else {
+			s.Name = results[prefix+tektonArtifactURISuffix]
+			if s.Name == "" {
+				return nil, fmt.Errorf("result %s has no matching %s result", key, prefix+tektonArtifactURISuffix)
+			}
+		}
+
+		subjects = append(subjects, s)
+	}
+
+	if images, ok := results[tektonImagesResult]; ok {
+		for _, image := range strings.FieldsFunc(images, func(r rune) bool { return r == ',' || r == '\n' }) {
+			name, digest, ok := strings.Cut(strings.TrimSpace(image), "@")
+			if !ok {
+				return nil, fmt.Errorf("result %s: image %q has no digest", tektonImagesResult, image)
+			}
+
+			d, err := parseDigest(digest)
+			if err != nil {
+				return nil, fmt.Errorf("result %s: %w", tektonImagesResult, err)
+			}
+
+			subjects = append(subjects, Subject{Name: imageName(name), Digest: d, Type: TypeImage, Result: tektonImagesResult})
+		}
+	}
+
+	if digest, ok := results[legacyDigestResult]; ok && len(subjects) == 0 {
+		d, err := parseDigest(digest)
+		if err != nil {
+			return nil, fmt.Errorf("result %s: %w", legacyDigestResult, err)
+		}
+
+		subjects = append(subjects, Subject{Digest: d, Type: TypeImage, Result: legacyDigestResult})
+	}
+
+	return subjects, nil
+}
+
+// imageName strips the tag and digest from an image reference.
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,136 @@
+package subject
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	digestA = strings.Repeat("a", 64)
+	digestB = strings.Repeat("b", 64)
+)
+
+// tektonPod returns a TaskRun pod whose step containers terminated with the termination messages. An empty message
+// is a step that is still running.
+func tektonPod(messages ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "build-image-pod",
+			Namespace: "builds",
+			Labels: map[string]string{
+				"tekton.dev/taskRun": "build-image",
+				"tekton.dev/task":    "kaniko",
+			},
+		},
+	}
+
+	for i, message := range messages {
+		status := corev1.ContainerStatus{Name: "step-" + string(rune('a'+i))}
+		if message == "" {
+			status.State.Running = &corev1.ContainerStateRunning{}
+		} else {
+			status.State.Terminated = &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", Message: message}
+		}
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, status)
+	}
+
+	return pod
+}
+
+func TestTektonResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+
+		want    []Subject
+		wantErr string
+	}{
+		{
+			name: "image digest and url",
+			pod: tektonPod(
+				`[{"key":"IMAGE_DIGEST","value":"sha256:` + digestA + `","type":1},{"key":"IMAGE_URL","value":"ghcr.io/example/app:v1\n","type":1}]`,
+			),
+			want: []Subject{{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "IMAGE_DIGEST"}},
+		},
+		{
+			name: "results of several steps",
+			pod: tektonPod(
+				`[{"key":"IMAGE_DIGEST","value":"sha256:`+digestA+`","type":1}]`,
+				`[{"key":"IMAGE_URL","value":"ghcr.io/example/app","type":1}]`,
+			),
+			want: []Subject{{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "IMAGE_DIGEST"}},
+		},
+		{
+			name: "prefixed images and artifacts",
+			pod: tektonPod(`[` +
+				`{"key":"APP_IMAGE_DIGEST","value":"sha256:` + digestA + `"},` +
+				`{"key":"APP_IMAGE_URL","value":"ghcr.io/example/app@sha256:` + digestA + `"},` +
+				`{"key":"CLI_ARTIFACT_DIGEST","value":"sha256:` + digestB + `"},` +
+				`{"key":"CLI_ARTIFACT_URI","value":"https://releases.example.com/cli.tar.gz"}]`),
+			want: []Subject{
+				{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "APP_IMAGE_DIGEST"},
+				{Name: "https://releases.example.com/cli.tar.gz", Digest: DigestSet{"sha256": digestB}, Type: TypeFile, Result: "CLI_ARTIFACT_DIGEST"},
+			},
+		},
+		{
+			name: "images list",
+			pod:  tektonPod(`[{"key":"IMAGES","value":"ghcr.io/example/app@sha256:` + digestA + `,\nlocalhost:5000/example/cli:v1@sha256:` + digestB + `"}]`),
+			want: []Subject{
+				{Name: "ghcr.io/example/app", Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "IMAGES"},
+				{Name: "localhost:5000/example/cli", Digest: DigestSet{"sha256": digestB}, Type: TypeImage, Result: "IMAGES"},
+			},
+		},
+		{
+			name: "legacy digest result",
+			pod:  tektonPod(`[{"key":"digest","value":"sha256:` + digestA + `"}]`),
+			want: []Subject{{Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "digest"}},
+		},
+		{
+			name: "running and non-tekton containers are skipped",
+			pod:  tektonPod("", "Error: build failed", `[{"key":"IMAGE_DIGEST","value":"sha256:`+digestA+`"}]`),
+			want: []Subject{{Digest: DigestSet{"sha256": digestA}, Type: TypeImage, Result: "IMAGE_DIGEST"}},
+		},
+		{
+			name: "no results",
+			pod:  tektonPod(`[{"key":"COMMIT","value":"abc"}]`),
+		},
+		{
+			name:    "invalid digest",
+			pod:     tektonPod(`[{"key":"IMAGE_DIGEST","value":"sha256:abc"}]`),
+			wantErr: "result IMAGE_DIGEST",
+		},
+		{
+			name:    "artifact without uri",
+			pod:     tektonPod(`[{"key":"ARTIFACT_DIGEST","value":"sha256:` + digestA + `"}]`),
+			wantErr: "no matching ARTIFACT_URI result",
+		},
+		{
+			name:    "image without digest",
+			pod:     tektonPod(`[{"key":"IMAGES","value":"ghcr.io/example/app:v1"}]`),
+			wantErr: "has no digest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tekton{}.Resolve(context.Background(), tt.pod)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ArtifactPolicy configures how attestagon attests an artifact built by pods in the namespace of the policy. All
+// references to Secrets and ConfigMaps are resolved in the namespace of the policy.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=ap
+// +kubebuilder:printcolumn:name="Artifact",type=string,JSONPath=`.spec.artifactName`
+// +kubebuilder:printcolumn:name="Ref",type=string,JSONPath=`.spec.ref`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ArtifactPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ArtifactPolicySpec `json:"spec"`
+}
+
+// ArtifactPolicySpec is the specification of an ArtifactPolicy.
+type ArtifactPolicySpec struct {
+	// ArtifactName is the name pods use in the attestagon.io/artifact annotation to declare they build the artifact.
+	// Defaults to the name of the policy.
+	// +optional
+	ArtifactName string `json:"artifactName,omitempty"`
+
+	// Selector selects the pods in the namespace that build the artifact. Pods declaring the artifact in the
+	// attestagon.io/artifact annotation must also match the selector if it is set.
+	// +optional
+	Selector *PodSelector `json:"selector,omitempty"`
+
+	// Ref is the image repository the attestation is attached to. It must be allowed by the controller configuration.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Storage is how attestations are stored in the registry, either "tag" for the cosign tag scheme or "referrers"
+	// for OCI 1.1 referrers.
+	// +kubebuilder:validation:Enum=tag;referrers
+	// +optional
+	Storage string `json:"storage,omitempty"`
+
+	// Credentials configures where registry credentials are resolved from.
+	// +optional
+	Credentials RegistryCredentials `json:"credentials,omitempty"`
+
+	// Transport configures how the registry is contacted.
+	// +optional
+	Transport RegistryTransport `json:"transport,omitempty"`
+
+	// Subjects configures how the subjects of the attestation are discovered.
+	// +optional
+	Subjects SubjectPolicy `json:"subjects,omitempty"`
+
+	// Signer is the key attestations of the artifact are signed with. Policies never use the signer of the controller.
+	Signer *Signer `json:"signer"`
+
+	// Sinks are the destinations the signed attestation is written to in addition to the registry at Ref.
+	// +optional
+	Sinks []Sink `json:"sinks,omitempty"`
+
+	// FailedBuilds configures the attestation of pods that fail to build the artifact.
+	// +optional
+	FailedBuilds *FailedBuilds `json:"failedBuilds,omitempty"`
+
+	// Aggregate combines the pods building the artifact into one attestation per owner instead of attesting every
+	// pod.
+	// +optional
+	Aggregate *Aggregate `json:"aggregate,omitempty"`
+}
+
+// Aggregate configures the aggregation of pods into one attestation per owner, once the owner completes.
+type Aggregate struct {
+	// Kind is the kind of the owner pods are aggregated by.
+	// +kubebuilder:validation:Enum=TaskRun;PipelineRun;Job;Workflow
+	Kind string `json:"kind"`
+}
+
+// FailedBuilds configures the attestation of failed builds. Attestations of failed builds use a separate predicate
+// type and are never written to the registry at Ref.
+type FailedBuilds struct {
+	// Enabled turns on the attestation of failed builds.
+	Enabled bool `json:"enabled"`
+
+	// Sinks are the destinations attestations of failed builds are written to. The sinks of the policy are used if
+	// none are set.
+	// +optional
+	Sinks []Sink `json:"sinks,omitempty"`
+}
+
+// PodSelector selects pods. Every criterion that is set must match.
+type PodSelector struct {
+	metav1.LabelSelector `json:",inline"`
+
+	// OwnerKinds are the kinds of controllers owning the selected pods, e.g. TaskRun, Job or Workflow.
+	// +optional
+	OwnerKinds []string `json:"ownerKinds,omitempty"`
+
+	// TektonTasks are the names of the Tekton Tasks whose TaskRun pods are selected.
+	// +optional
+	TektonTasks []string `json:"tektonTasks,omitempty"`
+}
+
+// RegistryCredentials configures the sources of registry credentials.
+type RegistryCredentials struct {
+	// SecretRef is a reference to a kubernetes.io/dockerconfigjson Secret.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// UsePodCredentials uses the imagePullSecrets of the pod and of its service account.
+	// +optional
+	UsePodCredentials bool `json:"usePodCredentials,omitempty"`
+}
+
+// RegistryTransport configures the connection to the registry.
+type RegistryTransport struct {
+	// CABundleRef is a reference to a ConfigMap key containing PEM encoded CA certificates.
+	// +optional
+	CABundleRef *KeySelector `json:"caBundleRef,omitempty"`
+
+	// AllowInsecure allows the registry to be contacted over plain HTTP or with an unverified TLS certificate, if the
+	// controller configuration allows it.
+	// +optional
+	AllowInsecure bool `json:"allowInsecure,omitempty"`
+
+	// ProxyURL is the URL of the proxy used to contact the registry.
+	// +optional
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// ClientCertSecretRef is a reference to a kubernetes.io/tls Secret used for mutual TLS.
+	// +optional
+	ClientCertSecretRef *LocalObjectReference `json:"clientCertSecretRef,omitempty"`
+}
+
+// SubjectPolicy configures the resolvers used to discover the subjects of an attestation.
+type SubjectPolicy struct {
+	// Resolvers are the names of the resolvers to try, in order.
+	// +optional
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// Tag is the tag the build pushes to the repository at Ref, used by the "registry" resolver.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// References maps the names of build results to the image repository of the subject read from that result.
+	// +optional
+	References map[string]string `json:"references,omitempty"`
+}
+
+// Signer configures the key used to sign attestations.
+type Signer struct {
+	// KeySecretRef is a reference to the Secret key containing the PEM encoded private key.
+	KeySecretRef KeySelector `json:"keySecretRef"`
+
+	// PasswordKey is the key of the same Secret containing the password of the private key.
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// Sink is a destination for signed attestations. Exactly one field must be set.
+// +kubebuilder:validation:MinProperties=1
+// +kubebuilder:validation:MaxProperties=1
+type Sink struct {
+	// +optional
+	Archivista *ArchivistaSink `json:"archivista,omitempty"`
+
+	// +optional
+	HTTP *HTTPSink `json:"http,omitempty"`
+}
+
+// ArchivistaSink uploads signed attestations to Archivista.
+type ArchivistaSink struct {
+	// URL is the address of the Archivista instance.
+	URL string `json:"url"`
+
+	// HeadersSecretRef is a reference to a Secret whose keys and values are added as headers to upload requests.
+	// +optional
+	HeadersSecretRef *LocalObjectReference `json:"headersSecretRef,omitempty"`
+
+	// MaxRetries is the number of times a failed upload is retried. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int `json:"maxRetries,omitempty"`
+}
+
+// HTTPSink posts signed attestations to an HTTP endpoint.
+type HTTPSink struct {
+	// URL is the address the attestations are posted to.
+	URL string `json:"url"`
+
+	// Format is either "bundle" for sigstore bundles or "dsse" for DSSE envelopes.
+	// +kubebuilder:validation:Enum=bundle;dsse
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// HeadersSecretRef is a reference to a Secret whose keys and values are added as headers to requests.
+	// +optional
+	HeadersSecretRef *LocalObjectReference `json:"headersSecretRef,omitempty"`
+
+	// MaxRetries is the number of times a failed request is retried. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int `json:"maxRetries,omitempty"`
+}
+
+// LocalObjectReference is a reference to an object in the namespace of the policy.
+type LocalObjectReference struct {
+	Name string `json:"name"`
+}
+
+// KeySelector is a reference to a key of an object in the namespace of the policy.
+type KeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// ArtifactPolicyList is a list of ArtifactPolicies.
+// +kubebuilder:object:root=true
+type ArtifactPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ArtifactPolicy `json:"items"`
+}
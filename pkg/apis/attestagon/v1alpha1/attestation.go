@@ -0,0 +1,90 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ConditionWritten is the condition type reporting whether the attestation was written to every sink.
+	ConditionWritten = "Written"
+)
+
+// Attestation records a signed attestation produced by attestagon for a pod.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=att
+// +kubebuilder:printcolumn:name="Artifact",type=string,JSONPath=`.spec.artifact`
+// +kubebuilder:printcolumn:name="Pod",type=string,JSONPath=`.spec.pod.name`
+// +kubebuilder:printcolumn:name="Written",type=string,JSONPath=`.status.conditions[?(@.type=="Written")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type Attestation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AttestationSpec   `json:"spec"`
+	Status AttestationStatus `json:"status,omitempty"`
+}
+
+// AttestationSpec describes the signed attestation.
+type AttestationSpec struct {
+	// Artifact is the name of the attested artifact.
+	Artifact string `json:"artifact"`
+
+	// Policy is the name of the ArtifactPolicy the artifact is configured by. Empty if the artifact is configured by
+	// the controller configuration file.
+	// +optional
+	Policy string `json:"policy,omitempty"`
+
+	// Pod is the pod that built the artifact.
+	Pod PodReference `json:"pod"`
+
+	// PredicateType is the predicate type of the statement.
+	PredicateType string `json:"predicateType"`
+
+	// Subjects are the subjects of the statement.
+	Subjects []Subject `json:"subjects"`
+
+	// StatementDigest is the hex encoded sha256 digest of the JSON encoded statement.
+	StatementDigest string `json:"statementDigest"`
+}
+
+// PodReference is a reference to a pod in the namespace of the attestation.
+type PodReference struct {
+	Name string    `json:"name"`
+	UID  types.UID `json:"uid"`
+}
+
+// Subject is a subject of the attested statement.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// AttestationStatus is the observed state of an Attestation.
+type AttestationStatus struct {
+	// Locations are the locations the attestation was written to.
+	// +optional
+	Locations []Location `json:"locations,omitempty"`
+
+	// Conditions are the conditions of the attestation.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Location is a location a sink wrote the attestation to.
+type Location struct {
+	Sink     string `json:"sink"`
+	Location string `json:"location"`
+}
+
+// AttestationList is a list of Attestations.
+// +kubebuilder:object:root=true
+type AttestationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Attestation `json:"items"`
+}
@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the v1alpha1 attestagon.io API types.
+// +kubebuilder:object:generate=true
+// +groupName=attestagon.io
+package v1alpha1
@@ -15,6 +15,10 @@ type options struct {
 	Exit          func(code int)
 	SignalChannel func() chan os.Signal
 	Log           logr.Logger
+
+	// Reload, if set, receives SIGHUP signals instead of the command being
+	// restarted.
+	Reload chan<- struct{}
 }
 
 // defaultOptions are the default options for Execute which uses os.Exit as the
@@ -43,6 +47,19 @@ func Execute(cmdFn func(context.Context) error) error {
 	return executeWithOptions(cmdFn, defaultOptions())
 }
 
+// ExecuteWithReload is the same as Execute, except that a SIGHUP does not
+// restart the function. Instead, it is passed to the function on the reload
+// channel so that it can reload its configuration while it keeps running.
+func ExecuteWithReload(cmdFn func(ctx context.Context, reload <-chan struct{}) error) error {
+	reload := make(chan struct{}, 1)
+	opts := defaultOptions()
+	opts.Reload = reload
+
+	return executeWithOptions(func(ctx context.Context) error {
+		return cmdFn(ctx, reload)
+	}, opts)
+}
+
 // executeWithOptions is the same as Execute, but allows for custom options to
 // be passed. Only needed for testing.
 func executeWithOptions(cmdFn func(context.Context) error, opts options) error {
@@ -57,10 +74,25 @@ func executeWithOptions(cmdFn func(context.Context) error, opts options) error {
 
 		go func() {
 			defer close(gofuncStopped)
-			select {
-			case sig = <-ch:
-			case <-cmdStopped:
-				return
+			for {
+				select {
+				case sig = <-ch:
+				case <-cmdStopped:
+					return
+				}
+
+				if sig != syscall.SIGHUP || opts.Reload == nil {
+					break
+				}
+
+				// The signal is handled by the command, so it must not restart it.
+				sig = nil
+				log.Info("received SIGHUP, reloading configuration...")
+				select {
+				case opts.Reload <- struct{}{}:
+				default:
+					// A reload is already pending.
+				}
 			}
 
 			if sig == syscall.SIGHUP {
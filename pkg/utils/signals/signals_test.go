@@ -0,0 +1,90 @@
+package signals
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestExecuteReload(t *testing.T) {
+	tests := []struct {
+		name   string
+		reload bool
+
+		wantRuns    int
+		wantReloads int
+	}{
+		{
+			name:        "SIGHUP is passed to the command",
+			reload:      true,
+			wantRuns:    1,
+			wantReloads: 1,
+		},
+		{
+			name:     "SIGHUP restarts the command",
+			wantRuns: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signals := make(chan os.Signal, 2)
+			opts := options{
+				Log:           logr.Discard(),
+				Exit:          func(code int) { t.Errorf("exited with code %d", code) },
+				SignalChannel: func() chan os.Signal { return signals },
+			}
+
+			var reload chan struct{}
+			if tt.reload {
+				reload = make(chan struct{}, 1)
+				opts.Reload = reload
+			}
+
+			var runs, reloads int
+			started := make(chan struct{})
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- executeWithOptions(func(ctx context.Context) error {
+					runs++
+					started <- struct{}{}
+					for {
+						select {
+						case <-ctx.Done():
+							return nil
+						case <-reload:
+							reloads++
+							started <- struct{}{}
+						}
+					}
+				}, opts)
+			}()
+
+			<-started
+			signals <- syscall.SIGHUP
+			select {
+			case <-started:
+			case <-time.After(10 * time.Second):
+				t.Fatal("command was neither reloaded nor restarted after SIGHUP")
+			}
+
+			signals <- syscall.SIGTERM
+			select {
+			case err := <-errCh:
+				if err != nil {
+					t.Fatalf("executeWithOptions() error = %v", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("command did not stop after SIGTERM")
+			}
+
+			if runs != tt.wantRuns || reloads != tt.wantReloads {
+				t.Errorf("command ran %d times and reloaded %d times, want %d runs and %d reloads", runs, reloads, tt.wantRuns, tt.wantReloads)
+			}
+		})
+	}
+}